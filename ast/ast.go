@@ -10,6 +10,8 @@ import (
 type Node interface {
 	TokenLiteral() string // help debug
 	String() string
+	Pos() token.Position // the position of the first character of the node
+	End() token.Position // the position right after the node
 }
 
 type Statement interface {
@@ -33,11 +35,14 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 func (p *Program) String() string {
-	out := bytes.Buffer{}
+	var stmts []string
 	for _, stmt := range p.Statements {
-		out.WriteString(stmt.String())
+		if es, ok := stmt.(*ExpressionStatement); ok && es.Expression == nil {
+			continue
+		}
+		stmts = append(stmts, stmt.String())
 	}
-	return out.String()
+	return strings.Join(stmts, "; ")
 }
 
 type NullExpression struct {
@@ -49,8 +54,8 @@ func (n *NullExpression) TokenLiteral() string { return "null" }
 func (n *NullExpression) String() string       { return "null" }
 
 type LetStatement struct {
-	Token token.Token // the LET token
-	Name  *Identifier // identifier name
+	Token token.Token // the LET or CONST token
+	Name  Expression  // an identifier or a pattern
 	Value Expression  // RHS value
 }
 
@@ -67,6 +72,9 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// IsConst reports whether the statement declares a constant, which cannot be assigned again
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
 type DeleteStatement struct {
 	Token token.Token // the DELETE token
 	Value Expression  // RHS expr(identifier or indexExpression)
@@ -230,6 +238,7 @@ func (i *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Position // the position of the closing }
 }
 
 func (b *BlockStatement) statementNode()       {}
@@ -249,9 +258,10 @@ func (b *BlockStatement) String() string {
 }
 
 type FunctionLiteral struct {
-	Token      token.Token // the FUNCTION token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Token       token.Token  // the FUNCTION token
+	Parameters  []Expression // identifiers or patterns
+	Body        *BlockStatement
+	IsGenerator bool // whether the body contains a yield of its own
 }
 
 func (f *FunctionLiteral) expressionNode()      {}
@@ -275,6 +285,7 @@ type CallExpression struct {
 	Token     token.Token // the ( token
 	Function  Expression  // function identifier expression
 	Arguments []Expression
+	Rparen    token.Position // the position of the closing )
 }
 
 func (c *CallExpression) expressionNode()      {}
@@ -341,7 +352,7 @@ type TypeofExpression struct {
 
 func (t *TypeofExpression) expressionNode()      {}
 func (t *TypeofExpression) TokenLiteral() string { return t.Token.Literal }
-func (t *TypeofExpression) String() string       { return "typeof" + t.Expr.String() }
+func (t *TypeofExpression) String() string       { return "typeof " + t.Expr.String() }
 
 type AssignExpression struct {
 	Token token.Token // the assign token e.g. = -= +=
@@ -361,9 +372,10 @@ func (a *AssignExpression) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Position // the position of the closing ]
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -426,6 +438,7 @@ func (s *StringLiteral) String() string       { return s.Token.Literal }
 type ArrayLiteral struct {
 	Token    token.Token // the [ token
 	Elements []Expression
+	Rbracket token.Position // the position of the closing ]
 }
 
 func (a *ArrayLiteral) expressionNode()      {}
@@ -462,7 +475,7 @@ func (mc *MethodCallExpression) String() string {
 type SliceExpression struct {
 	Token token.Token // the : token
 	Start Expression
-	End   Expression
+	Stop  Expression // nil when slicing to the end
 }
 
 func (s *SliceExpression) expressionNode()      {}
@@ -472,14 +485,18 @@ func (s *SliceExpression) String() string {
 	out.WriteString("(")
 	out.WriteString(s.Start.String())
 	out.WriteString(":")
-	out.WriteString(s.End.String())
+	if s.Stop != nil {
+		out.WriteString(s.Stop.String())
+	}
 	out.WriteString(")")
 	return out.String()
 }
 
 type HashLiteral struct {
-	Token token.Token // the { token
-	Pairs map[Expression]Expression
+	Token  token.Token               // the { token
+	Pairs  map[Expression]Expression // a SpreadExpression key has no value
+	Keys   []Expression              // the keys of Pairs in source order
+	Rbrace token.Position            // the position of the closing }
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -487,11 +504,228 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	var pairs []string
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		if _, ok := key.(*SpreadExpression); ok {
+			pairs = append(pairs, key.String())
+			continue
+		}
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
 	return out.String()
 }
+
+type TemplateLiteral struct {
+	Token       token.Token // the TEMPLATE token, its literal is the raw body of the template
+	Parts       []string    // literal parts with escapes resolved, always one more than Expressions
+	Expressions []Expression
+}
+
+func (t *TemplateLiteral) expressionNode()      {}
+func (t *TemplateLiteral) TokenLiteral() string { return t.Token.Literal }
+func (t *TemplateLiteral) String() string       { return "`" + t.Token.Literal + "`" }
+
+type TaggedTemplateExpression struct {
+	Token    token.Token // the TEMPLATE token
+	Tag      Expression  // function receiving the literal parts and the values
+	Template *TemplateLiteral
+}
+
+func (tt *TaggedTemplateExpression) expressionNode()      {}
+func (tt *TaggedTemplateExpression) TokenLiteral() string { return tt.Token.Literal }
+func (tt *TaggedTemplateExpression) String() string {
+	return tt.Tag.String() + tt.Template.String()
+}
+
+type YieldExpression struct {
+	Token token.Token // the YIELD token
+	Value Expression  // nil when yielding null
+}
+
+func (y *YieldExpression) expressionNode()      {}
+func (y *YieldExpression) TokenLiteral() string { return y.Token.Literal }
+func (y *YieldExpression) String() string {
+	if y.Value == nil {
+		return y.Token.Literal
+	}
+	return y.Token.Literal + " " + y.Value.String()
+}
+
+type ForOfExpression struct {
+	Token    token.Token // the FOR token
+	Name     *Identifier // the loop variable
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (f *ForOfExpression) expressionNode()      {}
+func (f *ForOfExpression) TokenLiteral() string { return f.Token.Literal }
+func (f *ForOfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("for ( let ")
+	out.WriteString(f.Name.String())
+	out.WriteString(" of ")
+	out.WriteString(f.Iterable.String())
+	out.WriteString(" ) ")
+	out.WriteString(" { ")
+	if f.Body != nil {
+		out.WriteString(f.Body.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+type SpawnExpression struct {
+	Token token.Token // the SPAWN token
+	Call  *CallExpression
+}
+
+func (sp *SpawnExpression) expressionNode()      {}
+func (sp *SpawnExpression) TokenLiteral() string { return sp.Token.Literal }
+func (sp *SpawnExpression) String() string       { return "spawn " + sp.Call.String() }
+
+type SelectExpression struct {
+	Token  token.Token // the SELECT token
+	Cases  []*SelectCase
+	Rbrace token.Position // the position of the closing }
+}
+
+func (se *SelectExpression) expressionNode()      {}
+func (se *SelectExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("select { ")
+	for _, c := range se.Cases {
+		out.WriteString(c.String())
+		out.WriteString(" ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// SelectCase is one branch of a select, either
+//
+//	case let name = channel.recv() { body }
+//	case channel.send(value) { body }
+//	default { body }
+type SelectCase struct {
+	Token   token.Token // the CASE or DEFAULT token
+	Name    *Identifier // receives the value of a recv case, optional
+	Channel Expression  // nil for the default case
+	Send    Expression  // the value of a send case, nil for a recv case
+	Body    *BlockStatement
+}
+
+func (sc *SelectCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+	switch {
+	case sc.Channel == nil:
+		out.WriteString("default")
+	case sc.Send != nil:
+		out.WriteString("case " + sc.Channel.String() + ".send(" + sc.Send.String() + ")")
+	case sc.Name != nil:
+		out.WriteString("case let " + sc.Name.String() + " = " + sc.Channel.String() + ".recv()")
+	default:
+		out.WriteString("case " + sc.Channel.String() + ".recv()")
+	}
+	out.WriteString(" { ")
+	out.WriteString(sc.Body.String())
+	out.WriteString(" }")
+	return out.String()
+}
+
+// ArrayPattern destructures an array in a let, an assignment or a parameter list:
+//
+//	let [first, [x, y], z = 0, ...rest] = value
+//
+// Its elements are targets: identifiers, patterns or, in an assignment, index expressions. A target may have a
+// default, as an AssignExpression, which it gets when the array is too short.
+type ArrayPattern struct {
+	Token    token.Token // the [ token
+	Elements []Expression
+	Rest     Expression     // the target after ..., which gets an array of the elements left, nil if there is none
+	Rbracket token.Position // the position of the closing ]
+}
+
+func (ap *ArrayPattern) expressionNode()      {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	var elements []string
+	for _, e := range ap.Elements {
+		elements = append(elements, e.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern destructures a hash by key:
+//
+//	let {name, age: years, city = "n/a", ...others} = value
+type HashPattern struct {
+	Token      token.Token // the { token
+	Properties []*PatternProperty
+	Rest       Expression     // the target after ..., which gets a hash of the pairs left, nil if there is none
+	Rbrace     token.Position // the position of the closing }
+}
+
+func (hp *HashPattern) expressionNode()      {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	var properties []string
+	for _, p := range hp.Properties {
+		properties = append(properties, p.String())
+	}
+	if hp.Rest != nil {
+		properties = append(properties, "..."+hp.Rest.String())
+	}
+	return "{" + strings.Join(properties, ", ") + "}"
+}
+
+// PatternProperty is a key of a hash pattern and the target its value goes to, in {name} the target is the
+// variable called like the key
+type PatternProperty struct {
+	Key   Expression // an identifier stands for its name, like in a hash literal
+	Value Expression // the target, which may have a default
+}
+
+func (pp *PatternProperty) TokenLiteral() string { return pp.Key.TokenLiteral() }
+func (pp *PatternProperty) String() string {
+	if pp.IsShorthand() {
+		return pp.Value.String()
+	}
+	return pp.Key.String() + ":" + pp.Value.String()
+}
+
+// IsShorthand reports whether the target is the variable called like the key, as in {name} or {name = 1}
+func (pp *PatternProperty) IsShorthand() bool {
+	key, ok := pp.Key.(*Identifier)
+	if !ok {
+		return false
+	}
+	target := pp.Value
+	if a, ok := target.(*AssignExpression); ok {
+		target = a.Name
+	}
+	ident, ok := target.(*Identifier)
+	return ok && ident.Value == key.Value
+}
+
+// SpreadExpression puts the elements of Value into an array literal or the arguments of a call, or the pairs of
+// Value into a hash literal, where it is a key without a value:
+//
+//	[...a, 0, ...b]
+//	{...defaults, debug: true}
+//	f(...args)
+type SpreadExpression struct {
+	Token token.Token // the ... token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
@@ -0,0 +1,262 @@
+package ast
+
+import "fmt"
+
+// Clone returns a deep copy of node, which shares no node, slice or map with it
+func Clone(node Node) Node {
+	if isNil(node) {
+		return node
+	}
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Statements = cloneStatements(n.Statements)
+		return &c
+	case *BlockStatement:
+		return cloneBlock(n)
+	case *LetStatement:
+		c := *n
+		c.Name, c.Value = cloneExpression(n.Name), cloneExpression(n.Value)
+		return &c
+	case *DeleteStatement:
+		c := *n
+		c.Value = cloneExpression(n.Value)
+		return &c
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = cloneExpression(n.ReturnValue)
+		return &c
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = cloneExpression(n.Expression)
+		return &c
+	case *Identifier:
+		return cloneIdentifier(n)
+	case *NullExpression:
+		c := *n
+		return &c
+	case *IntegerLiteral:
+		c := *n
+		return &c
+	case *FloatLiteral:
+		c := *n
+		return &c
+	case *BooleanLiteral:
+		c := *n
+		return &c
+	case *StringLiteral:
+		c := *n
+		return &c
+	case *BreakExpression:
+		c := *n
+		return &c
+	case *ContinueExpression:
+		c := *n
+		return &c
+	case *PrefixExpression:
+		c := *n
+		c.Right = cloneExpression(n.Right)
+		return &c
+	case *InfixExpression:
+		c := *n
+		c.Left, c.Right = cloneExpression(n.Left), cloneExpression(n.Right)
+		return &c
+	case *PostfixExpression:
+		c := *n
+		c.Left = cloneExpression(n.Left)
+		return &c
+	case *IfExpression:
+		c := *n
+		c.Condition, c.Consequence, c.Alternative = cloneExpression(n.Condition), cloneBlock(n.Consequence), cloneBlock(n.Alternative)
+		return &c
+	case *FunctionLiteral:
+		c := *n
+		c.Parameters, c.Body = cloneExpressions(n.Parameters), cloneBlock(n.Body)
+		return &c
+	case *CallExpression:
+		return cloneCall(n)
+	case *WhileExpression:
+		c := *n
+		c.Condition, c.Body = cloneExpression(n.Condition), cloneBlock(n.Body)
+		return &c
+	case *TypeofExpression:
+		c := *n
+		c.Expr = cloneExpression(n.Expr)
+		return &c
+	case *AssignExpression:
+		c := *n
+		c.Name, c.Value = cloneExpression(n.Name), cloneExpression(n.Value)
+		return &c
+	case *IndexExpression:
+		c := *n
+		c.Left, c.Index = cloneExpression(n.Left), cloneExpression(n.Index)
+		return &c
+	case *ForExpression:
+		c := *n
+		c.Init, c.Condition, c.Update, c.Body = Clone(n.Init), cloneExpression(n.Condition), cloneExpression(n.Update), cloneBlock(n.Body)
+		return &c
+	case *ArrayLiteral:
+		c := *n
+		c.Elements = cloneExpressions(n.Elements)
+		return &c
+	case *MethodCallExpression:
+		c := *n
+		c.Object, c.Call = cloneExpression(n.Object), cloneExpression(n.Call)
+		return &c
+	case *SliceExpression:
+		c := *n
+		c.Start, c.Stop = cloneExpression(n.Start), cloneExpression(n.Stop)
+		return &c
+	case *HashLiteral:
+		c := *n
+		c.Pairs, c.Keys = nil, nil
+		if n.Pairs != nil {
+			c.Pairs = make(map[Expression]Expression, len(n.Pairs))
+		}
+		if n.Keys != nil {
+			c.Keys = make([]Expression, len(n.Keys))
+		}
+		for i, key := range n.Keys {
+			c.Keys[i] = cloneExpression(key)
+			c.Pairs[c.Keys[i]] = cloneExpression(n.Pairs[key])
+		}
+		return &c
+	case *TemplateLiteral:
+		return cloneTemplate(n)
+	case *TaggedTemplateExpression:
+		c := *n
+		c.Tag, c.Template = cloneExpression(n.Tag), cloneTemplate(n.Template)
+		return &c
+	case *YieldExpression:
+		c := *n
+		c.Value = cloneExpression(n.Value)
+		return &c
+	case *ForOfExpression:
+		c := *n
+		c.Name, c.Iterable, c.Body = cloneIdentifier(n.Name), cloneExpression(n.Iterable), cloneBlock(n.Body)
+		return &c
+	case *SpawnExpression:
+		c := *n
+		c.Call = cloneCall(n.Call)
+		return &c
+	case *SelectExpression:
+		c := *n
+		if n.Cases != nil {
+			c.Cases = make([]*SelectCase, len(n.Cases))
+			for i, sc := range n.Cases {
+				c.Cases[i] = cloneSelectCase(sc)
+			}
+		}
+		return &c
+	case *SelectCase:
+		return cloneSelectCase(n)
+	case *ArrayPattern:
+		c := *n
+		c.Elements, c.Rest = cloneExpressions(n.Elements), cloneExpression(n.Rest)
+		return &c
+	case *HashPattern:
+		c := *n
+		if n.Properties != nil {
+			c.Properties = make([]*PatternProperty, len(n.Properties))
+			for i, p := range n.Properties {
+				c.Properties[i] = clonePatternProperty(p)
+			}
+		}
+		c.Rest = cloneExpression(n.Rest)
+		return &c
+	case *PatternProperty:
+		return clonePatternProperty(n)
+	case *SpreadExpression:
+		c := *n
+		c.Value = cloneExpression(n.Value)
+		return &c
+	}
+	panic(fmt.Sprintf("ast.Clone: unknown node %T", node))
+}
+
+func cloneStatements(list []Statement) []Statement {
+	if list == nil {
+		return nil
+	}
+	c := make([]Statement, len(list))
+	for i, stmt := range list {
+		if !isNil(stmt) {
+			c[i] = Clone(stmt).(Statement)
+		}
+	}
+	return c
+}
+
+func cloneExpressions(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	c := make([]Expression, len(list))
+	for i, e := range list {
+		c[i] = cloneExpression(e)
+	}
+	return c
+}
+
+func cloneExpression(e Expression) Expression {
+	if isNil(e) {
+		return e
+	}
+	return Clone(e).(Expression)
+}
+
+func cloneBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	c.Statements = cloneStatements(b.Statements)
+	return &c
+}
+
+func cloneIdentifier(id *Identifier) *Identifier {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+func cloneCall(call *CallExpression) *CallExpression {
+	if call == nil {
+		return nil
+	}
+	c := *call
+	c.Function, c.Arguments = cloneExpression(call.Function), cloneExpressions(call.Arguments)
+	return &c
+}
+
+func cloneTemplate(t *TemplateLiteral) *TemplateLiteral {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.Expressions = cloneExpressions(t.Expressions)
+	if t.Parts != nil {
+		c.Parts = append(make([]string, 0, len(t.Parts)), t.Parts...)
+	}
+	return &c
+}
+
+func cloneSelectCase(sc *SelectCase) *SelectCase {
+	if sc == nil {
+		return nil
+	}
+	c := *sc
+	c.Name, c.Channel, c.Send, c.Body = cloneIdentifier(sc.Name), cloneExpression(sc.Channel), cloneExpression(sc.Send), cloneBlock(sc.Body)
+	return &c
+}
+
+func clonePatternProperty(pp *PatternProperty) *PatternProperty {
+	if pp == nil {
+		return nil
+	}
+	c := *pp
+	c.Key, c.Value = cloneExpression(pp.Key), cloneExpression(pp.Value)
+	return &c
+}
@@ -0,0 +1,340 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/yzbmz5913/stang/token"
+	"reflect"
+	"strings"
+)
+
+// JSONVersion is the version of the JSON encoding of syntax trees, it changes when a change of the nodes breaks
+// reading trees written before
+const JSONVersion = 2
+
+// The JSON encoding of a tree is an object holding the version and the root node:
+//
+//	{"version": 2, "node": {"kind": "Program", "statements": [...]}}
+//
+// Each node is an object whose kind is the name of its type, its fields follow in the order of the struct with
+// their names in lower camel case. Tokens are objects with their type, literal, position and end, positions are
+// objects with their file, if any, offset, line and column. Missing nodes and positions are left out and the pairs
+// of a hash literal are a list of key and value objects in source order.
+
+// nodeKinds holds the types of the nodes by kind
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, n := range []Node{
+		&Program{}, &LetStatement{}, &DeleteStatement{}, &ReturnStatement{}, &ExpressionStatement{}, &BlockStatement{},
+		&Identifier{}, &NullExpression{}, &IntegerLiteral{}, &FloatLiteral{}, &BooleanLiteral{}, &StringLiteral{},
+		&PrefixExpression{}, &InfixExpression{}, &PostfixExpression{}, &IfExpression{}, &FunctionLiteral{},
+		&CallExpression{}, &WhileExpression{}, &BreakExpression{}, &ContinueExpression{}, &TypeofExpression{},
+		&AssignExpression{}, &IndexExpression{}, &ForExpression{}, &ArrayLiteral{}, &MethodCallExpression{},
+		&SliceExpression{}, &HashLiteral{}, &TemplateLiteral{}, &TaggedTemplateExpression{}, &YieldExpression{},
+		&ForOfExpression{}, &SpawnExpression{}, &SelectExpression{}, &SelectCase{}, &ArrayPattern{}, &HashPattern{},
+		&PatternProperty{}, &SpreadExpression{},
+	} {
+		t := reflect.TypeOf(n).Elem()
+		nodeKinds[t.Name()] = t
+	}
+}
+
+var (
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType    = reflect.TypeOf(token.Token{})
+	positionType = reflect.TypeOf(token.Position{})
+	hashType     = reflect.TypeOf(HashLiteral{})
+)
+
+type jsonTree struct {
+	Version int             `json:"version"`
+	Node    json.RawMessage `json:"node"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Pos     *jsonPosition   `json:"pos,omitempty"`
+	End     *jsonPosition   `json:"end,omitempty"`
+}
+
+type jsonPosition struct {
+	File   string `json:"file,omitempty"`
+	Offset int    `json:"offset"`
+	Line   int    `json:"line"`
+	Col    int    `json:"col"`
+}
+
+func toJSONPosition(pos token.Position) *jsonPosition {
+	if !pos.IsValid() {
+		return nil
+	}
+	return &jsonPosition{File: pos.Filename, Offset: pos.Offset, Line: pos.Line, Col: pos.Col}
+}
+
+func fromJSONPosition(pos *jsonPosition) token.Position {
+	if pos == nil {
+		return token.Position{}
+	}
+	return token.Position{Filename: pos.File, Offset: pos.Offset, Line: pos.Line, Col: pos.Col}
+}
+
+type jsonPair struct {
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// EncodeJSON returns the JSON encoding of the tree under node, the same tree always gets the same encoding
+func EncodeJSON(node Node) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"version":%d,"node":`, JSONVersion)
+	if err := encodeNode(&b, node); err != nil {
+		return nil, err
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+func encodeNode(b *bytes.Buffer, node Node) error {
+	if isNil(node) {
+		b.WriteString("null")
+		return nil
+	}
+	v := reflect.ValueOf(node)
+	t := v.Type().Elem()
+	if v.Kind() != reflect.Ptr || nodeKinds[t.Name()] != t {
+		return fmt.Errorf("ast: cannot encode %T", node)
+	}
+	v = v.Elem()
+	fmt.Fprintf(b, `{"kind":%q`, t.Name())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if t == hashType && field.Name == "Pairs" {
+			continue
+		}
+		if isZero(value) {
+			continue
+		}
+		fmt.Fprintf(b, ",%q:", fieldName(t, field.Name))
+		var err error
+		switch {
+		case t == hashType && field.Name == "Keys":
+			// the pairs in source order stand for both Pairs and Keys
+			err = encodePairs(b, node.(*HashLiteral))
+		default:
+			err = encodeValue(b, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b.WriteString("}")
+	return nil
+}
+
+func encodePairs(b *bytes.Buffer, hash *HashLiteral) error {
+	b.WriteString("[")
+	for i, key := range hash.Keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"key":`)
+		if err := encodeNode(b, key); err != nil {
+			return err
+		}
+		b.WriteString(`,"value":`)
+		if err := encodeNode(b, hash.Pairs[key]); err != nil {
+			return err
+		}
+		b.WriteString("}")
+	}
+	b.WriteString("]")
+	return nil
+}
+
+func encodeValue(b *bytes.Buffer, v reflect.Value) error {
+	switch {
+	case v.Type() == tokenType:
+		tok := v.Interface().(token.Token)
+		data, err := json.Marshal(jsonToken{Type: tok.Type, Literal: tok.Literal, Pos: toJSONPosition(tok.Pos), End: toJSONPosition(tok.End)})
+		b.Write(data)
+		return err
+	case v.Type() == positionType:
+		data, err := json.Marshal(toJSONPosition(v.Interface().(token.Position)))
+		b.Write(data)
+		return err
+	case v.Type().Implements(nodeType):
+		node, _ := v.Interface().(Node)
+		return encodeNode(b, node)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.String:
+		b.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			if err := encodeValue(b, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int64, reflect.Float64, reflect.Slice:
+		data, err := json.Marshal(v.Interface())
+		b.Write(data)
+		return err
+	}
+	return fmt.Errorf("ast: cannot encode a field of type %s", v.Type())
+}
+
+// DecodeJSON returns the tree encoded in data by EncodeJSON
+func DecodeJSON(data []byte) (Node, error) {
+	var tree jsonTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Version != JSONVersion {
+		return nil, fmt.Errorf("ast: unsupported JSON version %d, want %d", tree.Version, JSONVersion)
+	}
+	node, err := decodeNode(tree.Node)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func decodeNode(data json.RawMessage) (Node, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("ast: bad node: %s", err)
+	}
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+		return nil, fmt.Errorf("ast: node without a kind")
+	}
+	t, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("ast: unknown node kind %q", kind)
+	}
+	v := reflect.New(t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		data, ok := fields[fieldName(t, field.Name)]
+		if !ok || t == hashType && field.Name == "Pairs" {
+			continue
+		}
+		if t == hashType && field.Name == "Keys" {
+			if err := decodePairs(data, v.Interface().(*HashLiteral)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := decodeValue(data, v.Elem().Field(i)); err != nil {
+			return nil, fmt.Errorf("ast: %s.%s: %s", kind, field.Name, strings.TrimPrefix(err.Error(), "ast: "))
+		}
+	}
+	if hash, ok := v.Interface().(*HashLiteral); ok && hash.Pairs == nil {
+		hash.Pairs = map[Expression]Expression{}
+	}
+	return v.Interface().(Node), nil
+}
+
+func decodePairs(data json.RawMessage, hash *HashLiteral) error {
+	var pairs []jsonPair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return fmt.Errorf("ast: bad hash pairs: %s", err)
+	}
+	hash.Pairs = make(map[Expression]Expression, len(pairs))
+	for _, pair := range pairs {
+		var key, value Expression
+		if err := decodeValue(pair.Key, reflect.ValueOf(&key).Elem()); err != nil {
+			return err
+		}
+		if err := decodeValue(pair.Value, reflect.ValueOf(&value).Elem()); err != nil {
+			return err
+		}
+		hash.Keys = append(hash.Keys, key)
+		hash.Pairs[key] = value
+	}
+	return nil
+}
+
+// decodeValue sets v, a field of a node, to what data holds
+func decodeValue(data json.RawMessage, v reflect.Value) error {
+	switch {
+	case v.Type() == tokenType:
+		var tok jsonToken
+		if err := json.Unmarshal(data, &tok); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(token.Token{Type: tok.Type, Literal: tok.Literal, Pos: fromJSONPosition(tok.Pos), End: fromJSONPosition(tok.End)}))
+		return nil
+	case v.Type() == positionType:
+		var pos *jsonPosition
+		if err := json.Unmarshal(data, &pos); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(fromJSONPosition(pos)))
+		return nil
+	case v.Type().Implements(nodeType):
+		node, err := decodeNode(data)
+		if err != nil || node == nil {
+			return err
+		}
+		if !reflect.TypeOf(node).AssignableTo(v.Type()) {
+			want := v.Type()
+			if want.Kind() == reflect.Ptr {
+				want = want.Elem()
+			}
+			return fmt.Errorf("ast: %s cannot be used as %s", reflect.TypeOf(node).Elem().Name(), want.Name())
+		}
+		v.Set(reflect.ValueOf(node))
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.String:
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+		for i, item := range list {
+			if err := decodeValue(item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+func isNull(data json.RawMessage) bool {
+	return len(data) == 0 || string(bytes.TrimSpace(data)) == "null"
+}
+
+// isZero reports whether a field is left out of the encoding
+func isZero(v reflect.Value) bool {
+	if v.Type() == positionType {
+		return !v.Interface().(token.Position).IsValid()
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map:
+		return v.IsNil() || v.Kind() == reflect.Interface && isNil(v.Interface().(Node))
+	case reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// fieldName returns the name of a field of the node type t in the encoding, its Go name in lower camel case
+func fieldName(t reflect.Type, name string) string {
+	if t == hashType && name == "Keys" {
+		return "pairs"
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
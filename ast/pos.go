@@ -0,0 +1,246 @@
+package ast
+
+import "github.com/yzbmz5913/stang/token"
+
+// pos.go holds the Pos and End of every node. A node starts at its token unless a child comes first, as the left
+// operand of an infix expression, and it ends right after its closing token or else its last child. Nodes the
+// parser makes up, as the start of a[:2], have no position.
+
+func (p *Program) Pos() token.Position {
+	for _, stmt := range p.Statements {
+		if !isNil(stmt) && stmt.Pos().IsValid() {
+			return stmt.Pos()
+		}
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	for i := len(p.Statements) - 1; i >= 0; i-- {
+		if stmt := p.Statements[i]; !isNil(stmt) && stmt.End().IsValid() {
+			return stmt.End()
+		}
+	}
+	return token.Position{}
+}
+
+func (n *NullExpression) Pos() token.Position { return n.Token.Pos }
+func (n *NullExpression) End() token.Position { return n.Token.End }
+
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position { return last(ls.Token, ls.Name, ls.Value) }
+
+func (d *DeleteStatement) Pos() token.Position { return d.Token.Pos }
+func (d *DeleteStatement) End() token.Position { return last(d.Token, d.Value) }
+
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
+
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position { return last(rs.Token, rs.ReturnValue) }
+
+func (es *ExpressionStatement) Pos() token.Position { return first(es.Token, es.Expression) }
+func (es *ExpressionStatement) End() token.Position { return last(es.Token, es.Expression) }
+
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
+
+func (b *BooleanLiteral) Pos() token.Position { return b.Token.Pos }
+func (b *BooleanLiteral) End() token.Position { return b.Token.End }
+
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position { return last(pe.Token, pe.Right) }
+
+func (ie *InfixExpression) Pos() token.Position { return first(ie.Token, ie.Left) }
+func (ie *InfixExpression) End() token.Position { return last(ie.Token, ie.Right) }
+
+func (pe *PostfixExpression) Pos() token.Position { return first(pe.Token, pe.Left) }
+func (pe *PostfixExpression) End() token.Position { return pe.Token.End }
+
+func (i *IfExpression) Pos() token.Position { return i.Token.Pos }
+func (i *IfExpression) End() token.Position {
+	return last(i.Token, i.Condition, i.Consequence, i.Alternative)
+}
+
+func (b *BlockStatement) Pos() token.Position { return b.Token.Pos }
+func (b *BlockStatement) End() token.Position {
+	if b.Rbrace.IsValid() {
+		return after(b.Rbrace)
+	}
+	return last(b.Token, statements(b.Statements)...)
+}
+
+func (f *FunctionLiteral) Pos() token.Position { return f.Token.Pos }
+func (f *FunctionLiteral) End() token.Position { return last(f.Token, f.Body) }
+
+func (c *CallExpression) Pos() token.Position { return first(c.Token, c.Function) }
+func (c *CallExpression) End() token.Position {
+	if c.Rparen.IsValid() {
+		return after(c.Rparen)
+	}
+	return last(c.Token, expressions(c.Arguments)...)
+}
+
+func (w *WhileExpression) Pos() token.Position { return w.Token.Pos }
+func (w *WhileExpression) End() token.Position { return last(w.Token, w.Condition, w.Body) }
+
+func (b *BreakExpression) Pos() token.Position { return b.Token.Pos }
+func (b *BreakExpression) End() token.Position { return b.Token.End }
+
+func (c *ContinueExpression) Pos() token.Position { return c.Token.Pos }
+func (c *ContinueExpression) End() token.Position { return c.Token.End }
+
+func (t *TypeofExpression) Pos() token.Position { return t.Token.Pos }
+func (t *TypeofExpression) End() token.Position { return last(t.Token, t.Expr) }
+
+func (a *AssignExpression) Pos() token.Position { return first(a.Token, a.Name) }
+func (a *AssignExpression) End() token.Position { return last(a.Token, a.Name, a.Value) }
+
+func (ie *IndexExpression) Pos() token.Position { return first(ie.Token, ie.Left) }
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.IsValid() {
+		return after(ie.Rbracket)
+	}
+	return last(ie.Token, ie.Left, ie.Index)
+}
+
+func (f *ForExpression) Pos() token.Position { return f.Token.Pos }
+func (f *ForExpression) End() token.Position {
+	return last(f.Token, f.Init, f.Condition, f.Update, f.Body)
+}
+
+func (s *StringLiteral) Pos() token.Position { return s.Token.Pos }
+func (s *StringLiteral) End() token.Position { return s.Token.End }
+
+func (a *ArrayLiteral) Pos() token.Position { return a.Token.Pos }
+func (a *ArrayLiteral) End() token.Position {
+	if a.Rbracket.IsValid() {
+		return after(a.Rbracket)
+	}
+	return last(a.Token, expressions(a.Elements)...)
+}
+
+func (m *MethodCallExpression) Pos() token.Position { return first(m.Token, m.Object) }
+func (m *MethodCallExpression) End() token.Position { return last(m.Token, m.Object, m.Call) }
+
+func (s *SliceExpression) Pos() token.Position { return first(s.Token, s.Start) }
+func (s *SliceExpression) End() token.Position { return last(s.Token, s.Stop) }
+
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.IsValid() {
+		return after(hl.Rbrace)
+	}
+	var nodes []Node
+	for _, key := range hl.Keys {
+		nodes = append(nodes, key, hl.Pairs[key])
+	}
+	return last(hl.Token, nodes...)
+}
+
+func (t *TemplateLiteral) Pos() token.Position { return t.Token.Pos }
+func (t *TemplateLiteral) End() token.Position { return t.Token.End }
+
+func (t *TaggedTemplateExpression) Pos() token.Position { return first(t.Token, t.Tag) }
+func (t *TaggedTemplateExpression) End() token.Position { return last(t.Token, t.Template) }
+
+func (y *YieldExpression) Pos() token.Position { return y.Token.Pos }
+func (y *YieldExpression) End() token.Position { return last(y.Token, y.Value) }
+
+func (f *ForOfExpression) Pos() token.Position { return f.Token.Pos }
+func (f *ForOfExpression) End() token.Position {
+	return last(f.Token, f.Name, f.Iterable, f.Body)
+}
+
+func (sp *SpawnExpression) Pos() token.Position { return sp.Token.Pos }
+func (sp *SpawnExpression) End() token.Position { return last(sp.Token, sp.Call) }
+
+func (se *SelectExpression) Pos() token.Position { return se.Token.Pos }
+func (se *SelectExpression) End() token.Position {
+	if se.Rbrace.IsValid() {
+		return after(se.Rbrace)
+	}
+	nodes := make([]Node, len(se.Cases))
+	for i, c := range se.Cases {
+		nodes[i] = c
+	}
+	return last(se.Token, nodes...)
+}
+
+func (sc *SelectCase) Pos() token.Position { return sc.Token.Pos }
+func (sc *SelectCase) End() token.Position {
+	return last(sc.Token, sc.Name, sc.Channel, sc.Send, sc.Body)
+}
+
+func (ap *ArrayPattern) Pos() token.Position { return ap.Token.Pos }
+func (ap *ArrayPattern) End() token.Position {
+	if ap.Rbracket.IsValid() {
+		return after(ap.Rbracket)
+	}
+	return last(ap.Token, append(expressions(ap.Elements), ap.Rest)...)
+}
+
+func (hp *HashPattern) Pos() token.Position { return hp.Token.Pos }
+func (hp *HashPattern) End() token.Position {
+	if hp.Rbrace.IsValid() {
+		return after(hp.Rbrace)
+	}
+	nodes := make([]Node, 0, len(hp.Properties)+1)
+	for _, p := range hp.Properties {
+		nodes = append(nodes, p)
+	}
+	return last(hp.Token, append(nodes, hp.Rest)...)
+}
+
+func (pp *PatternProperty) Pos() token.Position { return first(token.Token{}, pp.Key) }
+func (pp *PatternProperty) End() token.Position { return last(token.Token{}, pp.Key, pp.Value) }
+
+func (se *SpreadExpression) Pos() token.Position { return se.Token.Pos }
+func (se *SpreadExpression) End() token.Position { return last(se.Token, se.Value) }
+
+// first returns where n starts if it has a position, where tok does otherwise
+func first(tok token.Token, n Node) token.Position {
+	if !isNil(n) {
+		if pos := n.Pos(); pos.IsValid() {
+			return pos
+		}
+	}
+	return tok.Pos
+}
+
+// last returns where the last of nodes with a position ends, where tok does if there is none
+func last(tok token.Token, nodes ...Node) token.Position {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if !isNil(nodes[i]) {
+			if end := nodes[i].End(); end.IsValid() {
+				return end
+			}
+		}
+	}
+	return tok.End
+}
+
+// after returns the position right after the single character at pos
+func after(pos token.Position) token.Position {
+	pos.Offset++
+	pos.Col++
+	return pos
+}
+
+func statements(list []Statement) []Node {
+	nodes := make([]Node, len(list))
+	for i, stmt := range list {
+		nodes[i] = stmt
+	}
+	return nodes
+}
+
+func expressions(list []Expression) []Node {
+	nodes := make([]Node, len(list))
+	for i, e := range list {
+		nodes[i] = e
+	}
+	return nodes
+}
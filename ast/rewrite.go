@@ -0,0 +1,238 @@
+package ast
+
+import "fmt"
+
+// Rewrite replaces the nodes under node and node itself with what f returns for them and returns the new node.
+// The tree is rewritten bottom up: f is called with a node once its children have been rewritten, returning the
+// node keeps it. Nodes are changed in place, Clone the tree first to keep the original.
+//
+// A node must be replaced by one that fits where it is: an expression by an expression, a statement by a statement,
+// a block by a block, an identifier by an identifier and so on, Rewrite panics otherwise. A nil result removes
+// a statement, a select case, a pattern property or a hash pair, by its key, from its list and clears any other
+// field.
+func Rewrite(node Node, f func(Node) Node) Node {
+	if isNil(node) {
+		return node
+	}
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *BlockStatement:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *LetStatement:
+		n.Name = rewriteExpression(n.Name, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *DeleteStatement:
+		n.Value = rewriteExpression(n.Value, f)
+	case *ReturnStatement:
+		n.ReturnValue = rewriteExpression(n.ReturnValue, f)
+	case *ExpressionStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+	case *PrefixExpression:
+		n.Right = rewriteExpression(n.Right, f)
+	case *InfixExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Right = rewriteExpression(n.Right, f)
+	case *PostfixExpression:
+		n.Left = rewriteExpression(n.Left, f)
+	case *IfExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Consequence = rewriteBlock(n.Consequence, f)
+		n.Alternative = rewriteBlock(n.Alternative, f)
+	case *FunctionLiteral:
+		rewriteExpressions(n.Parameters, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *CallExpression:
+		n.Function = rewriteExpression(n.Function, f)
+		rewriteExpressions(n.Arguments, f)
+	case *WhileExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *TypeofExpression:
+		n.Expr = rewriteExpression(n.Expr, f)
+	case *AssignExpression:
+		n.Name = rewriteExpression(n.Name, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *IndexExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Index = rewriteExpression(n.Index, f)
+	case *ForExpression:
+		n.Init = rewriteNode(n.Init, f)
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Update = rewriteExpression(n.Update, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *ArrayLiteral:
+		rewriteExpressions(n.Elements, f)
+	case *MethodCallExpression:
+		n.Object = rewriteExpression(n.Object, f)
+		n.Call = rewriteExpression(n.Call, f)
+	case *SliceExpression:
+		n.Start = rewriteExpression(n.Start, f)
+		n.Stop = rewriteExpression(n.Stop, f)
+	case *HashLiteral:
+		// a pair goes with its key
+		pairs := make(map[Expression]Expression, len(n.Pairs))
+		keys := n.Keys[:0]
+		for _, key := range n.Keys {
+			value := n.Pairs[key]
+			if key = rewriteExpression(key, f); key != nil {
+				keys = append(keys, key)
+				pairs[key] = rewriteExpression(value, f)
+			}
+		}
+		n.Keys, n.Pairs = keys, pairs
+	case *TemplateLiteral:
+		rewriteExpressions(n.Expressions, f)
+	case *TaggedTemplateExpression:
+		n.Tag = rewriteExpression(n.Tag, f)
+		n.Template = rewriteTemplate(n.Template, f)
+	case *YieldExpression:
+		n.Value = rewriteExpression(n.Value, f)
+	case *ForOfExpression:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Iterable = rewriteExpression(n.Iterable, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *SpawnExpression:
+		n.Call = rewriteCall(n.Call, f)
+	case *SelectExpression:
+		cases := n.Cases[:0]
+		for _, c := range n.Cases {
+			replaced := rewriteNode(c, f)
+			if replaced == nil {
+				continue
+			}
+			sc, ok := replaced.(*SelectCase)
+			if !ok {
+				panic(misfit(replaced, "a select case"))
+			}
+			cases = append(cases, sc)
+		}
+		n.Cases = cases
+	case *SelectCase:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Channel = rewriteExpression(n.Channel, f)
+		n.Send = rewriteExpression(n.Send, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *ArrayPattern:
+		rewriteExpressions(n.Elements, f)
+		n.Rest = rewriteExpression(n.Rest, f)
+	case *HashPattern:
+		properties := n.Properties[:0]
+		for _, p := range n.Properties {
+			replaced := rewriteNode(p, f)
+			if replaced == nil {
+				continue
+			}
+			pp, ok := replaced.(*PatternProperty)
+			if !ok {
+				panic(misfit(replaced, "a pattern property"))
+			}
+			properties = append(properties, pp)
+		}
+		n.Properties = properties
+		n.Rest = rewriteExpression(n.Rest, f)
+	case *PatternProperty:
+		n.Key = rewriteExpression(n.Key, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *SpreadExpression:
+		n.Value = rewriteExpression(n.Value, f)
+	}
+	return f(node)
+}
+
+// rewriteNode rewrites a child, nil if it is or becomes nil
+func rewriteNode(node Node, f func(Node) Node) Node {
+	if isNil(node) {
+		return nil
+	}
+	if replaced := Rewrite(node, f); !isNil(replaced) {
+		return replaced
+	}
+	return nil
+}
+
+func misfit(node Node, kind string) string {
+	return fmt.Sprintf("ast.Rewrite: %T cannot replace %s", node, kind)
+}
+
+func rewriteStatements(list []Statement, f func(Node) Node) []Statement {
+	kept := list[:0]
+	for _, stmt := range list {
+		replaced := rewriteNode(stmt, f)
+		if replaced == nil {
+			continue
+		}
+		s, ok := replaced.(Statement)
+		if !ok {
+			panic(misfit(replaced, "a statement"))
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+func rewriteExpressions(list []Expression, f func(Node) Node) {
+	for i, e := range list {
+		list[i] = rewriteExpression(e, f)
+	}
+}
+
+func rewriteExpression(e Expression, f func(Node) Node) Expression {
+	replaced := rewriteNode(e, f)
+	if replaced == nil {
+		return nil
+	}
+	expr, ok := replaced.(Expression)
+	if !ok {
+		panic(misfit(replaced, "an expression"))
+	}
+	return expr
+}
+
+func rewriteBlock(b *BlockStatement, f func(Node) Node) *BlockStatement {
+	replaced := rewriteNode(b, f)
+	if replaced == nil {
+		return nil
+	}
+	block, ok := replaced.(*BlockStatement)
+	if !ok {
+		panic(misfit(replaced, "a block"))
+	}
+	return block
+}
+
+func rewriteIdentifier(id *Identifier, f func(Node) Node) *Identifier {
+	replaced := rewriteNode(id, f)
+	if replaced == nil {
+		return nil
+	}
+	ident, ok := replaced.(*Identifier)
+	if !ok {
+		panic(misfit(replaced, "an identifier"))
+	}
+	return ident
+}
+
+func rewriteCall(call *CallExpression, f func(Node) Node) *CallExpression {
+	replaced := rewriteNode(call, f)
+	if replaced == nil {
+		return nil
+	}
+	c, ok := replaced.(*CallExpression)
+	if !ok {
+		panic(misfit(replaced, "a call"))
+	}
+	return c
+}
+
+func rewriteTemplate(t *TemplateLiteral, f func(Node) Node) *TemplateLiteral {
+	replaced := rewriteNode(t, f)
+	if replaced == nil {
+		return nil
+	}
+	template, ok := replaced.(*TemplateLiteral)
+	if !ok {
+		panic(misfit(replaced, "a template literal"))
+	}
+	return template
+}
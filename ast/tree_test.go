@@ -0,0 +1,443 @@
+package ast_test
+
+import (
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// everything holds a node of every type
+const everything = "let f = function(a, b) { return a + b }\n" +
+	"let h = {\"k\": [1, 2.5, true, null], x: f(1, 2)}\n" +
+	"delete h[\"k\"]\n" +
+	"let arr = [1, 2, 3]\n" +
+	"arr[1:2]\n" +
+	"arr.push(-1)\n" +
+	"let i = 0\n" +
+	"i++\n" +
+	"i += 1\n" +
+	"while (i < 10) { if (i == 5) { break } else { continue } }\n" +
+	"for (let j = 0; j < 2; j++) { typeof j }\n" +
+	"for (let x of arr) { x }\n" +
+	"let g = function() { yield 1 }\n" +
+	"let t = `a${i}b`\n" +
+	"f`x${1}y`\n" +
+	"let task = spawn f(1, 2)\n" +
+	"let c = channel(1)\n" +
+	"let [p, q = 1, ...r] = arr\n" +
+	"let {k, y: z = 2, ...w} = h;\n" +
+	"[p, q] = [q, p]\n" +
+	"let m = function([a], {b}) { a + b }\n" +
+	"m(...[arr, {...h, z: 1}])\n" +
+	"select { case let v = c.recv() { v } case c.send(1) { 0 } default { 1 } }\n"
+
+var nodeTypes = []ast.Node{
+	&ast.Program{}, &ast.LetStatement{}, &ast.DeleteStatement{}, &ast.ReturnStatement{}, &ast.ExpressionStatement{},
+	&ast.BlockStatement{}, &ast.Identifier{}, &ast.NullExpression{}, &ast.IntegerLiteral{}, &ast.FloatLiteral{},
+	&ast.BooleanLiteral{}, &ast.StringLiteral{}, &ast.PrefixExpression{}, &ast.InfixExpression{},
+	&ast.PostfixExpression{}, &ast.IfExpression{}, &ast.FunctionLiteral{}, &ast.CallExpression{},
+	&ast.WhileExpression{}, &ast.BreakExpression{}, &ast.ContinueExpression{}, &ast.TypeofExpression{},
+	&ast.AssignExpression{}, &ast.IndexExpression{}, &ast.ForExpression{}, &ast.ArrayLiteral{},
+	&ast.MethodCallExpression{}, &ast.SliceExpression{}, &ast.HashLiteral{}, &ast.TemplateLiteral{},
+	&ast.TaggedTemplateExpression{}, &ast.YieldExpression{}, &ast.ForOfExpression{}, &ast.SpawnExpression{},
+	&ast.SelectExpression{}, &ast.SelectCase{}, &ast.ArrayPattern{}, &ast.HashPattern{}, &ast.PatternProperty{},
+	&ast.SpreadExpression{},
+}
+
+func parse(t *testing.T, src string) *ast.Program {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q does not parse: %v", src, p.Errors())
+	}
+	return program
+}
+
+// reachable finds the nodes under node by reflection, the way Walk should without knowing the node types
+func reachable(node ast.Node) map[ast.Node]bool {
+	found := map[ast.Node]bool{}
+	var visit func(v reflect.Value)
+	visit = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface:
+			if !v.IsNil() {
+				visit(v.Elem())
+			}
+		case reflect.Ptr:
+			if v.IsNil() {
+				return
+			}
+			if n, ok := v.Interface().(ast.Node); ok {
+				if found[n] {
+					return
+				}
+				found[n] = true
+			}
+			visit(v.Elem())
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				visit(v.Field(i))
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				visit(v.Index(i))
+			}
+		case reflect.Map:
+			iter := v.MapRange()
+			for iter.Next() {
+				visit(iter.Key())
+				visit(iter.Value())
+			}
+		}
+	}
+	visit(reflect.ValueOf(node))
+	return found
+}
+
+func inspected(node ast.Node) []ast.Node {
+	var nodes []ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+func typeNames(nodes []ast.Node) string {
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+	}
+	return strings.Join(names, " ")
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, everything)
+	nodes := inspected(program)
+	seen := map[ast.Node]bool{}
+	types := map[reflect.Type]bool{}
+	for _, n := range nodes {
+		if seen[n] {
+			t.Errorf("%T %s visited twice", n, n.String())
+		}
+		seen[n] = true
+		types[reflect.TypeOf(n)] = true
+	}
+	for _, n := range nodeTypes {
+		if !types[reflect.TypeOf(n)] {
+			t.Errorf("no %T visited", n)
+		}
+	}
+	for n := range reachable(program) {
+		if !seen[n] {
+			t.Errorf("%T %s not visited", n, n.String())
+		}
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:2]", "Program ExpressionStatement IndexExpression Identifier SliceExpression IntegerLiteral IntegerLiteral"},
+		{"a[:]", "Program ExpressionStatement IndexExpression Identifier SliceExpression IntegerLiteral"},
+		{"a.b(c)", "Program ExpressionStatement MethodCallExpression Identifier CallExpression Identifier Identifier"},
+		{"{b: 1, 'a': x}", "Program ExpressionStatement HashLiteral Identifier IntegerLiteral StringLiteral Identifier"},
+		{"if (a) { b } else { c }", "Program ExpressionStatement IfExpression Identifier BlockStatement ExpressionStatement Identifier BlockStatement ExpressionStatement Identifier"},
+		{"for (let i = 0; i; i++) {}", "Program ExpressionStatement ForExpression LetStatement Identifier IntegerLiteral Identifier PostfixExpression Identifier BlockStatement"},
+		{"function(a, b) {}", "Program ExpressionStatement FunctionLiteral Identifier Identifier BlockStatement"},
+	}
+	for _, tt := range tests {
+		if got := typeNames(inspected(parse(t, tt.input))); got != tt.expected {
+			t.Errorf("%q: wrong order. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// counter counts the nodes it visits and the ends of their children, it skips blocks
+type counter struct {
+	nodes, ends int
+}
+
+func (c *counter) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		c.ends++
+		return nil
+	}
+	c.nodes++
+	if _, ok := node.(*ast.BlockStatement); ok {
+		return nil
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	c := &counter{}
+	ast.Walk(c, parse(t, "let f = function(a) { return a }\nf(1)"))
+	// Program Let Identifier Function Identifier Block ExpressionStatement Call Identifier Integer, the block is skipped
+	if c.nodes != 10 || c.ends != 9 {
+		t.Errorf("wrong counts. got nodes=%d ends=%d", c.nodes, c.ends)
+	}
+	ast.Walk(c, nil)
+	ast.Walk(c, (*ast.BlockStatement)(nil))
+	if c.nodes != 10 {
+		t.Errorf("nil nodes should not be visited")
+	}
+}
+
+func TestClone(t *testing.T) {
+	program := parse(t, everything)
+	clone := ast.Clone(program).(*ast.Program)
+	if clone.String() != program.String() {
+		t.Errorf("the clone differs. got=%q, want=%q", clone.String(), program.String())
+	}
+	original := inspected(program)
+	copied := inspected(clone)
+	if typeNames(copied) != typeNames(original) {
+		t.Errorf("the clone has other nodes. got=%q, want=%q", typeNames(copied), typeNames(original))
+	}
+	for i := range original {
+		if i < len(copied) && !reflect.DeepEqual(tokenOf(original[i]), tokenOf(copied[i])) {
+			t.Errorf("%T: wrong token %v", copied[i], tokenOf(copied[i]))
+		}
+		if i < len(copied) && (copied[i].Pos() != original[i].Pos() || copied[i].End() != original[i].End()) {
+			t.Errorf("%T: wrong span %s", copied[i], token.Span(copied[i].Pos(), copied[i].End()))
+		}
+	}
+	originals := reachable(program)
+	for n := range reachable(clone) {
+		if originals[n] {
+			t.Errorf("%T %s is shared", n, n.String())
+		}
+	}
+	// changing the clone leaves the original alone
+	ast.Rewrite(clone, func(n ast.Node) ast.Node {
+		if id, ok := n.(*ast.Identifier); ok {
+			id.Value = "_" + id.Value
+		}
+		return n
+	})
+	if program.String() != parse(t, everything).String() {
+		t.Errorf("the original changed with its clone")
+	}
+	if ast.Clone(nil) != nil {
+		t.Errorf("the clone of nil should be nil")
+	}
+}
+
+func tokenOf(n ast.Node) interface{} {
+	if field := reflect.ValueOf(n).Elem().FieldByName("Token"); field.IsValid() {
+		return field.Interface()
+	}
+	return nil
+}
+
+func TestRewrite(t *testing.T) {
+	// fold adds integer literals
+	fold := func(n ast.Node) ast.Node {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || infix.Operator != "+" {
+			return n
+		}
+		left, ok1 := infix.Left.(*ast.IntegerLiteral)
+		right, ok2 := infix.Right.(*ast.IntegerLiteral)
+		if !ok1 || !ok2 {
+			return n
+		}
+		value := left.Value + right.Value
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Pos: left.Token.Pos}, Value: value}
+	}
+	rename := func(n ast.Node) ast.Node {
+		if id, ok := n.(*ast.Identifier); ok && id.Value == "a" {
+			return &ast.Identifier{Token: id.Token, Value: "z"}
+		}
+		return n
+	}
+	dropLets := func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.LetStatement); ok {
+			return nil
+		}
+		return n
+	}
+	dropDefaults := func(n ast.Node) ast.Node {
+		if c, ok := n.(*ast.SelectCase); ok && c.Channel == nil {
+			return nil
+		}
+		return n
+	}
+	dropKeys := func(n ast.Node) ast.Node {
+		if s, ok := n.(*ast.StringLiteral); ok && s.Value == "drop" {
+			return nil
+		}
+		return n
+	}
+	tests := []struct {
+		input    string
+		f        func(ast.Node) ast.Node
+		expected string
+	}{
+		{"1 + 2 + 3", fold, "6"},
+		{"f(1 + 2, [a + 1 + 1])", fold, "f(3, [((a + 1) + 1)])"},
+		{"a[1 + 1:2 + 2]", fold, "(a[(2:4)])"},
+		{"let a = function(a) { a.b(a) }", rename, "let z = function(z)z.b(z); "},
+		{"{a: a}", rename, "{z:z}"},
+		{"for (a of a) { a }", rename, "for ( let z of z )  { z;  }"},
+		{"let a = 1; a; if (a) { let b = 2 }", dropLets, "a; ifa "},
+		{"select { case c.send(1) { 0 } default { 1 } }", dropDefaults, "select { case c.send(1) { 0;  } }"},
+		{"{'drop': 1, 'keep': 2}", dropKeys, "{keep:2}"},
+	}
+	for _, tt := range tests {
+		program := ast.Rewrite(parse(t, tt.input), tt.f)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong rewrite. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil || r != "ast.Rewrite: *ast.IntegerLiteral cannot replace an identifier" {
+			t.Errorf("a node that does not fit should panic. got=%v", r)
+		}
+	}()
+	ast.Rewrite(parse(t, "for (let a of xs) { }"), func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.Identifier); ok {
+			return &ast.IntegerLiteral{Value: 1}
+		}
+		return n
+	})
+}
+
+func TestJSON(t *testing.T) {
+	tests := []string{
+		everything,
+		"{z: 1, y: 2, x: {'b': [], 'a': {}}}",
+		"let f = function() {}; f()",
+		"for (;;) { break }",
+		"if (true) { 1 } else { 'two' }; 9223372036854775807; 0.1",
+	}
+	for _, input := range tests {
+		program := parse(t, input)
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		decoded, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		if decoded.String() != program.String() {
+			t.Errorf("%q: wrong tree. got=%q, want=%q", input, decoded.String(), program.String())
+		}
+		original, got := inspected(program), inspected(decoded)
+		if typeNames(got) != typeNames(original) {
+			t.Errorf("%q: wrong nodes. got=%q, want=%q", input, typeNames(got), typeNames(original))
+			continue
+		}
+		for i := range original {
+			if !reflect.DeepEqual(tokenOf(original[i]), tokenOf(got[i])) {
+				t.Errorf("%q: %T: wrong token %v, want %v", input, got[i], tokenOf(got[i]), tokenOf(original[i]))
+			}
+			if got[i].Pos() != original[i].Pos() || got[i].End() != original[i].End() {
+				t.Errorf("%q: %T: wrong span %s, want %s", input, got[i], token.Span(got[i].Pos(), got[i].End()), token.Span(original[i].Pos(), original[i].End()))
+			}
+		}
+		again, _ := ast.EncodeJSON(decoded)
+		if string(again) != string(data) {
+			t.Errorf("%q: the encoding should not change. got=\n%s\nwant=\n%s", input, again, data)
+		}
+	}
+
+	data, _ := ast.EncodeJSON(parse(t, "{z: 1, y: 2}"))
+	if z, y := strings.Index(string(data), `"literal":"z"`), strings.Index(string(data), `"literal":"y"`); z < 0 || y < z {
+		t.Errorf("the pairs of a hash should be in source order. got=%s", data)
+	}
+	if !strings.HasPrefix(string(data), `{"version":2,"node":{"kind":"Program","statements":[{"kind":"ExpressionStatement"`) {
+		t.Errorf("wrong encoding %s", data)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"version":1,"node":null}`, "ast: unsupported JSON version 1, want 2"},
+		{`{"version":2,"node":{"kind":"Nope"}}`, `ast: unknown node kind "Nope"`},
+		{`{"version":2,"node":{"statements":[]}}`, "ast: node without a kind"},
+		{`{"version":2,"node":{"kind":"Program","statements":[{"kind":"Identifier"}]}}`, "ast: Program.Statements: Identifier cannot be used as Statement"},
+		{`{"version":2,"node":{"kind":"LetStatement","name":{"kind":"IntegerLiteral","value":"x"}}}`, "ast: LetStatement.Name: IntegerLiteral.Value: json: cannot unmarshal string into Go value of type int64"},
+		{`{"version":2,"node":{"kind":"ForOfExpression","name":{"kind":"IntegerLiteral"}}}`, "ast: ForOfExpression.Name: IntegerLiteral cannot be used as Identifier"},
+		{`[]`, "json: cannot unmarshal array into Go value of type ast.jsonTree"},
+	}
+	for _, tt := range tests {
+		if _, err := ast.DecodeJSON([]byte(tt.input)); err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the source of each node in the order of Inspect
+	}{
+		{"a + b * 2", "a + b * 2|a + b * 2|a + b * 2|a|b * 2|b|2"},
+		{"f(1, x)[0]", "f(1, x)[0]|f(1, x)[0]|f(1, x)[0]|f(1, x)|f|1|x|0"},
+		{"arr[:2]", "arr[:2]|arr[:2]|arr[:2]|arr|:2||2"},
+		{"o.m(1)", "o.m(1)|o.m(1)|o.m(1)|o|m(1)|m|1"},
+		{"i++; let s = `${i}!`", "i++; let s = `${i}!`|i++|i++|i|;|let s = `${i}!`|s|`${i}!`|i"},
+		{"{'a': [1]}", "{'a': [1]}|{'a': [1]}|{'a': [1]}|'a'|[1]|1"},
+		{"if (x) {\n  1\n} else { 2 }", "if (x) {\n  1\n} else { 2 }|if (x) {\n  1\n} else { 2 }|if (x) {\n  1\n} else { 2 }|x|{\n  1\n}|1|1|{ 2 }|2|2"},
+		{"select { default { } }", "select { default { } }|select { default { } }|select { default { } }|default { }|{ }"},
+		{"return;", "return|return"},
+		{"let [a = 1, ...r] = x", "let [a = 1, ...r] = x|let [a = 1, ...r] = x|[a = 1, ...r]|a = 1|a|1|r|x"},
+		{"[...a, 1]", "[...a, 1]|[...a, 1]|[...a, 1]|...a|a|1"},
+		{"let {a, 'b': c} = x", "let {a, 'b': c} = x|let {a, 'b': c} = x|{a, 'b': c}|a|a|a|'b': c|'b'|c|x"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		var got []string
+		for _, n := range inspected(program) {
+			if !n.Pos().IsValid() {
+				got = append(got, "")
+				continue
+			}
+			got = append(got, tt.input[n.Pos().Offset:n.End().Offset])
+		}
+		if strings.Join(got, "|") != tt.expected {
+			t.Errorf("%q: wrong spans. got=%q, want=%q", tt.input, strings.Join(got, "|"), tt.expected)
+		}
+	}
+
+	// every node of a named file knows where it is
+	fset := token.NewFileSet()
+	f := fset.AddFile("all.stg", everything)
+	p := parser.New(lexer.NewFile(f))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatal(p.Errors())
+	}
+	for _, n := range inspected(program) {
+		pos, end := n.Pos(), n.End()
+		if lit, ok := n.(*ast.IntegerLiteral); ok && !pos.IsValid() && lit.Value == 0 {
+			continue
+		}
+		if pos.Filename != "all.stg" || end.Filename != "all.stg" || end.Offset <= pos.Offset {
+			t.Errorf("%T %s: wrong span %s", n, n.String(), token.Span(pos, end))
+		}
+		if f.Position(pos.Offset) != pos || f.Position(end.Offset) != end {
+			t.Errorf("%T %s: the span %s does not agree with the file", n, n.String(), token.Span(pos, end))
+		}
+	}
+	if span := token.Span(program.Pos(), program.End()); span != "all.stg:1:1-23:73" {
+		t.Errorf("wrong span of the program %s", span)
+	}
+}
@@ -0,0 +1,155 @@
+package ast
+
+import "reflect"
+
+// Visitor visits the nodes Walk finds, if the visitor w returned by Visit is not nil, Walk visits the children of
+// node with w and then calls w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk visits node and then, depth first and in source order, each of its children that is not nil.
+// The keys of hash literals are visited in source order, each followed by its value.
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+	case *DeleteStatement:
+		Walk(v, n.Value)
+	case *ReturnStatement:
+		Walk(v, n.ReturnValue)
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *PostfixExpression:
+		Walk(v, n.Left)
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		Walk(v, n.Alternative)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *WhileExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Body)
+	case *TypeofExpression:
+		Walk(v, n.Expr)
+	case *AssignExpression:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+	case *ForExpression:
+		Walk(v, n.Init)
+		Walk(v, n.Condition)
+		Walk(v, n.Update)
+		Walk(v, n.Body)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *MethodCallExpression:
+		Walk(v, n.Object)
+		Walk(v, n.Call)
+	case *SliceExpression:
+		Walk(v, n.Start)
+		Walk(v, n.Stop)
+	case *HashLiteral:
+		for _, key := range n.Keys {
+			Walk(v, key)
+			Walk(v, n.Pairs[key])
+		}
+	case *TemplateLiteral:
+		walkExpressions(v, n.Expressions)
+	case *TaggedTemplateExpression:
+		Walk(v, n.Tag)
+		Walk(v, n.Template)
+	case *YieldExpression:
+		Walk(v, n.Value)
+	case *ForOfExpression:
+		Walk(v, n.Name)
+		Walk(v, n.Iterable)
+		Walk(v, n.Body)
+	case *SpawnExpression:
+		Walk(v, n.Call)
+	case *SelectExpression:
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+	case *SelectCase:
+		Walk(v, n.Name)
+		Walk(v, n.Channel)
+		Walk(v, n.Send)
+		Walk(v, n.Body)
+	case *ArrayPattern:
+		walkExpressions(v, n.Elements)
+		Walk(v, n.Rest)
+	case *HashPattern:
+		for _, p := range n.Properties {
+			Walk(v, p)
+		}
+		Walk(v, n.Rest)
+	case *PatternProperty:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+	case *SpreadExpression:
+		Walk(v, n.Value)
+	}
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, stmt := range list {
+		Walk(v, stmt)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		Walk(v, e)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect walks node like Walk, calling f with each node and then with nil after its children.
+// The children of a node are skipped when f returns false for it.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// isNil reports whether n is nil or a nil pointer, like a missing else block
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
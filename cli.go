@@ -0,0 +1,385 @@
+package stang
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/coverage"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/optimize"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/profiler"
+	"github.com/yzbmz5913/stang/token"
+	"github.com/yzbmz5913/stang/vfs"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// cli.go implements the stang command, cmd/stang only hands it the process arguments
+
+// exit codes of the stang command
+const (
+	ExitOK           = 0
+	ExitRuntimeError = 1 // the program failed or timed out, stang lint found problems or a test failed
+	ExitUsage        = 2 // bad flags or unreadable files
+	ExitSyntaxError  = 3 // the program does not parse
+)
+
+const usage = `usage:
+  stang                            start the REPL, or run the program on stdin when it is not a terminal
+  stang [run] [flags] file... [-- args...]
+                                   run files one after another in one scope, - reads stdin,
+                                   --profile writes where the time went for go tool pprof,
+                                   --cover shows which statements and branches ran
+  stang [run] [flags] -e code [args...]
+                                   run code
+  stang fmt [-w] [-d] [file...]    format source code, see stang fmt -h
+  stang lint [file...]             report likely mistakes, see stang lint -h
+  stang lsp                        start a language server on stdin and stdout
+  stang test [flags] [path...]     run the tests in *_test.stg files, see stang test -h
+  stang debug [flags] file [args...]
+                                   run a file under a debugger, see stang debug -h
+  stang cover [flags] profile...   merge coverage profiles, see stang cover -h
+flags:
+`
+
+// Main runs the stang command with the arguments following the program name and returns its exit code
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			return runCommand(args[1:], stdin, stdout, stderr)
+		case "fmt":
+			return fmtCommand(args[1:], stdin, stdout, stderr)
+		case "lint":
+			return lintCommand(args[1:], stdin, stdout, stderr)
+		case "lsp":
+			return lspCommand(args[1:], stdin, stdout, stderr)
+		case "test":
+			return testCommand(args[1:], stdout, stderr)
+		case "debug":
+			return debugCommand(args[1:], stdin, stdout, stderr)
+		case "cover":
+			return coverCommand(args[1:], stdout, stderr)
+		case "help", "-h", "-help", "--help":
+			printUsage(stdout, newRunFlags(stdout))
+			return ExitOK
+		}
+	}
+	return runCommand(args, stdin, stdout, stderr)
+}
+
+type runFlags struct {
+	*flag.FlagSet
+	eval       string
+	timeout    time.Duration
+	root       string
+	writable   bool
+	dumpTokens bool
+	dumpAST    bool
+	dumpJSON   bool
+	optimize   bool
+	profile    string
+	report     bool
+	cover      bool
+	coverLCOV  string
+	coverHTML  string
+}
+
+func newRunFlags(output io.Writer) *runFlags {
+	f := &runFlags{FlagSet: flag.NewFlagSet("stang", flag.ContinueOnError)}
+	f.SetOutput(output)
+	f.StringVar(&f.eval, "e", "", "run `code` instead of files")
+	f.DurationVar(&f.timeout, "timeout", 0, "stop the program after `duration`, 0 means no limit")
+	f.StringVar(&f.root, "fs", ".", "the `dir` the fs module reads, empty to deny file access")
+	f.BoolVar(&f.writable, "fs-write", false, "let the fs module write, create and remove files in its dir")
+	f.BoolVar(&f.dumpTokens, "dump-tokens", false, "print the tokens of the program instead of running it")
+	f.BoolVar(&f.dumpAST, "dump-ast", false, "print the statements of the program instead of running it")
+	f.BoolVar(&f.dumpJSON, "dump-json", false, "print the syntax tree of the program as JSON instead of running it, a line for each file")
+	f.BoolVar(&f.optimize, "optimize", false, "fold constants and drop dead code before running, --dump-ast and --dump-json show the result")
+	f.StringVar(&f.profile, "profile", "", "write a pprof profile of the run to `file`, see go tool pprof")
+	f.BoolVar(&f.report, "profile-report", false, "print the functions and lines the run spent its time in to stderr")
+	f.BoolVar(&f.cover, "cover", false, "print how many statements and branches of each file ran to stderr")
+	f.StringVar(&f.coverLCOV, "coverprofile", "", "write the statements and branches that ran to `file` in the LCOV format")
+	f.StringVar(&f.coverHTML, "coverhtml", "", "write the sources with the hits of each line to `file`")
+	return f
+}
+
+func printUsage(w io.Writer, f *runFlags) {
+	_, _ = io.WriteString(w, usage)
+	f.SetOutput(w)
+	f.PrintDefaults()
+}
+
+// source is a program to run and the name it is reported under
+type source struct {
+	name string
+	code string
+}
+
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f := newRunFlags(stderr)
+	f.Usage = func() { printUsage(stderr, f) }
+
+	// everything after -- is passed to the program, flags may come before or between the files
+	var scriptArgs []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, scriptArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+	var positional []string
+	for {
+		if err := f.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return ExitOK
+			}
+			return ExitUsage
+		}
+		if f.NArg() == 0 {
+			break
+		}
+		positional = append(positional, f.Arg(0))
+		args = f.Args()[1:]
+	}
+
+	var sources []source
+	switch {
+	case f.eval != "":
+		sources = []source{{name: "-e", code: f.eval}}
+		scriptArgs = append(positional, scriptArgs...)
+	case len(positional) == 0:
+		if file, ok := stdin.(*os.File); ok && isTerminal(file) && !f.dumpTokens && !f.dumpAST && !f.dumpJSON {
+			StartCommandLine(stdin, stdout)
+			return ExitOK
+		}
+		positional = []string{"-"}
+		fallthrough
+	default:
+		for _, name := range positional {
+			code, err := readSource(name, stdin)
+			if err != nil {
+				_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+				return ExitUsage
+			}
+			sources = append(sources, source{name: name, code: code})
+		}
+	}
+
+	fset := token.NewFileSet()
+	programs := make([]*ast.Program, 0, len(sources))
+	for _, src := range sources {
+		if f.dumpTokens {
+			dumpTokens(stdout, src.code)
+			continue
+		}
+		file := fset.AddFile(src.name, src.code)
+		p := parser.New(lexer.NewFile(file))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			reportParseErrors(stderr, file, p.Errors())
+			return ExitSyntaxError
+		}
+		if f.optimize {
+			optimize.Program(program)
+		}
+		if f.dumpAST {
+			dumpAST(stdout, program)
+		}
+		if f.dumpJSON {
+			data, err := ast.EncodeJSON(program)
+			if err != nil {
+				_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+				return ExitRuntimeError
+			}
+			_, _ = fmt.Fprintf(stdout, "%s\n", data)
+		}
+		programs = append(programs, program)
+	}
+	if f.dumpTokens || f.dumpAST || f.dumpJSON {
+		return ExitOK
+	}
+
+	rt := &evaluator.Runtime{Stdout: stdout, FS: fileSystem(f.root, f.writable)}
+	ctx := evaluator.WithScheduler(evaluator.WithRuntime(context.Background(), rt))
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	scope := evaluator.NewScope(nil)
+	elements := make([]evaluator.Object, 0, len(scriptArgs))
+	for _, arg := range scriptArgs {
+		elements = append(elements, &evaluator.String{Value: arg})
+	}
+	scope.Set("args", &evaluator.Array{Elements: elements})
+	var prof *profiler.Profiler
+	var cover *coverage.Profile
+	switch {
+	case (f.profile != "" || f.report) && (f.cover || f.coverLCOV != "" || f.coverHTML != ""):
+		_, _ = fmt.Fprintln(stderr, "stang: cannot profile and measure coverage in the same run")
+		return ExitUsage
+	case f.optimize && (f.cover || f.coverLCOV != "" || f.coverHTML != ""):
+		// the coverage of the optimized program would miss the code that was dropped
+		_, _ = fmt.Fprintln(stderr, "stang: cannot optimize and measure coverage in the same run")
+		return ExitUsage
+	case f.cover || f.coverLCOV != "" || f.coverHTML != "":
+		cover = coverage.New()
+		for i, program := range programs {
+			cover.Add(sources[i].name, sources[i].code, program)
+		}
+		ctx = evaluator.WithHook(ctx, cover)
+		defer func() {
+			if err := writeCoverage(cover, stderr, f.cover, f.coverLCOV, f.coverHTML); err != nil {
+				_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			}
+		}()
+	case f.profile != "" || f.report:
+		prof = profiler.New()
+		ctx = evaluator.WithHook(ctx, prof)
+		defer func() {
+			if err := writeProfile(prof, f, stderr); err != nil {
+				_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			}
+		}()
+	}
+	for i, program := range programs {
+		if prof != nil {
+			prof.File(sources[i].name)
+		}
+		if err, ok := run(ctx, program, scope).(*evaluator.Error); ok {
+			reportError(stderr, fset, sources[i].name, err)
+			return ExitRuntimeError
+		}
+	}
+	return ExitOK
+}
+
+// fileSystem is the file system of the fs module working in root, which is read-only unless writable is set
+func fileSystem(root string, writable bool) fs.FS {
+	switch {
+	case root == "":
+		return nil
+	case writable:
+		return vfs.Dir(root)
+	default:
+		return vfs.ReadOnly(vfs.Dir(root))
+	}
+}
+
+// run evaluates a program, a panic of the evaluator is reported like a runtime error
+func run(ctx context.Context, program *ast.Program, scope *evaluator.Scope) (result evaluator.Object) {
+	defer evaluator.Recover(&result)
+	return evaluator.Eval(ctx, program, scope)
+}
+
+// writeProfile writes what prof measured where the flags say
+func writeProfile(prof *profiler.Profiler, f *runFlags, stderr io.Writer) error {
+	prof.Stop()
+	if f.report {
+		if err := prof.WriteReport(stderr); err != nil {
+			return err
+		}
+	}
+	if f.profile == "" {
+		return nil
+	}
+	return writeFile(f.profile, prof.WritePprof)
+}
+
+func readSource(name string, stdin io.Reader) (string, error) {
+	if name == "-" {
+		code, err := ioutil.ReadAll(stdin)
+		return string(code), err
+	}
+	code, err := ioutil.ReadFile(name)
+	return string(code), err
+}
+
+// reportError writes err with the range of code it happened in, which is underlined below its line. An error
+// without a position is blamed on the file called name
+func reportError(w io.Writer, fset *token.FileSet, name string, err *evaluator.Error) {
+	if !err.Pos.IsValid() {
+		_, _ = fmt.Fprintf(w, "%s: %s\n", name, err.String(0))
+		return
+	}
+	report(w, fset.File(err.Pos.Filename), err.Pos, err.End, err.String(0))
+}
+
+// reportParseErrors writes the errors the parser found in file the way reportError writes a runtime error,
+// each one spans the token it points at
+func reportParseErrors(w io.Writer, file *token.File, errs []string) {
+	tokens := map[[2]int]token.Token{}
+	l := lexer.NewFile(file)
+	for {
+		tok := l.NextToken()
+		tokens[[2]int{tok.Pos.Line, tok.Pos.Col}] = tok
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	for _, msg := range errs {
+		line, col, text := parser.SplitError(msg)
+		if line == 0 {
+			_, _ = fmt.Fprintf(w, "%s: %s\n", file.Name(), msg)
+			continue
+		}
+		tok, ok := tokens[[2]int{line, col}]
+		if !ok {
+			tok.Pos = token.Position{Filename: file.Name(), Line: line, Col: col}
+			tok.End = tok.Pos
+		}
+		report(w, file, tok.Pos, tok.End, text)
+	}
+}
+
+// report writes msg after the range from pos to end and underlines that range below its line in file
+func report(w io.Writer, file *token.File, pos, end token.Position, msg string) {
+	_, _ = fmt.Fprintf(w, "%s: %s\n", token.Span(pos, end), msg)
+	if file == nil {
+		return
+	}
+	line := file.Line(pos.Line)
+	start := pos.Col - 1
+	if start > len(line) {
+		start = len(line)
+	}
+	stop := len(line)
+	if end.Line == pos.Line && end.Col-1 < stop {
+		stop = end.Col - 1
+	}
+	if stop <= start {
+		stop = start + 1
+	}
+	// tabs are kept so that the marks line up with the code
+	indent := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, line[:start])
+	_, _ = fmt.Fprintf(w, "    %s\n    %s%s\n", line, indent, strings.Repeat("^", stop-start))
+}
+
+func dumpTokens(w io.Writer, src string) {
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		_, _ = fmt.Fprintf(w, "%s %s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+func dumpAST(w io.Writer, program *ast.Program) {
+	for _, stmt := range program.Statements {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && es.Expression == nil {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s %s\n", strings.TrimPrefix(fmt.Sprintf("%T", stmt), "*ast."), stmt.String())
+	}
+}
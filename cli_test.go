@@ -0,0 +1,124 @@
+package stang
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, code string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	lib := write("lib.stg", "let greet = function(name) { return 'hello ' + name }")
+	script := write("script.stg", "#!/usr/bin/env stang\nprint(greet(args[0]), len(args))")
+	broken := write("broken.stg", "let = 1")
+	failing := write("failing.stg", "print('before')\nmissing")
+	indexing := write("indexing.stg", "let sixth = function(a) {\n  return a[5]\n}")
+	failingCall := write("call.stg", "print(sixth([1]))")
+	messy := write("messy.stg", "let a=1 // one\nprint( a )\n")
+	passingTest := write("pass_test.stg", "test('reads files', function() { assert(fs.exists('lib.stg')) })")
+	failingTest := write("fail_test.stg", "test('fails', function() { assertEqual(1, 2) })")
+	writingTest := write("writing.stg", "test('writes', function() { fs.write('written.txt', 'a') })")
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"run", lib, script, "--", "stan", "kyle"}, "", ExitOK, "hello stan, 2\n", ""},
+		{[]string{lib, script, "--", "eric"}, "", ExitOK, "hello eric, 1\n", ""},
+		{[]string{"-e", "print(args)", "a", "b"}, "", ExitOK, "[a, b]\n", ""},
+		{[]string{"--timeout", "1s", "-e", "print(1 + 1)"}, "", ExitOK, "2\n", ""},
+		{[]string{}, "print('from stdin')", ExitOK, "from stdin\n", ""},
+		{[]string{lib, "-", "--", "kenny"}, "print(greet(args[0]))", ExitOK, "hello kenny\n", ""},
+		{[]string{broken}, "", ExitSyntaxError, "", "broken.stg:1:5: expected token to be IDENT, got = instead\n    let = 1\n        ^\n"},
+		{[]string{failing}, "", ExitRuntimeError, "before\n", "failing.stg:2:1-7: Error: unknown identifier: 'missing' is not defined\n    missing\n    ^^^^^^^\n"},
+		{[]string{"--timeout", "50ms", "-e", "while (true) { 1 }"}, "", ExitRuntimeError, "", ": Error: evaluation timeout"},
+		{[]string{"--timeout", "50ms", "-e", "while (true) {}"}, "", ExitRuntimeError, "", ": Error: evaluation timeout"},
+		{[]string{indexing, failingCall}, "", ExitRuntimeError, "", "indexing.stg:2:10-13: Error: index '5' is out of range, valid range is [0, 0]\n      return a[5]\n             ^^^^\n"},
+		{[]string{filepath.Join(dir, "nope.stg")}, "", ExitUsage, "", "stang: open"},
+		{[]string{"--bogus"}, "", ExitUsage, "", "flag provided but not defined: -bogus"},
+		{[]string{"--dump-tokens", "-e", "let a"}, "", ExitOK, "1:1 LET \"let\"\n1:5 IDENT \"a\"\n", ""},
+		{[]string{"--dump-ast", "-e", "let a = 1; a + 2"}, "", ExitOK, "LetStatement let a = 1\nExpressionStatement (a + 2)\n", ""},
+		{[]string{"--optimize", "--dump-ast", "-e", "let a = 1 + 2 * 3; if (false) { a }"}, "", ExitOK, "LetStatement let a = 7\nExpressionStatement null\n", ""},
+		{[]string{"--optimize", "-e", "print('a' + 1); if (2 > 1) { print(1 / 0) }"}, "", ExitRuntimeError, "a1\n", "-e:1:36-40: Error: cannot divide by zero"},
+		{[]string{"--dump-json", "-e", "x"}, "", ExitOK, `{"version":2,"node":{"kind":"Program","statements":[{"kind":"ExpressionStatement","token":{"type":"IDENT","literal":"x","pos":{"file":"-e","offset":0,"line":1,"col":1},"end":{"file":"-e","offset":1,"line":1,"col":2}},"expression":`, ""},
+		{[]string{"--fs", dir, "-e", "print(fs.exists('lib.stg'))"}, "", ExitOK, "true\n", ""},
+		{[]string{"--fs", "", "-e", "fs.exists('lib.stg')"}, "", ExitRuntimeError, "", "-e:1:1-20: Error:"},
+		{[]string{"--fs", dir, "-e", "fs.write('out.txt', 'a')"}, "", ExitRuntimeError, "", "-e:1:1-24: Error: file system is read-only"},
+		{[]string{"--fs", dir, "--fs-write", "-e", "fs.write('out.txt', 'a'); print(fs.read('out.txt'))"}, "", ExitOK, "a\n", ""},
+		{[]string{"help"}, "", ExitOK, "usage:", ""},
+		{[]string{"fmt"}, "if (a) {b}", ExitOK, "if (a) {\n    b\n}\n", ""},
+		{[]string{"fmt", "-d", messy}, "", ExitOK, "--- " + messy + "\n+++ " + messy + " (formatted)\n@@ -1,2 +1,2 @@\n-let a=1 // one\n-print( a )\n+let a = 1 // one\n+print(a)\n", ""},
+		{[]string{"fmt", broken}, "", ExitSyntaxError, "", "broken.stg:1:5: expected"},
+		{[]string{"fmt", "-w"}, "", ExitUsage, "", "-w needs files"},
+		{[]string{"lint", lib}, "", ExitOK, "", ""},
+		{[]string{"lint"}, "let len = 1", ExitRuntimeError, "-:1:5: len hides the builtin of the same name (shadow-builtin)\n", ""},
+		{[]string{"lint", broken}, "", ExitSyntaxError, "", "broken.stg:1:5: expected"},
+		{[]string{"lsp"}, "Content-Length: 17\r\n\r\n{\"method\":\"exit\"}", ExitOK, "", ""},
+		{[]string{"lsp", "x"}, "", ExitUsage, "", "usage: stang lsp"},
+		{[]string{"test", passingTest}, "", ExitOK, "PASS: 1 tests\n", ""},
+		{[]string{"test", "-format", "tap", dir}, "", ExitRuntimeError, "TAP version 13\n1..2\nnot ok 1 - " + failingTest + ": fails\n", ""},
+		{[]string{"test", "-run", "files", dir}, "", ExitOK, "PASS: 1 tests\n", ""},
+		{[]string{"test", broken}, "", ExitSyntaxError, "PASS: 0 tests\n", "broken.stg:1:5: expected"},
+		{[]string{"test", "-format", "xml"}, "", ExitUsage, "", "unknown format"},
+		{[]string{"test", writingTest}, "", ExitRuntimeError, "--- FAIL: writes", ""},
+		{[]string{"test", "-fs-write", writingTest}, "", ExitOK, "PASS: 1 tests\n", ""},
+		{[]string{"debug", messy, "x"}, "p args\nc\n", ExitOK, messy + ":1\n>    1 | let a=1 // one\n(stang) [x]\n(stang) 1\n", ""},
+		{[]string{"debug", lib}, "b 1\np greet\nq\n", ExitOK, lib + ":1\n>    1 | let greet", ""},
+		{[]string{"debug", failing}, "", ExitRuntimeError, failing + ":1\n", "failing.stg:2:1-7: Error: unknown identifier"},
+		{[]string{"debug"}, "", ExitUsage, "", "usage: stang debug"},
+		{[]string{"--profile-report", lib, script, "--", "butters"}, "", ExitOK, "hello butters, 1\n", "calls  function"},
+		{[]string{"--profile", filepath.Join(dir, "out.pprof"), failing}, "", ExitRuntimeError, "before\n", "failing.stg:2:1-7: Error"},
+		{[]string{"--cover", lib, script, "--", "wendy"}, "", ExitOK, "hello wendy, 1\n", "total: 100.0% of statements (3/3), 100.0% of branches (0/0)"},
+		{[]string{"--cover", "--profile-report", lib}, "", ExitUsage, "", "cannot profile and measure coverage"},
+		{[]string{"--cover", "--optimize", lib}, "", ExitUsage, "", "cannot optimize and measure coverage"},
+		{[]string{"test", "-cover", "-coverprofile", filepath.Join(dir, "cover.info"), passingTest}, "", ExitOK, "PASS: 1 tests\n" + passingTest + ": 100.0% of statements (2/2)", ""},
+		{[]string{"cover", filepath.Join(dir, "cover.info")}, "", ExitOK, passingTest + ": 100.0% of statements (1/1)", ""}, // LCOV only knows lines
+		{[]string{"cover"}, "", ExitUsage, "", "usage: stang cover"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Main(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.code || !strings.HasPrefix(stdout.String(), tt.stdout) || !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("stang %s: got code=%d stdout=%q stderr=%q, want code=%d stdout=%q stderr containing %q",
+				strings.Join(tt.args, " "), code, stdout.String(), stderr.String(), tt.code, tt.stdout, tt.stderr)
+		}
+	}
+
+	if profile, err := ioutil.ReadFile(filepath.Join(dir, "out.pprof")); err != nil || len(profile) == 0 {
+		t.Errorf("stang --profile should write a profile of a failed run too. err=%v", err)
+	}
+
+	if code := Main([]string{"fmt", "-w", messy}, strings.NewReader(""), ioutil.Discard, ioutil.Discard); code != ExitOK {
+		t.Fatalf("stang fmt -w failed with %d", code)
+	}
+	if formatted, _ := ioutil.ReadFile(messy); string(formatted) != "let a = 1 // one\nprint(a)\n" {
+		t.Errorf("stang fmt -w should rewrite the file. got=%q", formatted)
+	}
+}
+
+func TestRunProgram(t *testing.T) {
+	seeded, err := RunProgram("random.seed(42); random.randint(1, 1000000000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := RunProgram("random.seed(42); random.randint(1, 1000000000)"); again != seeded {
+		t.Errorf("a seeded program should repeat its numbers. got=%s, want=%s", again, seeded)
+	}
+	// a program seeding its random source must not seed the one of the next program
+	_, _ = RunProgram("random.seed(42)")
+	if next, _ := RunProgram("random.randint(1, 1000000000)"); next == seeded {
+		t.Errorf("programs should not share their random source. got=%s", next)
+	}
+}
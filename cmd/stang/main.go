@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/yzbmz5913/stang"
+	"os"
+)
+
+func main() {
+	os.Exit(stang.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,83 @@
+package stang
+
+import (
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/token"
+	"sort"
+	"strings"
+)
+
+// complete returns the candidates for the word line ends with, and the offset where that word starts.
+// After a dot the candidates are the methods of the receiver, otherwise the variables in scope, builtins and keywords.
+func (r *repl) complete(line string) (int, []string) {
+	start := len(line)
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	prefix := line[start:]
+	var names []string
+	if start > 0 && line[start-1] == '.' {
+		receiver := r.receiver(line[:start-1])
+		if receiver == nil {
+			return start, nil
+		}
+		names = evaluator.Methods(receiver)
+	} else {
+		for s := r.scope; s != nil; s = s.Parent() {
+			names = append(names, s.Names()...)
+		}
+		names = append(names, evaluator.Builtins()...)
+		names = append(names, token.Keywords()...)
+	}
+	seen := map[string]bool{}
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// receiver finds the object whose methods are completed, src being the input before the dot.
+// Only variables, builtins and string literals are resolved, nothing is evaluated.
+func (r *repl) receiver(src string) evaluator.Object {
+	if src == "" {
+		return nil
+	}
+	if strings.IndexByte("'\"`", src[len(src)-1]) >= 0 {
+		return &evaluator.String{}
+	}
+	start := len(src)
+	for start > 0 && isIdentChar(src[start-1]) {
+		start--
+	}
+	name := src[start:]
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return nil
+	}
+	if obj, ok := r.scope.Get(name); ok {
+		return obj
+	}
+	return evaluator.LookupBuiltin(name)
+}
+
+// longestCommonPrefix returns what all candidates start with
+func longestCommonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
@@ -0,0 +1,94 @@
+package stang
+
+import (
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/coverage"
+	"io"
+	"os"
+)
+
+const coverUsage = `usage: stang cover [flags] profile...
+  merges the LCOV profiles written by --coverprofile and prints how much of each file they cover.
+  The sources of the HTML report are read from the files the profiles name.
+flags:
+`
+
+func coverCommand(args []string, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("stang cover", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	out := f.String("o", "", "write the merged profile to `file`")
+	html := f.String("html", "", "write the sources with the hits of each line to `file`")
+	f.Usage = func() {
+		_, _ = io.WriteString(stderr, coverUsage)
+		f.PrintDefaults()
+	}
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if f.NArg() == 0 {
+		f.Usage()
+		return ExitUsage
+	}
+	merged := coverage.New()
+	for _, name := range f.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			return ExitUsage
+		}
+		profile, err := coverage.ReadLCOV(file)
+		_ = file.Close()
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang cover: %s: %s\n", name, err)
+			return ExitUsage
+		}
+		merged.Merge(profile)
+	}
+	if *html != "" {
+		for _, file := range merged.Files() {
+			if src, err := readSource(file.Name, nil); err == nil {
+				file.Source = src
+			}
+		}
+	}
+	if err := writeCoverage(merged, stdout, true, *out, *html); err != nil {
+		_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+		return ExitRuntimeError
+	}
+	return ExitOK
+}
+
+// writeCoverage writes what profile counted: the summary to w if asked, LCOV and HTML to the files named, if any
+func writeCoverage(profile *coverage.Profile, w io.Writer, summary bool, lcov, html string) error {
+	if summary {
+		if err := profile.WriteSummary(w); err != nil {
+			return err
+		}
+	}
+	if lcov != "" {
+		if err := writeFile(lcov, profile.WriteLCOV); err != nil {
+			return err
+		}
+	}
+	if html != "" {
+		return writeFile(html, profile.WriteHTML)
+	}
+	return nil
+}
+
+// writeFile creates the file called name and writes to it with write
+func writeFile(name string, write func(io.Writer) error) error {
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
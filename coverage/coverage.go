@@ -0,0 +1,282 @@
+// Package coverage records which statements and branches of stang programs run, it is used by the --cover flags of
+// stang run and stang test and by stang cover.
+//
+// A Profile is an evaluator.BranchHook: the programs are added to it before they are evaluated so that it knows the
+// statements and branches that never run too. Statements and branches are identified by their file and position, so
+// the counts of several evaluations of a file, even parsed again, add up, and so do those of profiles merged together.
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Statement is a statement of a file and how many times it ran
+type Statement struct {
+	Line, Column int
+	Hits         int64
+}
+
+// Branch is a place where the evaluation goes one of several ways: the consequence or the alternative of an if,
+// the body or the exit of a loop, the cases of a select
+type Branch struct {
+	Line, Column int
+	Kind         string  // if, while, for or select
+	Hits         []int64 // how many times each way was taken
+}
+
+// Reached reports whether the evaluation came to the branch at all
+func (b *Branch) Reached() bool {
+	for _, hits := range b.Hits {
+		if hits > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// File is the coverage of a file, its statements and branches are in source order
+type File struct {
+	Name       string
+	Source     string // empty when the file was read from LCOV
+	Statements []*Statement
+	Branches   []*Branch
+}
+
+// Counts returns how many statements and branch ways there are and how many of them ran
+func (f *File) Counts() (statements, covered, ways, taken int) {
+	for _, s := range f.Statements {
+		statements++
+		if s.Hits > 0 {
+			covered++
+		}
+	}
+	for _, b := range f.Branches {
+		for _, hits := range b.Hits {
+			ways++
+			if hits > 0 {
+				taken++
+			}
+		}
+	}
+	return
+}
+
+// Lines returns the hits of each line holding statements, the most any of its statements ran
+func (f *File) Lines() map[int]int64 {
+	lines := map[int]int64{}
+	for _, s := range f.Statements {
+		if hits, ok := lines[s.Line]; !ok || s.Hits > hits {
+			lines[s.Line] = s.Hits
+		}
+	}
+	return lines
+}
+
+func (f *File) statement(pos token.Position) *Statement {
+	for _, s := range f.Statements {
+		if s.Line == pos.Line && s.Column == pos.Col {
+			return s
+		}
+	}
+	s := &Statement{Line: pos.Line, Column: pos.Col}
+	f.Statements = append(f.Statements, s)
+	return s
+}
+
+func (f *File) branch(pos token.Position, kind string, ways int) *Branch {
+	for _, b := range f.Branches {
+		if b.Line == pos.Line && b.Column == pos.Col {
+			if b.Kind == "" {
+				b.Kind = kind
+			}
+			for len(b.Hits) < ways {
+				b.Hits = append(b.Hits, 0)
+			}
+			return b
+		}
+	}
+	b := &Branch{Line: pos.Line, Column: pos.Col, Kind: kind, Hits: make([]int64, ways)}
+	f.Branches = append(f.Branches, b)
+	return b
+}
+
+func (f *File) sort() {
+	sort.SliceStable(f.Statements, func(i, j int) bool {
+		a, b := f.Statements[i], f.Statements[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	sort.SliceStable(f.Branches, func(i, j int) bool {
+		a, b := f.Branches[i], f.Branches[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+}
+
+// Profile collects the coverage of the programs added to it
+type Profile struct {
+	mu         sync.Mutex
+	files      map[string]*File
+	statements map[ast.Node]*Statement
+	branches   map[ast.Node]*Branch
+}
+
+// New returns an empty Profile
+func New() *Profile {
+	return &Profile{
+		files:      map[string]*File{},
+		statements: map[ast.Node]*Statement{},
+		branches:   map[ast.Node]*Branch{},
+	}
+}
+
+// Add makes the statements and branches of program, read from the file called name whose source is src, count
+// when the program is evaluated with the profile as its hook
+func (p *Profile) Add(name, src string, program *ast.Program) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.file(name)
+	if src != "" {
+		f.Source = src
+	}
+	p.collect(f, program)
+	f.sort()
+}
+
+func (p *Profile) file(name string) *File {
+	f, ok := p.files[name]
+	if !ok {
+		f = &File{Name: name}
+		p.files[name] = f
+	}
+	return f
+}
+
+// Files returns the coverage of each file, sorted by name
+func (p *Profile) Files() []*File {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	files := make([]*File, 0, len(p.files))
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// Before counts the statements as they run
+func (p *Profile) Before(_ context.Context, node ast.Node, _ token.Position, _ *evaluator.Scope) evaluator.Object {
+	if _, ok := node.(ast.Statement); !ok {
+		return nil
+	}
+	p.mu.Lock()
+	if s, ok := p.statements[node]; ok {
+		s.Hits++
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// Branch counts the ways the branches take
+func (p *Profile) Branch(_ context.Context, node ast.Node, branch int) {
+	p.mu.Lock()
+	if b, ok := p.branches[node]; ok && branch < len(b.Hits) {
+		b.Hits[branch]++
+	}
+	p.mu.Unlock()
+}
+
+// Merge adds the counts of q to those of p, the files of q that p lacks are copied. Profiles read from LCOV only know
+// the lines of statements, so they are best merged with each other.
+func (p *Profile) Merge(q *Profile) {
+	if p == q {
+		return
+	}
+	files := q.Files()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, qf := range files {
+		f := p.file(qf.Name)
+		if f.Source == "" {
+			f.Source = qf.Source
+		}
+		for _, qs := range qf.Statements {
+			f.statement(token.Position{Line: qs.Line, Col: qs.Column}).Hits += qs.Hits
+		}
+		for _, qb := range qf.Branches {
+			b := f.branch(token.Position{Line: qb.Line, Col: qb.Column}, qb.Kind, len(qb.Hits))
+			for i, hits := range qb.Hits {
+				b.Hits[i] += hits
+			}
+		}
+		f.sort()
+	}
+}
+
+// WriteSummary writes the share of statements and branches that ran in each file and in all of them
+func (p *Profile) WriteSummary(w io.Writer) error {
+	var b strings.Builder
+	var statements, covered, ways, taken int
+	files := p.Files()
+	p.mu.Lock()
+	for _, f := range files {
+		s, c, bw, bt := f.Counts()
+		statements, covered, ways, taken = statements+s, covered+c, ways+bw, taken+bt
+		fmt.Fprintf(&b, "%s: %s\n", f.Name, summary(s, c, bw, bt))
+	}
+	p.mu.Unlock()
+	if len(files) != 1 {
+		fmt.Fprintf(&b, "total: %s\n", summary(statements, covered, ways, taken))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func summary(statements, covered, ways, taken int) string {
+	return fmt.Sprintf("%s of statements (%d/%d), %s of branches (%d/%d)",
+		percent(covered, statements), covered, statements, percent(taken, ways), taken, ways)
+}
+
+func percent(n, of int) string {
+	if of == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(of))
+}
+
+// collect finds the statements and branches of program in f
+func (p *Profile) collect(f *File, program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			p.statements[n] = f.statement(n.Token.Pos)
+		case *ast.ReturnStatement:
+			p.statements[n] = f.statement(n.Token.Pos)
+		case *ast.DeleteStatement:
+			p.statements[n] = f.statement(n.Token.Pos)
+		case *ast.ExpressionStatement:
+			if n.Expression != nil {
+				p.statements[n] = f.statement(n.Token.Pos)
+			}
+		case *ast.IfExpression:
+			p.branches[n] = f.branch(n.Token.Pos, "if", 2)
+		case *ast.WhileExpression:
+			p.branches[n] = f.branch(n.Token.Pos, "while", 2)
+		case *ast.ForExpression:
+			p.branches[n] = f.branch(n.Token.Pos, "for", 2)
+		case *ast.ForOfExpression:
+			p.branches[n] = f.branch(n.Token.Pos, "for", 2)
+		case *ast.SelectExpression:
+			p.branches[n] = f.branch(n.Token.Pos, "select", len(n.Cases))
+		}
+		return true
+	})
+}
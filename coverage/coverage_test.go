@@ -0,0 +1,131 @@
+package coverage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const program = `let sign = function(n) {
+    if (n < 0) {
+        return -1
+    }
+    return 1
+}
+let i = 0
+while (i < 2) { i++ }
+for (let x of [1, 2]) { sign(x) }
+let never = function() {
+    print("never")
+}
+`
+
+// run evaluates program with a new profile as its hook
+func run(t *testing.T) *Profile {
+	p := New()
+	parsed := parser.New(lexer.New(program)).ParseProgram()
+	p.Add("prog.stg", program, parsed)
+	ctx := evaluator.WithHook(evaluator.WithRuntime(context.Background(), &evaluator.Runtime{Stdout: ioutil.Discard}), p)
+	if result := evaluator.Eval(ctx, parsed, evaluator.NewScope(nil)); result != nil && result.Type() == evaluator.ErrorObj {
+		t.Fatal(result.String(0))
+	}
+	return p
+}
+
+func TestProfile(t *testing.T) {
+	p := run(t)
+	files := p.Files()
+	if len(files) != 1 || files[0].Name != "prog.stg" {
+		t.Fatalf("wrong files %v", files)
+	}
+	f := files[0]
+	expectedLines := map[int]int64{1: 1, 2: 2, 3: 0, 5: 2, 7: 1, 8: 2, 9: 2, 10: 1, 11: 0}
+	lines := f.Lines()
+	if fmt.Sprint(lines) != fmt.Sprint(expectedLines) {
+		t.Errorf("wrong lines. got=%v, want=%v", lines, expectedLines)
+	}
+	var branches []string
+	for _, b := range f.Branches {
+		branches = append(branches, fmt.Sprintf("%s %d:%d %v", b.Kind, b.Line, b.Column, b.Hits))
+	}
+	expectedBranches := []string{"if 2:5 [0 2]", "while 8:1 [2 1]", "for 9:1 [2 1]"}
+	if strings.Join(branches, ", ") != strings.Join(expectedBranches, ", ") {
+		t.Errorf("wrong branches. got=%v, want=%v", branches, expectedBranches)
+	}
+
+	var b bytes.Buffer
+	if err := p.WriteSummary(&b); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "prog.stg: 81.8% of statements (9/11), 83.3% of branches (5/6)\n"; b.String() != expected {
+		t.Errorf("wrong summary. got=%q, want=%q", b.String(), expected)
+	}
+
+	// a second run counts again
+	p.Merge(run(t))
+	if hits := f.Lines()[2]; hits != 4 {
+		t.Errorf("merged profiles should add up. got=%d", hits)
+	}
+}
+
+func TestLCOV(t *testing.T) {
+	p := run(t)
+	var b bytes.Buffer
+	if err := p.WriteLCOV(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{"SF:prog.stg\n", "BRDA:2,5,0,0\n", "BRDA:2,5,1,2\n", "DA:3,0\n", "DA:8,2\n", "LF:9\nLH:7\n", "BRF:6\nBRH:5\nDA:1,1\n"} {
+		if !strings.Contains(b.String(), record) {
+			t.Errorf("the profile should contain %q. got=\n%s", record, b.String())
+		}
+	}
+
+	read, err := ReadLCOV(strings.NewReader(b.String() + b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := read.WriteLCOV(&again); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(again.String(), "BRDA:2,5,1,4\n") || !strings.Contains(again.String(), "DA:8,4\n") {
+		t.Errorf("records of the same file should add up. got=\n%s", again.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"DA:1,1\n", "line 1: DA outside of a file record"},
+		{"SF:a\nDA:x,1\n", `line 2: bad DA record "x,1"`},
+		{"SF:a\nBRDA:1,1,-1,1\n", `line 2: bad BRDA record "1,1,-1,1"`},
+	}
+	for _, tt := range tests {
+		if _, err := ReadLCOV(strings.NewReader(tt.input)); err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var b bytes.Buffer
+	if err := run(t).WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{
+		`<tr class="partial" title="not taken: then"><td class="number">2</td><td class="hits">2</td><td class="text">    if (n &lt; 0) {</td></tr>`,
+		`<tr class="uncovered"><td class="number">3</td><td class="hits">0</td>`,
+		`<tr class=""><td class="number">4</td><td class="hits"></td><td class="text">    }</td></tr>`,
+		`<tr class="covered"><td class="number">9</td><td class="hits">2</td>`,
+	} {
+		if !strings.Contains(b.String(), row) {
+			t.Errorf("the report should contain %s", row)
+		}
+	}
+}
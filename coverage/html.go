@@ -0,0 +1,134 @@
+package coverage
+
+import (
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// line is a line of source as the HTML report shows it
+type line struct {
+	Number int
+	Hits   string // empty for lines without statements
+	Class  string // covered, partial, uncovered or empty
+	Text   string
+	Title  string // the ways of the branches on the line that were not taken
+}
+
+type htmlFile struct {
+	Name    string
+	ID      string
+	Summary string
+	Lines   []line
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>stang coverage</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table.source { border-collapse: collapse; font-family: monospace; white-space: pre; margin-bottom: 2em; }
+table.source td { padding: 0 .5em; }
+td.number, td.hits { text-align: right; color: #888; }
+tr.covered td.text { background: #cfc; }
+tr.partial td.text { background: #ffc; }
+tr.uncovered td.text { background: #fcc; }
+</style>
+</head>
+<body>
+<h1>stang coverage</h1>
+<ul>
+{{range .}}<li><a href="#{{.ID}}">{{.Name}}</a>: {{.Summary}}</li>
+{{end}}</ul>
+{{range .}}<h2 id="{{.ID}}">{{.Name}}</h2>
+<table class="source">
+{{range .Lines}}<tr class="{{.Class}}"{{if .Title}} title="{{.Title}}"{{end}}><td class="number">{{.Number}}</td><td class="hits">{{.Hits}}</td><td class="text">{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes the source of the files with how many times each line ran, lines where a statement or a branch
+// did not run are marked as partially covered. Files without a source only list their lines.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	files := p.Files()
+	p.mu.Lock()
+	var data []htmlFile
+	for i, f := range files {
+		s, c, ways, taken := f.Counts()
+		data = append(data, htmlFile{Name: f.Name, ID: "file" + strconv.Itoa(i), Summary: summary(s, c, ways, taken), Lines: f.htmlLines()})
+	}
+	p.mu.Unlock()
+	return htmlTemplate.Execute(w, data)
+}
+
+func (f *File) htmlLines() []line {
+	var texts []string
+	if f.Source != "" {
+		texts = strings.Split(strings.TrimSuffix(f.Source, "\n"), "\n")
+	}
+	hits := f.Lines()
+	missed := map[int]bool{}
+	for _, s := range f.Statements {
+		if s.Hits == 0 {
+			missed[s.Line] = true
+		}
+	}
+	untaken := map[int][]string{}
+	for _, b := range f.Branches {
+		for i, h := range b.Hits {
+			if h == 0 {
+				untaken[b.Line] = append(untaken[b.Line], wayName(b.Kind, i))
+			}
+		}
+	}
+	last := len(texts)
+	for n := range hits {
+		if n > last {
+			last = n
+		}
+	}
+	lines := make([]line, 0, last)
+	for n := 1; n <= last; n++ {
+		l := line{Number: n}
+		if n <= len(texts) {
+			l.Text = texts[n-1]
+		}
+		if h, ok := hits[n]; ok {
+			l.Hits = strconv.FormatInt(h, 10)
+			switch {
+			case h == 0:
+				l.Class = "uncovered"
+			case missed[n] || len(untaken[n]) > 0:
+				l.Class = "partial"
+			default:
+				l.Class = "covered"
+			}
+		}
+		if len(untaken[n]) > 0 {
+			l.Title = "not taken: " + strings.Join(untaken[n], ", ")
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// wayName names the i-th way of a branch of the kind
+func wayName(kind string, i int) string {
+	switch {
+	case kind == "if" && i == 0:
+		return "then"
+	case kind == "if":
+		return "else"
+	case (kind == "while" || kind == "for") && i == 0:
+		return "loop body"
+	case kind == "while" || kind == "for":
+		return "loop exit"
+	case kind == "select":
+		return "case " + strconv.Itoa(i)
+	}
+	return "branch " + strconv.Itoa(i)
+}
@@ -0,0 +1,107 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteLCOV writes the profile in the tracefile format of LCOV, which genhtml and most coverage services read.
+// A line counts as many hits as the statement on it that ran the most. The column of a branch is its block number.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	files := p.Files()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, f := range files {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.Name)
+		for _, b := range f.Branches {
+			reached := b.Reached()
+			for i, hits := range b.Hits {
+				taken := "-"
+				if reached {
+					taken = strconv.FormatInt(hits, 10)
+				}
+				fmt.Fprintf(bw, "BRDA:%d,%d,%d,%s\n", b.Line, b.Column, i, taken)
+			}
+		}
+		_, _, ways, taken := f.Counts()
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", ways, taken)
+		lines := f.Lines()
+		numbers := make([]int, 0, len(lines))
+		hit := 0
+		for line, hits := range lines {
+			numbers = append(numbers, line)
+			if hits > 0 {
+				hit++
+			}
+		}
+		sort.Ints(numbers)
+		for _, line := range numbers {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, lines[line])
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(numbers), hit)
+	}
+	return bw.Flush()
+}
+
+// ReadLCOV reads a profile written by WriteLCOV or another LCOV tool, each line becomes a statement.
+// Records other than files, lines and branches are skipped.
+func ReadLCOV(r io.Reader) (*Profile, error) {
+	p := New()
+	var f *File
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		kind, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			kind, value = line[:i], line[i+1:]
+		}
+		if kind == "SF" {
+			f = p.file(value)
+			continue
+		}
+		if kind == "end_of_record" {
+			if f != nil {
+				f.sort()
+			}
+			f = nil
+			continue
+		}
+		if kind != "DA" && kind != "BRDA" {
+			continue
+		}
+		if f == nil {
+			return nil, fmt.Errorf("line %d: %s outside of a file record", n, kind)
+		}
+		fields := strings.Split(value, ",")
+		numbers := make([]int64, len(fields))
+		for i, field := range fields {
+			if field == "-" {
+				continue
+			}
+			number, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad %s record %q", n, kind, value)
+			}
+			numbers[i] = number
+		}
+		switch {
+		case kind == "DA" && len(fields) >= 2:
+			f.statement(token.Position{Line: int(numbers[0])}).Hits += numbers[1]
+		case kind == "BRDA" && len(fields) == 4 && numbers[2] >= 0 && numbers[2] < 1<<16:
+			b := f.branch(token.Position{Line: int(numbers[0]), Col: int(numbers[1])}, "", int(numbers[2])+1)
+			b.Hits[numbers[2]] += numbers[3]
+		default:
+			return nil, fmt.Errorf("line %d: bad %s record %q", n, kind, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
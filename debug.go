@@ -0,0 +1,73 @@
+package stang
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/debugger"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+)
+
+const debugUsage = `usage: stang debug [flags] file [args...]
+  runs the file under a debugger that reads its commands from stdin, it stops before the first line, type help for the commands.
+flags:
+`
+
+func debugCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("stang debug", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	root := f.String("fs", ".", "the `dir` the fs module reads, empty to deny file access")
+	writable := f.Bool("fs-write", false, "let the fs module write, create and remove files in its dir")
+	f.Usage = func() {
+		_, _ = io.WriteString(stderr, debugUsage)
+		f.PrintDefaults()
+	}
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if f.NArg() == 0 || f.Arg(0) == "-" {
+		// stdin holds the commands, so the program must come from a file
+		f.Usage()
+		return ExitUsage
+	}
+	name := f.Arg(0)
+	src, err := readSource(name, stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+		return ExitUsage
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile(name, src)
+	p := parser.New(lexer.NewFile(file))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		reportParseErrors(stderr, file, p.Errors())
+		return ExitSyntaxError
+	}
+
+	rt := &evaluator.Runtime{Stdout: stdout, FS: fileSystem(*root, *writable)}
+	d := debugger.New(name, src, stdin, stdout)
+	ctx := evaluator.WithHook(evaluator.WithScheduler(evaluator.WithRuntime(context.Background(), rt)), d)
+	scope := evaluator.NewScope(nil)
+	elements := make([]evaluator.Object, 0, f.NArg()-1)
+	for _, arg := range f.Args()[1:] {
+		elements = append(elements, &evaluator.String{Value: arg})
+	}
+	scope.Set("args", &evaluator.Array{Elements: elements})
+	result := evaluator.Eval(ctx, program, scope)
+	if d.Quit() {
+		return ExitOK
+	}
+	if err, ok := result.(*evaluator.Error); ok {
+		reportError(stderr, fset, name, err)
+		return ExitRuntimeError
+	}
+	return ExitOK
+}
@@ -0,0 +1,363 @@
+// Package debugger pauses stang programs at breakpoints and steps through them, it is started by stang debug.
+//
+// The Debugger is an evaluator.Hook: it stops before statements and reads commands until one resumes the program.
+// A program stops at most once per line, so that a line holding several statements is stepped over at once.
+package debugger
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mode is how the program runs until it stops again
+type mode int
+
+const (
+	stepIn   mode = iota // stop at the next line
+	stepOver             // stop at the next line of the same call or of a caller
+	stepOut              // stop in the caller
+	run                  // stop at breakpoints only
+	detached             // never stop again
+)
+
+type breakpoint struct {
+	line      int
+	condition ast.Expression // stops only when it is truthy, if set
+}
+
+// Debugger runs the commands it reads from in whenever the program stops and writes their output to out
+type Debugger struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	name        string
+	lines       []string
+	breakpoints map[int]*breakpoint
+	mode        mode
+	depth       int // the depth of the call stack when stepping began
+	lastLine    int
+	lastDepth   int
+	lastCommand string
+	positions   map[*evaluator.Frame]token.Position // the statement each frame is at
+	main        token.Position                      // the statement the top level is at
+	quit        bool
+}
+
+// New returns a Debugger for the program called name whose source is src, it stops before the first statement
+func New(name, src string, in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		in:          bufio.NewScanner(in),
+		out:         out,
+		name:        name,
+		lines:       strings.Split(src, "\n"),
+		breakpoints: map[int]*breakpoint{},
+		positions:   map[*evaluator.Frame]token.Position{},
+	}
+}
+
+// Quit reports whether the program was stopped by the quit command
+func (d *Debugger) Quit() bool {
+	return d.quit
+}
+
+// Before stops the program before statements when a breakpoint or a step says so
+func (d *Debugger) Before(ctx context.Context, node ast.Node, pos token.Position, s *evaluator.Scope) evaluator.Object {
+	if _, ok := node.(ast.Statement); !ok || pos.Line == 0 || d.mode == detached {
+		return nil
+	}
+	frames := evaluator.Frames(ctx)
+	depth := len(frames)
+	if depth == 0 {
+		d.main = pos
+	} else {
+		d.positions[frames[0]] = pos
+	}
+	if len(d.positions) > 2*depth+64 {
+		// forget the calls that returned
+		current := make(map[*evaluator.Frame]token.Position, depth)
+		for _, f := range frames {
+			current[f] = d.positions[f]
+		}
+		d.positions = current
+	}
+	newLine := pos.Line != d.lastLine || depth != d.lastDepth
+	d.lastLine, d.lastDepth = pos.Line, depth
+	if !newLine {
+		return nil
+	}
+
+	stop := false
+	switch d.mode {
+	case stepIn:
+		stop = true
+	case stepOver:
+		stop = depth <= d.depth
+	case stepOut:
+		stop = depth < d.depth
+	}
+	if bp, ok := d.breakpoints[pos.Line]; ok && !stop {
+		if bp.condition == nil {
+			stop = true
+		} else {
+			value := evaluator.Eval(evaluator.WithHook(ctx, nil), bp.condition, s)
+			if value != nil && value.Type() == evaluator.ErrorObj {
+				d.printf("the condition of the breakpoint at line %d failed: %s\n", pos.Line, value.String(0))
+				stop = true
+			} else {
+				stop = value != nil && evaluator.Truthy(value)
+			}
+		}
+		if stop {
+			d.printf("breakpoint at line %d\n", pos.Line)
+		}
+	}
+	if !stop {
+		return nil
+	}
+	d.show(pos.Line)
+	return d.prompt(ctx, s, depth)
+}
+
+// prompt runs commands until one resumes the program
+func (d *Debugger) prompt(ctx context.Context, s *evaluator.Scope, depth int) evaluator.Object {
+	for {
+		d.printf("(stang) ")
+		if !d.in.Scan() {
+			// the program runs to its end when the commands run out
+			d.printf("\n")
+			d.mode = detached
+			return nil
+		}
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			line = d.lastCommand
+		}
+		d.lastCommand = line
+		command, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			command, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch command {
+		case "":
+		case "continue", "c":
+			d.mode = run
+			return nil
+		case "step", "s":
+			d.mode = stepIn
+			return nil
+		case "next", "n":
+			d.mode, d.depth = stepOver, depth
+			return nil
+		case "out", "o":
+			d.mode, d.depth = stepOut, depth
+			return nil
+		case "break", "b":
+			d.setBreakpoint(arg)
+		case "delete", "d":
+			line, err := strconv.Atoi(arg)
+			if _, ok := d.breakpoints[line]; err != nil || !ok {
+				d.printf("no breakpoint at line %q\n", arg)
+				continue
+			}
+			delete(d.breakpoints, line)
+		case "breakpoints", "i":
+			d.listBreakpoints()
+		case "stack", "bt":
+			d.stack(evaluator.Frames(ctx))
+		case "locals", "v":
+			d.locals(s)
+		case "print", "p":
+			d.print(ctx, arg, s)
+		case "list", "l":
+			d.list()
+		case "quit", "q":
+			d.quit = true
+			d.mode = detached
+			return &evaluator.Error{Msg: "quit debugger"}
+		case "help", "h":
+			d.printf("%s", help)
+		default:
+			d.printf("unknown command %q, try help\n", command)
+		}
+	}
+}
+
+const help = `continue, c          run to the next breakpoint
+step, s              run to the next line, entering calls
+next, n              run to the next line, stepping over calls
+out, o               run until the current call returns
+break, b LINE [if CONDITION]
+                     stop before LINE, only when CONDITION is truthy if given
+delete, d LINE       remove the breakpoint at LINE
+breakpoints, i       list the breakpoints
+stack, bt            show the calls in progress
+locals, v            show the variables in scope
+print, p EXPRESSION  evaluate EXPRESSION where the program stopped
+list, l              show the source around the current line
+quit, q              stop the program
+an empty line repeats the last command
+`
+
+func (d *Debugger) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(d.out, format, args...)
+}
+
+// show prints where the program stopped
+func (d *Debugger) show(line int) {
+	d.printf("%s:%d\n", d.name, line)
+	d.printf("%s\n", d.sourceLine(line, true))
+}
+
+func (d *Debugger) sourceLine(line int, current bool) string {
+	marker := " "
+	if current {
+		marker = ">"
+	}
+	text := ""
+	if line >= 1 && line <= len(d.lines) {
+		text = d.lines[line-1]
+	}
+	return strings.TrimRight(fmt.Sprintf("%s %4d | %s", marker, line, text), " ")
+}
+
+func (d *Debugger) list() {
+	for line := d.lastLine - 3; line <= d.lastLine+3; line++ {
+		if line >= 1 && line <= len(d.lines) {
+			d.printf("%s\n", d.sourceLine(line, line == d.lastLine))
+		}
+	}
+}
+
+func (d *Debugger) setBreakpoint(arg string) {
+	lineText, condText := arg, ""
+	if i := strings.Index(arg, " if "); i >= 0 {
+		lineText, condText = arg[:i], strings.TrimSpace(arg[i+4:])
+	}
+	line, err := strconv.Atoi(strings.TrimSpace(lineText))
+	if err != nil || line < 1 || line > len(d.lines) {
+		d.printf("bad line %q\n", lineText)
+		return
+	}
+	bp := &breakpoint{line: line}
+	if condText != "" {
+		cond, err := parseExpression(condText)
+		if err != nil {
+			d.printf("bad condition: %s\n", err)
+			return
+		}
+		bp.condition = cond
+	}
+	d.breakpoints[line] = bp
+	d.printf("set a breakpoint at line %d\n", line)
+}
+
+func (d *Debugger) listBreakpoints() {
+	if len(d.breakpoints) == 0 {
+		d.printf("no breakpoints\n")
+		return
+	}
+	var lines []int
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	for _, line := range lines {
+		if cond := d.breakpoints[line].condition; cond != nil {
+			d.printf("line %d if %s\n", line, cond.String())
+		} else {
+			d.printf("line %d\n", line)
+		}
+	}
+}
+
+// stack shows the calls in progress, the innermost first, and the line each one is at
+func (d *Debugger) stack(frames []*evaluator.Frame) {
+	for i, f := range frames {
+		d.printf("#%d %s at line %d\n", i, functionName(f), d.positions[f].Line)
+	}
+	d.printf("#%d main at line %d\n", len(frames), d.main.Line)
+}
+
+// functionName shows the function of f with its parameters
+func functionName(f *evaluator.Frame) string {
+	params := make([]string, 0, len(f.Function.Parameters))
+	for _, p := range f.Function.Parameters {
+		params = append(params, p.String())
+	}
+	return f.Name() + "(" + strings.Join(params, ", ") + ")"
+}
+
+// locals shows the variables of each scope from the innermost to the top level
+func (d *Debugger) locals(s *evaluator.Scope) {
+	for ; s != nil; s = s.Parent() {
+		if s.Parent() == nil {
+			d.printf("top level:\n")
+		}
+		for _, name := range s.Names() {
+			v, _ := s.GetCurrent(name)
+			d.printf("  %s = %s\n", name, summary(v))
+		}
+	}
+}
+
+// summary shows a value on a line
+func summary(v evaluator.Object) string {
+	if v == nil {
+		return "null"
+	}
+	text := v.String(0)
+	if fn, ok := v.(*evaluator.Function); ok {
+		params := make([]string, 0, len(fn.Parameters))
+		for _, p := range fn.Parameters {
+			params = append(params, p.String())
+		}
+		text = "function(" + strings.Join(params, ", ") + ")"
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i] + " ..."
+	}
+	if len(text) > 80 {
+		text = text[:77] + "..."
+	}
+	return text
+}
+
+// print evaluates an expression in the scope the program stopped in, without stopping in it
+func (d *Debugger) print(ctx context.Context, text string, s *evaluator.Scope) {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		d.printf("%s\n", strings.Join(p.Errors(), "\n"))
+		return
+	}
+	value := evaluator.Eval(evaluator.WithHook(ctx, nil), program, s)
+	if value == nil {
+		value = evaluator.NULL
+	}
+	d.printf("%s\n", value.String(0))
+}
+
+func parseExpression(text string) (ast.Expression, error) {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), ", "))
+	}
+	if len(program.Statements) != 1 {
+		return nil, fmt.Errorf("%q is not an expression", text)
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an expression", text)
+	}
+	return stmt.Expression, nil
+}
@@ -0,0 +1,116 @@
+package debugger
+
+import (
+	"bytes"
+	"context"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"strings"
+	"testing"
+)
+
+const program = `let square = function(n) {
+    let result = n * n
+    return result
+}
+let total = 0
+for (let i = 0; i < 3; i++) {
+    total += square(i)
+}
+print(total)
+`
+
+// session runs program under a debugger reading commands and returns what it printed
+func session(t *testing.T, commands string) (string, *Debugger, evaluator.Object) {
+	var out bytes.Buffer
+	d := New("prog.stg", program, strings.NewReader(commands), &out)
+	ctx := evaluator.WithHook(evaluator.WithRuntime(context.Background(), &evaluator.Runtime{Stdout: &out}), d)
+	result := evaluator.Eval(ctx, parser.New(lexer.New(program)).ParseProgram(), evaluator.NewScope(nil))
+	return out.String(), d, result
+}
+
+func TestDebugger(t *testing.T) {
+	tests := []struct {
+		commands string
+		expected string
+	}{
+		{"c\n", `prog.stg:1
+>    1 | let square = function(n) {
+(stang) 5
+`},
+		{"b 2 if n == 2\nc\nbt\nv\np n = 3\np [n, n * 2]\nc\n", `prog.stg:1
+>    1 | let square = function(n) {
+(stang) set a breakpoint at line 2
+(stang) breakpoint at line 2
+prog.stg:2
+>    2 |     let result = n * n
+(stang) #0 square(n) at line 2
+#1 main at line 7
+(stang)   n = 2
+top level:
+  square = function(n)
+  total = 1
+(stang) 3
+(stang) [3, 6]
+(stang) 10
+`},
+		{"n\nn\nn\ns\ns\nn\nn\n\nq\n", `prog.stg:1
+>    1 | let square = function(n) {
+(stang) prog.stg:5
+>    5 | let total = 0
+(stang) prog.stg:6
+>    6 | for (let i = 0; i < 3; i++) {
+(stang) prog.stg:7
+>    7 |     total += square(i)
+(stang) prog.stg:2
+>    2 |     let result = n * n
+(stang) prog.stg:3
+>    3 |     return result
+(stang) prog.stg:7
+>    7 |     total += square(i)
+(stang) prog.stg:7
+>    7 |     total += square(i)
+(stang) prog.stg:9
+>    9 | print(total)
+(stang) `},
+		{"b 3\nc\no\ni\nd 3\nd 3\nl\nc\n", `prog.stg:1
+>    1 | let square = function(n) {
+(stang) set a breakpoint at line 3
+(stang) breakpoint at line 3
+prog.stg:3
+>    3 |     return result
+(stang) prog.stg:7
+>    7 |     total += square(i)
+(stang) line 3
+(stang) (stang) no breakpoint at line "3"
+(stang)      4 | }
+     5 | let total = 0
+     6 | for (let i = 0; i < 3; i++) {
+>    7 |     total += square(i)
+     8 | }
+     9 | print(total)
+    10 |
+(stang) 5
+`},
+		{"b 99\nb x\nb 2 if let\nnope\n", `prog.stg:1
+>    1 | let square = function(n) {
+(stang) bad line "99"
+(stang) bad line "x"
+(stang) bad condition: [1:4]expected token to be IDENT, got EOF instead, [1:4]expected token to be =, got EOF instead
+(stang) unknown command "nope", try help
+(stang) ` + "\n5\n"},
+	}
+	for _, tt := range tests {
+		out, d, _ := session(t, tt.commands)
+		if out != tt.expected {
+			t.Errorf("%q: wrong session. got=\n%s\nwant=\n%s", tt.commands, out, tt.expected)
+		}
+		if d.Quit() != strings.HasSuffix(tt.commands, "q\n") {
+			t.Errorf("%q: Quit() = %t", tt.commands, d.Quit())
+		}
+	}
+	if _, _, result := session(t, "q\n"); result == nil || result.String(0) != "Error: quit debugger" {
+		t.Errorf("quit should stop the program. got=%v", result)
+	}
+}
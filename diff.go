@@ -0,0 +1,115 @@
+package stang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+// unifiedDiff returns the changes from a to b in unified format, or "" when they are equal
+func unifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	type edit struct {
+		op   byte // ' ', '-' or '+'
+		line string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			edits = append(edits, edit{' ', x[i]})
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', x[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', y[j]})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", name, name)
+	line := [2]int{1, 1} // the line of a and of b the next edit is at
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			line[0]++
+			line[1]++
+			k++
+			continue
+		}
+		// a hunk runs from the context before a change to the context after the last change close enough to it
+		start := k
+		for start > 0 && k-start < diffContext && edits[start-1].op == ' ' {
+			start--
+		}
+		end, unchanged := k, 0
+		for ; end < len(edits) && unchanged <= 2*diffContext; end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		end -= unchanged
+		if unchanged > diffContext {
+			end += diffContext
+		} else {
+			end += unchanged
+		}
+		from := [2]int{line[0] - (k - start), line[1] - (k - start)}
+		count := [2]int{}
+		var hunk strings.Builder
+		for _, e := range edits[start:end] {
+			hunk.WriteString(string(e.op) + e.line + "\n")
+			if e.op != '+' {
+				count[0]++
+			}
+			if e.op != '-' {
+				count[1]++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", from[0], count[0], from[1], count[1], hunk.String())
+		for _, e := range edits[k:end] {
+			if e.op != '+' {
+				line[0]++
+			}
+			if e.op != '-' {
+				line[1]++
+			}
+		}
+		k = end
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
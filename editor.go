@@ -0,0 +1,155 @@
+package stang
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// editor.go implements a small line editor for the REPL running on a terminal:
+// left and right move the cursor, up and down walk the history and tab completes the word before the cursor.
+// When the input is not a terminal the REPL falls back to reading plain lines, see scannerReader.
+
+// errInterrupt is returned by readLine when ctrl-c abandons the input
+var errInterrupt = errors.New("interrupted")
+
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// scannerReader reads plain lines, a line ending with a tab asks for completions instead of being evaluated
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (sr *scannerReader) readLine(prompt string) (string, error) {
+	_, _ = io.WriteString(sr.out, prompt)
+	if !sr.scanner.Scan() {
+		if err := sr.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return sr.scanner.Text(), nil
+}
+
+type lineEditor struct {
+	file     *os.File
+	in       *bufio.Reader
+	out      io.Writer
+	history  func() []string
+	complete func(line string) (int, []string)
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.file)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var line, saved []rune
+	pos := 0
+	history := e.history()
+	current := len(history) // the history entry shown, len(history) for the new line
+	e.refresh(prompt, line, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			_, _ = io.WriteString(e.out, "\n")
+			return string(line), nil
+		case 3: // ctrl-c
+			_, _ = io.WriteString(e.out, "^C\n")
+			return "", errInterrupt
+		case 4: // ctrl-d
+			if len(line) == 0 {
+				_, _ = io.WriteString(e.out, "\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case 127, 8: // backspace
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case '\t':
+			start, candidates := e.complete(string(line[:pos]))
+			word := []rune(string(line[:pos])[start:])
+			insert := []rune(longestCommonPrefix(candidates))
+			if len(insert) > len(word) {
+				insert = insert[len(word):]
+				line = append(line[:pos], append(insert, line[pos:]...)...)
+				pos += len(insert)
+			} else if len(candidates) > 1 {
+				_, _ = fmt.Fprintf(e.out, "\n%s\n", strings.Join(candidates, "  "))
+			}
+		case 27: // escape sequences of the arrow keys and friends
+			if b, _ := e.in.ReadByte(); b != '[' {
+				break
+			}
+			b, _ := e.in.ReadByte()
+			switch b {
+			case 'A':
+				if current > 0 {
+					if current == len(history) {
+						saved = line
+					}
+					current--
+					line = []rune(strings.ReplaceAll(history[current], "\n", " "))
+					pos = len(line)
+				}
+			case 'B':
+				if current < len(history) {
+					current++
+					if current == len(history) {
+						line = saved
+					} else {
+						line = []rune(strings.ReplaceAll(history[current], "\n", " "))
+					}
+					pos = len(line)
+				}
+			case 'C':
+				if pos < len(line) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '3':
+				if t, _ := e.in.ReadByte(); t == '~' && pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+		e.refresh(prompt, line, pos)
+	}
+}
+
+// refresh redraws the line and puts the cursor at pos
+func (e *lineEditor) refresh(prompt string, line []rune, pos int) {
+	out := "\r" + prompt + string(line) + "\x1b[K"
+	if back := len(line) - pos; back > 0 {
+		out += fmt.Sprintf("\x1b[%dD", back)
+	}
+	_, _ = io.WriteString(e.out, out)
+}
@@ -0,0 +1,224 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// assert.go implements the builtins tests are written with, assert, assertEqual and assertThrows fail with an error
+// starting with "assertion failed" and test registers a test for stang test to run.
+
+// Test is a test registered with test(name, fn)
+type Test struct {
+	Name string
+	Fn   Object
+}
+
+// RunTest calls the function of t, it returns an error if the test failed or the evaluator panicked
+func RunTest(ctx context.Context, t *Test) (result Object) {
+	defer Recover(&result)
+	ctx, exit, err := enter(ctx)
+	defer exit()
+	if err != nil {
+		return err
+	}
+	result = applyFunction(ctx, t.Fn, nil)
+	if result != nil && result.Type() == ErrorObj {
+		return result
+	}
+	return nil
+}
+
+const (
+	maxDifferences = 10  // how many differences assertEqual lists
+	maxDepth       = 100 // how deep it compares nested values
+)
+
+func init() {
+	builtins["assert"] = &Builtin{
+		Doc: "assert(condition, message) fails the test when condition is falsy, the message is optional",
+		Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "1 or 2", len(args))
+			}
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			if len(args) == 2 {
+				return newErrorf("assertion failed: %s", args[1].String(0))
+			}
+			return newErrorf("assertion failed")
+		},
+	}
+	builtins["assertEqual"] = &Builtin{
+		Doc: "assertEqual(actual, expected) fails the test when the values differ, arrays and hashes are compared element by element",
+		Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "2", len(args))
+			}
+			var differences []string
+			compare("", args[0], args[1], &differences, 0)
+			if len(differences) == 0 {
+				return NULL
+			}
+			if len(differences) > maxDifferences {
+				differences = append(differences[:maxDifferences], "...")
+			}
+			return newErrorf("assertion failed: values are not equal\n    expected: %s\n    got:      %s\n    %s",
+				inspect(args[1]), inspect(args[0]), strings.Join(differences, "\n    "))
+		},
+	}
+	builtins["assertThrows"] = &Builtin{
+		Doc: "assertThrows(fn, substring) fails the test unless calling fn fails with an error containing the optional substring, it returns the error message",
+		Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "1 or 2", len(args))
+			}
+			if err := checkNoParameters(args[0]); err != nil {
+				return err
+			}
+			var substring string
+			if len(args) == 2 {
+				s, ok := args[1].(*String)
+				if !ok {
+					return newError(ARGUMENTTYPEERROR, StringObj, args[1].Type())
+				}
+				substring = s.Value
+			}
+			result := applyFunction(ctx, args[0], nil)
+			if ctx.Err() != nil {
+				// the test timed out, that is not the error it expects
+				return newError(TIMEOUT)
+			}
+			err, ok := result.(*Error)
+			switch {
+			case !ok:
+				return newErrorf("assertion failed: expected an error, got %s", inspect(result))
+			case !strings.Contains(err.Msg, substring):
+				return newErrorf("assertion failed: expected an error containing %q, got %q", substring, err.Msg)
+			}
+			return &String{Value: err.Msg}
+		},
+	}
+	builtins["test"] = &Builtin{
+		Doc: "test(name, fn) registers fn as a test called name, stang test runs it",
+		Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "2", len(args))
+			}
+			name, ok := args[0].(*String)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, StringObj, args[0].Type())
+			}
+			if err := checkNoParameters(args[1]); err != nil {
+				return err
+			}
+			rt := runtimeOf(ctx)
+			rt.mu.Lock()
+			rt.Tests = append(rt.Tests, &Test{Name: name.Value, Fn: args[1]})
+			rt.mu.Unlock()
+			return NULL
+		},
+	}
+}
+
+func checkNoParameters(fn Object) Object {
+	switch f := fn.(type) {
+	case *Function:
+		if len(f.Parameters) != 0 {
+			return newErrorf("the function must not take arguments, it takes %d", len(f.Parameters))
+		}
+		return nil
+	case *Builtin:
+		return nil
+	}
+	return newError(ARGUMENTTYPEERROR, FunctionObj, fn.Type())
+}
+
+// compare appends the differences between got and want to differences, path locates them in the outermost values.
+// Values nested deeper than maxDepth are not compared, so that values containing themselves do not recurse forever.
+func compare(path string, got, want Object, differences *[]string, depth int) {
+	if len(*differences) > maxDifferences || depth > maxDepth {
+		return
+	}
+	where := path
+	if where == "" {
+		where = "value"
+	}
+	if got.Type() != want.Type() {
+		*differences = append(*differences, fmt.Sprintf("%s: expected %s %s, got %s %s", where, want.Type(), inspect(want), got.Type(), inspect(got)))
+		return
+	}
+	switch got := got.(type) {
+	case *Array:
+		want := want.(*Array)
+		for i := 0; i < len(got.Elements) || i < len(want.Elements); i++ {
+			at := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(got.Elements):
+				*differences = append(*differences, fmt.Sprintf("%s: missing %s", at, inspect(want.Elements[i])))
+			case i >= len(want.Elements):
+				*differences = append(*differences, fmt.Sprintf("%s: unexpected %s", at, inspect(got.Elements[i])))
+			default:
+				compare(at, got.Elements[i], want.Elements[i], differences, depth+1)
+			}
+		}
+	case *Hash:
+		want := want.(*Hash)
+		for _, pair := range want.OrderedPairs() {
+			at := path + "[" + inspect(pair.Key) + "]"
+			if other, ok := got.Pairs[pair.Key.(Hashable).HashKey()]; ok {
+				compare(at, other.Value, pair.Value, differences, depth+1)
+			} else {
+				*differences = append(*differences, fmt.Sprintf("%s: missing %s", at, inspect(pair.Value)))
+			}
+		}
+		for _, pair := range got.OrderedPairs() {
+			if _, ok := want.Pairs[pair.Key.(Hashable).HashKey()]; !ok {
+				at := path + "[" + inspect(pair.Key) + "]"
+				*differences = append(*differences, fmt.Sprintf("%s: unexpected %s", at, inspect(pair.Value)))
+			}
+		}
+	case *Boolean, *Null, *Integer, *Float, *String, *Time, *Duration:
+		if !evalEquality(got, want) {
+			*differences = append(*differences, fmt.Sprintf("%s: expected %s, got %s", where, inspect(want), inspect(got)))
+		}
+	default:
+		// functions, channels and the like are only equal to themselves
+		if got != want {
+			*differences = append(*differences, fmt.Sprintf("%s: expected %s, got a different %s", where, inspect(want), got.Type()))
+		}
+	}
+}
+
+// inspect shows a value the way it is written, so that the string "1" cannot be mistaken for the integer 1
+func inspect(obj Object) string {
+	return inspectAt(obj, 0)
+}
+
+func inspectAt(obj Object, stack int) string {
+	if stack == 10 {
+		return "..."
+	}
+	switch obj := obj.(type) {
+	case *String:
+		return strconv.Quote(obj.Value)
+	case *Array:
+		elements := make([]string, 0, len(obj.Elements))
+		for _, e := range obj.Elements {
+			elements = append(elements, inspectAt(e, stack+1))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		pairs := make([]string, 0, len(obj.Pairs))
+		for _, pair := range obj.OrderedPairs() {
+			pairs = append(pairs, inspectAt(pair.Key, stack+1)+": "+inspectAt(pair.Value, stack+1))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case nil:
+		return "nothing"
+	}
+	return obj.String(stack)
+}
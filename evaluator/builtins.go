@@ -1,14 +1,14 @@
 package evaluator
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"strconv"
 	"strings"
-	"time"
 )
 
 var builtins = map[string]*Builtin{
-	"len": {func(args ...Object) Object {
+	"len": {Doc: "len(x) returns the length of a string, array or hash", Fn: func(ctx context.Context, args ...Object) Object {
 		if len(args) != 1 {
 			return newError(ARGUMENTNUMERROR, "1", len(args))
 		}
@@ -23,8 +23,26 @@ var builtins = map[string]*Builtin{
 			return newError(ARGUMENTTYPEERROR, "STRING", args[0].Type())
 		}
 	}},
+	"methods": {Doc: "methods(x) returns the names of the methods of x, or of the functions of a module", Fn: func(ctx context.Context, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		elements := make([]Object, 0)
+		for _, name := range Methods(args[0]) {
+			elements = append(elements, &String{Value: name})
+		}
+		return &Array{Elements: elements}
+	}},
+	"freeze": {Doc: "freeze(x) makes the array or hash x and the arrays and hashes in it immutable and returns x", Fn: func(ctx context.Context, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		freeze(args[0])
+		return args[0]
+	}},
 	"number": {
-		func(args ...Object) Object {
+		Doc: "number(x) converts a string to an integer or a float",
+		Fn: func(ctx context.Context, args ...Object) Object {
 			if len(args) != 1 {
 				return newError(ARGUMENTNUMERROR, "1", len(args))
 			}
@@ -46,7 +64,8 @@ var builtins = map[string]*Builtin{
 		},
 	},
 	"string": {
-		func(args ...Object) Object {
+		Doc: "string(x) returns x as a string",
+		Fn: func(ctx context.Context, args ...Object) Object {
 			if len(args) != 1 {
 				return newError(ARGUMENTNUMERROR, "1", len(args))
 			}
@@ -59,7 +78,8 @@ var builtins = map[string]*Builtin{
 		},
 	},
 	"int": {
-		func(args ...Object) Object {
+		Doc: "int(x) converts a float, boolean or string to an integer",
+		Fn: func(ctx context.Context, args ...Object) Object {
 			if len(args) != 1 {
 				return newError(ARGUMENTNUMERROR, "1", len(args))
 			}
@@ -85,20 +105,80 @@ var builtins = map[string]*Builtin{
 		},
 	},
 	"now": {
-		func(args ...Object) Object {
+		Doc: "now() returns the current time",
+		Fn: func(ctx context.Context, args ...Object) Object {
 			if len(args) != 0 {
 				return newError(ARGUMENTNUMERROR, "0", len(args))
 			}
-			return &String{Value: time.Now().Format("2006-01-02 15:04:05")}
+			return &Time{Value: runtimeOf(ctx).now()}
 		},
 	},
+	"channel": {Doc: "channel(capacity=0) makes a channel buffering capacity values", Fn: func(ctx context.Context, args ...Object) Object {
+		if len(args) > 1 {
+			return newError(ARGUMENTNUMERROR, "0 or 1", len(args))
+		}
+		capacity := int64(0)
+		if len(args) == 1 {
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, IntegerObj, args[0].Type())
+			}
+			if n.Value < 0 {
+				return newErrorf("channel capacity must not be negative, got %d", n.Value)
+			}
+			capacity = n.Value
+		}
+		return NewChannel(int(capacity))
+	}},
 	"print": {
-		func(args ...Object) Object {
+		Doc: `print(values..., sep=", ", end="\n") prints the values separated by sep and followed by end`,
+		Fn: func(ctx context.Context, args ...Object) Object {
+			sep, end := option(ctx, "sep"), option(ctx, "end")
+			if sep.Type() != StringObj {
+				return newError(ARGUMENTTYPEERROR, StringObj, sep.Type())
+			}
+			if end.Type() != StringObj {
+				return newError(ARGUMENTTYPEERROR, StringObj, end.Type())
+			}
 			strs := make([]string, 0)
 			for _, arg := range args {
 				strs = append(strs, arg.String(0))
 			}
-			fmt.Println(strings.Join(strs, ", "))
+			_, _ = io.WriteString(runtimeOf(ctx).stdout(), strings.Join(strs, sep.(*String).Value)+end.(*String).Value)
+			return NULL
+		},
+		Options: map[string]Object{"sep": &String{Value: ", "}, "end": &String{Value: "\n"}},
+	},
+	"format": {
+		Doc: "format(layout, values...) formats the values like printf and returns the string",
+		Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) < 1 {
+				return newError(ARGUMENTNUMERROR, "at least 1", len(args))
+			}
+			if args[0].Type() != StringObj {
+				return newError(ARGUMENTTYPEERROR, StringObj, args[0].Type())
+			}
+			str, err := format(args[0].(*String).Value, args[1:])
+			if err != nil {
+				return err
+			}
+			return &String{Value: str}
+		},
+	},
+	"printf": {
+		Doc: "printf(layout, values...) prints the values formatted by layout, %v is any value",
+		Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) < 1 {
+				return newError(ARGUMENTNUMERROR, "at least 1", len(args))
+			}
+			if args[0].Type() != StringObj {
+				return newError(ARGUMENTTYPEERROR, StringObj, args[0].Type())
+			}
+			str, err := format(args[0].(*String).Value, args[1:])
+			if err != nil {
+				return err
+			}
+			_, _ = io.WriteString(runtimeOf(ctx).stdout(), str)
 			return NULL
 		},
 	},
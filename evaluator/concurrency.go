@@ -0,0 +1,384 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/yzbmz5913/stang/ast"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// concurrency.go implements spawn, the TASK and CHANNEL objects and select.
+// The evaluator is not safe for concurrent use, so tasks take turns on the token of a scheduler:
+// only the goroutine holding the token evaluates. It is handed over while a task blocks on a channel
+// or waits for another task, and every so often in loops and calls so that a busy task cannot starve the others.
+// Tasks share the context of the run, they are all cancelled when it times out.
+
+type scheduler struct {
+	token chan struct{} // holds the token while no goroutine is evaluating
+	tasks int32         // tasks still running, there is nobody to hand the token to without them
+	ticks uint32
+}
+
+// preemptInterval is the number of loop iterations and calls after which the token is handed over
+const preemptInterval = 1000
+
+type schedulerKey struct{}
+type evaluatingKey struct{}
+
+// WithScheduler returns a copy of ctx whose evaluations take turns with each other and with the tasks they spawn.
+// Eval of a program provides one when ctx has none, hosts evaluating several programs against one scope,
+// like a REPL, must share one between them so that the tasks of a program cannot race with the next.
+func WithScheduler(ctx context.Context) context.Context {
+	sc := &scheduler{token: make(chan struct{}, 1)}
+	sc.token <- struct{}{}
+	return context.WithValue(ctx, schedulerKey{}, sc)
+}
+
+func schedulerOf(ctx context.Context) *scheduler {
+	sc, _ := ctx.Value(schedulerKey{}).(*scheduler)
+	return sc
+}
+
+// enter takes the token for the evaluation of a program, unless ctx is already evaluating
+func enter(ctx context.Context) (context.Context, func(), Object) {
+	if ctx.Value(evaluatingKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+	if schedulerOf(ctx) == nil {
+		ctx = WithScheduler(ctx)
+	}
+	sc := schedulerOf(ctx)
+	if !sc.acquire(ctx) {
+		return ctx, func() {}, newError(TIMEOUT)
+	}
+	return context.WithValue(ctx, evaluatingKey{}, true), sc.release, nil
+}
+
+func (sc *scheduler) acquire(ctx context.Context) bool {
+	if sc == nil {
+		return true
+	}
+	select {
+	case <-sc.token:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (sc *scheduler) release() {
+	if sc == nil {
+		return
+	}
+	select {
+	case sc.token <- struct{}{}:
+	default:
+	}
+}
+
+// block hands the token over while wait blocks, wait must give up once ctx is done
+func (sc *scheduler) block(ctx context.Context, wait func()) Object {
+	sc.release()
+	wait()
+	if !sc.acquire(ctx) || ctx.Err() != nil {
+		return newError(TIMEOUT)
+	}
+	return nil
+}
+
+// preempt lets the other tasks run once in a while, it is called on every loop iteration and function call
+func preempt(ctx context.Context) Object {
+	sc := schedulerOf(ctx)
+	if sc == nil || atomic.LoadInt32(&sc.tasks) == 0 || atomic.AddUint32(&sc.ticks, 1)%preemptInterval != 0 {
+		return nil
+	}
+	return sc.block(ctx, func() {})
+}
+
+// Task is the handle of a function call started with spawn
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+func (t *Task) Type() ObjectType  { return TaskObj }
+func (t *Task) String(int) string { return "[task]" }
+func (t *Task) CallMethod(method string, args ...Object) Object {
+	return callBuiltinMethod(context.Background(), t, method, args)
+}
+
+var taskMethods = map[string]Method{
+	"wait": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		t := this.(*Task)
+		select {
+		case <-t.done:
+			return t.result
+		default:
+		}
+		if err := schedulerOf(ctx).block(ctx, func() {
+			select {
+			case <-t.done:
+			case <-ctx.Done():
+			}
+		}); err != nil {
+			return err
+		}
+		return t.result
+	},
+	"done": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		select {
+		case <-this.(*Task).done:
+			return TRUE
+		default:
+			return FALSE
+		}
+	},
+}
+
+func evalSpawnExpression(ctx context.Context, node *ast.SpawnExpression, s *Scope) Object {
+	function := Eval(ctx, node.Call.Function, s)
+	if function.Type() == ErrorObj {
+		return function
+	}
+	// the arguments are evaluated right away, only the call itself runs in the task
+	var call func(ctx context.Context) Object
+	if builtin, ok := function.(*Builtin); ok && builtin.Options != nil {
+		options, args, err := evalBuiltinArguments(ctx, builtin, node.Call.Arguments, s)
+		if err != nil {
+			return err
+		}
+		call = func(ctx context.Context) Object { return builtin.Fn(withOptions(ctx, options), args...) }
+	} else {
+		args := evalExpressions(ctx, node.Call.Arguments, s)
+		if len(args) == 1 && args[0].Type() == ErrorObj {
+			return args[0]
+		}
+		call = func(ctx context.Context) Object { return applyFunction(ctx, function, args) }
+	}
+
+	task := &Task{done: make(chan struct{})}
+	sc := schedulerOf(ctx)
+	if sc != nil {
+		atomic.AddInt32(&sc.tasks, 1)
+	}
+	go func() {
+		defer close(task.done)
+		if sc != nil {
+			defer atomic.AddInt32(&sc.tasks, -1)
+		}
+		if !sc.acquire(ctx) {
+			task.result = newError(TIMEOUT)
+			return
+		}
+		defer sc.release()
+		defer Recover(&task.result)
+		task.result = call(ctx)
+	}()
+	return task
+}
+
+// Channel passes objects between tasks, a channel created with a capacity buffers that many objects.
+// Closing it closes the closed signal rather than the Go channel, so that a send racing with close cannot panic.
+type Channel struct {
+	ch        chan Object
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewChannel(capacity int) *Channel {
+	return &Channel{ch: make(chan Object, capacity), closed: make(chan struct{})}
+}
+
+func (c *Channel) Type() ObjectType  { return ChannelObj }
+func (c *Channel) String(int) string { return "[channel]" }
+func (c *Channel) CallMethod(method string, args ...Object) Object {
+	return callBuiltinMethod(context.Background(), c, method, args)
+}
+
+// channelMethod builds a method of CHANNEL taking no arguments
+func channelMethod(f func(c *Channel) Object) Method {
+	return func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		return f(this.(*Channel))
+	}
+}
+
+var channelMethods = map[string]Method{
+	"send": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		return this.(*Channel).send(ctx, args[0])
+	},
+	"recv": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		v, _ := this.(*Channel).recv(ctx)
+		return v
+	},
+	"close": channelMethod(func(c *Channel) Object {
+		closed := false
+		c.closeOnce.Do(func() {
+			close(c.closed)
+			closed = true
+		})
+		if !closed {
+			return newError(CLOSEDCHANNEL, "close")
+		}
+		return NULL
+	}),
+	"closed": channelMethod(func(c *Channel) Object { return nativeBoolToBooleanObject(c.isClosed()) }),
+	"len":    channelMethod(func(c *Channel) Object { return &Integer{Value: int64(len(c.ch))} }),
+	"cap":    channelMethod(func(c *Channel) Object { return &Integer{Value: int64(cap(c.ch))} }),
+}
+
+func init() {
+	registerMethods(TaskObj, taskMethods)
+	registerMethods(ChannelObj, channelMethods)
+}
+
+func (c *Channel) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Channel) send(ctx context.Context, v Object) Object {
+	if c.isClosed() {
+		return newError(CLOSEDCHANNEL, "send")
+	}
+	select {
+	case c.ch <- v:
+		return NULL
+	default:
+	}
+	var result Object = NULL
+	if err := schedulerOf(ctx).block(ctx, func() {
+		select {
+		case c.ch <- v:
+		case <-c.closed:
+			result = newError(CLOSEDCHANNEL, "send")
+		case <-ctx.Done():
+		}
+	}); err != nil {
+		return err
+	}
+	return result
+}
+
+// recv returns the next object sent on c, or null and false once c is closed and drained
+func (c *Channel) recv(ctx context.Context) (Object, bool) {
+	select {
+	case v := <-c.ch:
+		return v, true
+	default:
+	}
+	if c.isClosed() {
+		return c.drain()
+	}
+	var v Object
+	ok := false
+	if err := schedulerOf(ctx).block(ctx, func() {
+		select {
+		case v = <-c.ch:
+			ok = true
+		case <-c.closed:
+			v, ok = c.drain()
+		case <-ctx.Done():
+		}
+	}); err != nil {
+		return err, true
+	}
+	return v, ok
+}
+
+// drain receives what is left in the buffer of a closed channel
+func (c *Channel) drain() (Object, bool) {
+	select {
+	case v := <-c.ch:
+		return v, true
+	default:
+		return NULL, false
+	}
+}
+
+func evalSelectExpression(ctx context.Context, node *ast.SelectExpression, s *Scope) Object {
+	var cases []reflect.SelectCase
+	var branches []int      // the case of node each entry of cases belongs to
+	var channels []*Channel // the channel of each entry
+	var closedSignal []bool // whether the entry fires because the channel was closed
+	fallback := -1
+	for i, c := range node.Cases {
+		if c.Channel == nil {
+			fallback = i
+			continue
+		}
+		obj := Eval(ctx, c.Channel, s)
+		if obj.Type() == ErrorObj {
+			return obj
+		}
+		ch, ok := obj.(*Channel)
+		if !ok {
+			return newError(ARGUMENTTYPEERROR, ChannelObj, obj.Type())
+		}
+		if c.Send != nil {
+			v := Eval(ctx, c.Send, s)
+			if v.Type() == ErrorObj {
+				return v
+			}
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.ch), Send: reflect.ValueOf(&v).Elem()})
+		} else {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.ch)})
+		}
+		// a closed channel makes both kinds of case ready, a send then fails and a recv gets null
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.closed)})
+		branches = append(branches, i, i)
+		channels = append(channels, ch, ch)
+		closedSignal = append(closedSignal, false, true)
+	}
+
+	// try without handing over the token first, then block unless there is a default
+	chosen, received, _ := reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectDefault}))
+	if chosen == len(cases) {
+		if fallback >= 0 {
+			branch(ctx, node, fallback)
+			return Eval(ctx, node.Cases[fallback].Body, NewScope(s))
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+		if err := schedulerOf(ctx).block(ctx, func() {
+			chosen, received, _ = reflect.Select(cases)
+		}); err != nil {
+			return err
+		}
+	}
+
+	c := node.Cases[branches[chosen]]
+	branch(ctx, node, branches[chosen])
+	var value Object = NULL
+	switch {
+	case closedSignal[chosen] && c.Send != nil:
+		return newError(CLOSEDCHANNEL, "send")
+	case closedSignal[chosen]:
+		value, _ = channels[chosen].drain()
+	case c.Send == nil:
+		value = received.Interface().(Object)
+	}
+	sub := NewScope(s)
+	if c.Name != nil {
+		sub.Set(c.Name.Value, value)
+	}
+	return Eval(ctx, c.Body, sub)
+}
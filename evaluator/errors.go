@@ -24,6 +24,14 @@ const (
 	TIMEOUT
 	NOTLVALUE
 	INDEXINT
+	NOTITERABLE
+	CLOSEDCHANNEL
+	CONSTASSIGN
+	FROZEN
+	NOTDESTRUCTURABLE
+	ARRAYPATTERN
+	HASHPATTERN
+	INTERNAL
 )
 
 var errorType = map[int]string{
@@ -47,6 +55,14 @@ var errorType = map[int]string{
 	TIMEOUT:           "evaluation timeout",
 	NOTLVALUE:         "the expression %s is not an lvalue",
 	INDEXINT:          "index must be integer",
+	NOTITERABLE:       "type %s is not iterable",
+	CLOSEDCHANNEL:     "%s on closed channel",
+	CONSTASSIGN:       "cannot %s constant %s",
+	FROZEN:            "cannot modify a frozen %s",
+	NOTDESTRUCTURABLE: "cannot destructure %s with %s pattern",
+	ARRAYPATTERN:      "cannot destructure an array of length %d with a pattern of length %s",
+	HASHPATTERN:       "cannot destructure a hash without key %s, the pattern gives it no default",
+	INTERNAL:          "internal error: %v",
 }
 
 func newError(t int, args ...interface{}) Object {
@@ -55,3 +71,11 @@ func newError(t int, args ...interface{}) Object {
 func newErrorf(format string, args ...interface{}) Object {
 	return &Error{Msg: fmt.Sprintf(format, args...)}
 }
+
+// Recover turns a panic of the evaluator into an error in *result instead of ending the process,
+// hosts defer it in the function calling Eval
+func Recover(result *Object) {
+	if r := recover(); r != nil {
+		*result = newError(INTERNAL, r)
+	}
+}
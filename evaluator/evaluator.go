@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/yzbmz5913/stang/ast"
 	"math"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -15,6 +17,28 @@ var (
 )
 
 func Eval(ctx context.Context, node ast.Node, s *Scope) Object {
+	result := eval(ctx, node, s)
+	if err, ok := result.(*Error); ok && err != errGeneratorClosed && !err.Pos.IsValid() {
+		// the innermost node an error comes from is where it happened
+		switch node.(type) {
+		case nil, *ast.Program, *ast.BlockStatement:
+		default:
+			err.Pos, err.End = node.Pos(), node.End()
+		}
+	}
+	return result
+}
+
+func eval(ctx context.Context, node ast.Node, s *Scope) Object {
+	if h := hookOf(ctx); h != nil && node != nil {
+		switch node.(type) {
+		case *ast.Program, *ast.BlockStatement:
+		default:
+			if err := h.Before(ctx, node, node.Pos(), s); err != nil {
+				return err
+			}
+		}
+	}
 	select {
 	case <-ctx.Done():
 		return newError(TIMEOUT)
@@ -28,7 +52,7 @@ func Eval(ctx context.Context, node ast.Node, s *Scope) Object {
 		case *ast.BlockStatement:
 			return evalBlockStatement(ctx, node.Statements, s)
 		case *ast.ReturnStatement:
-			return &ReturnValue{Value: Eval(ctx, node.ReturnValue, s)}
+			return evalReturnStatement(ctx, node, s)
 		case *ast.LetStatement:
 			return evalLetStatement(ctx, node, s)
 		case *ast.DeleteStatement:
@@ -43,6 +67,10 @@ func Eval(ctx context.Context, node ast.Node, s *Scope) Object {
 			return nativeBoolToBooleanObject(node.Value)
 		case *ast.StringLiteral:
 			return &String{Value: node.Value}
+		case *ast.TemplateLiteral:
+			return evalTemplateLiteral(ctx, node, s)
+		case *ast.TaggedTemplateExpression:
+			return evalTaggedTemplateExpression(ctx, node, s)
 		case *ast.ArrayLiteral:
 			return evalArrayLiteral(ctx, node, s)
 		case *ast.HashLiteral:
@@ -50,13 +78,16 @@ func Eval(ctx context.Context, node ast.Node, s *Scope) Object {
 		case *ast.NullExpression:
 			return NULL
 		case *ast.FunctionLiteral:
-			return &Function{Parameters: node.Parameters, Body: node.Body, Scope: s}
+			return &Function{Parameters: node.Parameters, Body: node.Body, Scope: s, IsGenerator: node.IsGenerator}
 		case *ast.PrefixExpression:
+			if node.Operator == "++" || node.Operator == "--" {
+				return evalUpdateExpression(ctx, node.Operator, node.Right, false, s)
+			}
 			return evalPrefixExpression(node.Operator, Eval(ctx, node.Right, s))
 		case *ast.InfixExpression:
 			return evalInfixExpression(Eval(ctx, node.Left, s), node.Operator, Eval(ctx, node.Right, s))
 		case *ast.PostfixExpression:
-			return evalPostfixExpression(Eval(ctx, node.Left, s), node.Operator)
+			return evalUpdateExpression(ctx, node.Operator, node.Left, true, s)
 		case *ast.IfExpression:
 			return evalIfExpression(ctx, node, s)
 		case *ast.WhileExpression:
@@ -67,6 +98,14 @@ func Eval(ctx context.Context, node ast.Node, s *Scope) Object {
 			return CONTINUE
 		case *ast.ForExpression:
 			return evalForExpression(ctx, node, s)
+		case *ast.ForOfExpression:
+			return evalForOfExpression(ctx, node, s)
+		case *ast.YieldExpression:
+			return evalYieldExpression(ctx, node, s)
+		case *ast.SpawnExpression:
+			return evalSpawnExpression(ctx, node, s)
+		case *ast.SelectExpression:
+			return evalSelectExpression(ctx, node, s)
 		case *ast.Identifier:
 			return evalIdentifier(node, s)
 		case *ast.TypeofExpression:
@@ -86,6 +125,11 @@ func Eval(ctx context.Context, node ast.Node, s *Scope) Object {
 }
 
 func evalProgram(ctx context.Context, stmts []ast.Statement, s *Scope) Object {
+	ctx, exit, err := enter(ctx)
+	defer exit()
+	if err != nil {
+		return err
+	}
 	var result Object
 	for _, stmt := range stmts {
 		if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok {
@@ -95,7 +139,7 @@ func evalProgram(ctx context.Context, stmts []ast.Statement, s *Scope) Object {
 		}
 		result = Eval(ctx, stmt, s)
 		if returnValue, ok := result.(*ReturnValue); ok {
-			return returnValue.Value
+			return finishTailCall(ctx, returnValue.Value)
 		}
 		if err, ok := result.(*Error); ok {
 			return err
@@ -104,6 +148,34 @@ func evalProgram(ctx context.Context, stmts []ast.Statement, s *Scope) Object {
 	return result
 }
 
+func evalReturnStatement(ctx context.Context, node *ast.ReturnStatement, s *Scope) Object {
+	call, ok := node.ReturnValue.(*ast.CallExpression)
+	if !ok {
+		return &ReturnValue{Value: Eval(ctx, node.ReturnValue, s)}
+	}
+	function := Eval(ctx, call.Function, s)
+	if function.Type() == ErrorObj {
+		return function
+	}
+	fn, ok := function.(*Function)
+	if !ok || fn.IsGenerator {
+		return &ReturnValue{Value: Eval(ctx, call, s)}
+	}
+	args := evalExpressions(ctx, call.Arguments, s)
+	if len(args) == 1 && args[0].Type() == ErrorObj {
+		return args[0]
+	}
+	return &ReturnValue{Value: &tailCall{function: fn, args: args}}
+}
+
+// finishTailCall makes the call a return in tail position left pending, for bodies not run by applyFunction
+func finishTailCall(ctx context.Context, result Object) Object {
+	if tc, ok := result.(*tailCall); ok {
+		return applyFunction(ctx, tc.function, tc.args)
+	}
+	return result
+}
+
 func evalBlockStatement(ctx context.Context, stmts []ast.Statement, s *Scope) Object {
 	var result Object
 	for _, statement := range stmts {
@@ -126,16 +198,48 @@ func evalBlockStatement(ctx context.Context, stmts []ast.Statement, s *Scope) Ob
 			}
 		}
 	}
+	if result == nil {
+		// an empty block is worth null like any other expression without a value
+		return NULL
+	}
 	return result
 }
 
 func evalLetStatement(ctx context.Context, node *ast.LetStatement, s *Scope) Object {
+	if _, ok := node.Name.(*ast.Identifier); !ok {
+		return evalLetPattern(ctx, node, s)
+	}
 	if _, ok := s.GetCurrent(node.Name.String()); ok {
 		return newError(REDEFINE, node.Name.String())
 	}
 	v := Eval(ctx, node.Value, s)
-	if v.Type() != ErrorObj {
-		return s.Set(node.Name.String(), v)
+	if v.Type() == ErrorObj {
+		return v
+	}
+	if node.IsConst() {
+		return s.SetConst(node.Name.String(), v)
+	}
+	return s.Set(node.Name.String(), v)
+}
+
+// evalLetPattern defines the variables of a let destructuring its value, like let [a, b] = value
+func evalLetPattern(ctx context.Context, node *ast.LetStatement, s *Scope) Object {
+	v := Eval(ctx, node.Value, s)
+	if v.Type() == ErrorObj {
+		return v
+	}
+	err := bind(ctx, node.Name, v, s, func(target ast.Expression, v Object) Object {
+		name := target.String()
+		if _, ok := s.GetCurrent(name); ok {
+			return newError(REDEFINE, name)
+		}
+		if node.IsConst() {
+			return s.SetConst(name, v)
+		}
+		return s.Set(name, v)
+	})
+	if err != nil {
+		return err
 	}
 	return v
 }
@@ -144,6 +248,9 @@ func evalDeleteStatement(ctx context.Context, node *ast.DeleteStatement, s *Scop
 	value := node.Value
 	switch deleted := value.(type) {
 	case *ast.Identifier:
+		if s.IsConst(deleted.Value) {
+			return newError(CONSTASSIGN, "delete", deleted.Value)
+		}
 		old := Eval(ctx, value, s)
 		s.Delete(deleted.Value)
 		return old
@@ -152,6 +259,9 @@ func evalDeleteStatement(ctx context.Context, node *ast.DeleteStatement, s *Scop
 		index := Eval(ctx, deleted.Index, s)
 		switch l := left.(type) {
 		case *Array:
+			if l.Frozen {
+				return newError(FROZEN, l.Type())
+			}
 			i, e := calcIndex(len(l.Elements), index, false)
 			if e != nil {
 				return e
@@ -160,6 +270,9 @@ func evalDeleteStatement(ctx context.Context, node *ast.DeleteStatement, s *Scop
 			l.Elements[i] = NULL
 			return old
 		case *Hash:
+			if l.Frozen {
+				return newError(FROZEN, l.Type())
+			}
 			if hashable, ok := index.(Hashable); ok {
 				old, ok := l.Pairs[hashable.HashKey()]
 				if !ok {
@@ -184,12 +297,18 @@ func nativeBoolToBooleanObject(b bool) *Boolean {
 func isNumber(obj Object) bool {
 	return obj.Type() == IntegerObj || obj.Type() == FloatObj
 }
+func isTimeOrDuration(obj Object) bool {
+	return obj.Type() == TimeObj || obj.Type() == DurationObj
+}
 
 func evalIfExpression(ctx context.Context, node *ast.IfExpression, s *Scope) Object {
 	cond := Eval(ctx, node.Condition, s)
 	if isTruthy(cond) {
+		branch(ctx, node, 0)
 		return Eval(ctx, node.Consequence, s)
-	} else if node.Alternative != nil {
+	}
+	branch(ctx, node, 1)
+	if node.Alternative != nil {
 		return Eval(ctx, node.Alternative, s)
 	}
 	return NULL
@@ -204,9 +323,12 @@ func evalWhileExpression(ctx context.Context, wl *ast.WhileExpression, scope *Sc
 	}
 
 	var result Object
-	for isTruthy(condition) {
+	for loops(ctx, wl, condition) {
+		if err := preempt(ctx); err != nil {
+			return err
+		}
 		result = Eval(ctx, wl.Body, innerScope)
-		if result.Type() == ErrorObj {
+		if result != nil && result.Type() == ErrorObj {
 			return result
 		}
 
@@ -253,7 +375,10 @@ func evalForExpression(ctx context.Context, node *ast.ForExpression, s *Scope) O
 	}
 
 	var result Object
-	for isTruthy(condition) {
+	for loops(ctx, node, condition) {
+		if err := preempt(ctx); err != nil {
+			return err
+		}
 		newSubScope := NewScope(innerScope)
 		result = Eval(ctx, node.Body, newSubScope)
 
@@ -306,6 +431,66 @@ func evalForExpression(ctx context.Context, node *ast.ForExpression, s *Scope) O
 	return result
 }
 
+func evalForOfExpression(ctx context.Context, node *ast.ForOfExpression, s *Scope) Object {
+	iterable := Eval(ctx, node.Iterable, s)
+	if iterable.Type() == ErrorObj {
+		return iterable
+	}
+	next, stop, e := iterate(ctx, iterable)
+	if e != nil {
+		return e
+	}
+	defer stop()
+
+	var result Object
+	for {
+		if err := preempt(ctx); err != nil {
+			return err
+		}
+		element, ok := next()
+		if !ok {
+			branch(ctx, node, 1)
+			break
+		}
+		if element.Type() == ErrorObj {
+			return element
+		}
+		branch(ctx, node, 0)
+		sub := NewScope(s)
+		sub.Set(node.Name.Value, element)
+		result = Eval(ctx, node.Body, sub)
+		if result != nil && result.Type() == ErrorObj {
+			return result
+		}
+		if _, ok := result.(*Break); ok {
+			break
+		}
+		if v, ok := result.(*ReturnValue); ok {
+			return v
+		}
+	}
+
+	if result == nil || result.Type() == BreakObj || result.Type() == ContinueObj {
+		return NULL
+	}
+	return result
+}
+
+// loops reports whether the loop node goes on with the condition it checked, a for without a condition always does
+func loops(ctx context.Context, node ast.Node, condition Object) bool {
+	if isTruthy(condition) {
+		branch(ctx, node, 0)
+		return true
+	}
+	branch(ctx, node, 1)
+	return false
+}
+
+// Truthy reports whether o counts as true in a condition, false, null and zero do not
+func Truthy(o Object) bool {
+	return isTruthy(o)
+}
+
 func isTruthy(o Object) bool {
 	switch obj := o.(type) {
 	case *Boolean:
@@ -333,6 +518,9 @@ func evalIdentifier(node *ast.Identifier, s *Scope) Object {
 	var ok bool
 	if v, ok = s.Get(key); !ok {
 		if v, ok = builtins[key]; !ok {
+			if m, ok := modules[key]; ok {
+				return m
+			}
 			return newError(UNKNOWNIDENT, key)
 		}
 	}
@@ -344,13 +532,36 @@ func evalTypeofExpression(ctx context.Context, node *ast.TypeofExpression, s *Sc
 }
 
 func evalAssignExpression(ctx context.Context, node *ast.AssignExpression, s *Scope) Object {
+	if ident, ok := node.Name.(*ast.Identifier); ok && s.IsConst(ident.Value) {
+		return newError(CONSTASSIGN, "assign to", ident.Value)
+	}
 	newValue := Eval(ctx, node.Value, s)
 	if newValue.Type() == ErrorObj {
 		return newValue
 	}
+	switch node.Name.(type) {
+	case *ast.ArrayPattern, *ast.HashPattern:
+		// [a, b] = [b, a]
+		err := bind(ctx, node.Name, newValue, s, func(target ast.Expression, v Object) Object {
+			if ident, ok := target.(*ast.Identifier); ok && s.IsConst(ident.Value) {
+				return newError(CONSTASSIGN, "assign to", ident.Value)
+			}
+			return assign(ctx, target, "=", v, s)
+		})
+		if err != nil {
+			return err
+		}
+		return newValue
+	}
+	return assign(ctx, node.Name, node.Token.Literal, newValue, s)
+}
+
+// assign sets the variable or the element target refers to to newValue or, unless op is =, to the result of op
+// on its value and newValue
+func assign(ctx context.Context, target ast.Expression, op string, newValue Object, s *Scope) Object {
 	var name string
 	var oldValue Object
-	switch nodeType := node.Name.(type) {
+	switch nodeType := target.(type) {
 	case *ast.Identifier:
 		name = nodeType.Value
 	case *ast.IndexExpression:
@@ -373,9 +584,8 @@ func evalAssignExpression(ctx context.Context, node *ast.AssignExpression, s *Sc
 			return newError(UNKNOWNIDENT, name)
 		}
 	}
-	op := node.Token.Literal
 	if op == "=" {
-		switch nodeType := node.Name.(type) {
+		switch nodeType := target.(type) {
 		case *ast.Identifier:
 			name := nodeType.Value
 			v, _ := s.Reset(name, newValue)
@@ -386,7 +596,7 @@ func evalAssignExpression(ctx context.Context, node *ast.AssignExpression, s *Sc
 	case IntegerObj, FloatObj:
 		return evalNumberAssignExpression(name, oldValue, newValue, op, s)
 	case StringObj:
-		if _, ok := node.Name.(*ast.IndexExpression); ok {
+		if _, ok := target.(*ast.IndexExpression); ok {
 			return newErrorf("string is immutable")
 		}
 		if op == "+=" && newValue.Type() == StringObj {
@@ -395,11 +605,11 @@ func evalAssignExpression(ctx context.Context, node *ast.AssignExpression, s *Sc
 		}
 		return newError(INFIXOP, op, oldValue.Type(), newValue.Type())
 	case ArrayObj:
-		return evalArrayIndexExpressionFunc(ctx, node.Name.(*ast.IndexExpression), s, op, newValue, func(objects []Object, idx int) Object {
-			return updateArray(objects, idx, op, newValue)
+		return evalArrayIndexExpressionFunc(ctx, target.(*ast.IndexExpression), s, op, newValue, func(a *Array, idx int) Object {
+			return updateArray(a, idx, op, newValue)
 		})
 	case HashObj:
-		return evalHashIndexExpressionFunc(ctx, node.Name.(*ast.IndexExpression), s, op, newValue, func(hash *Hash, key Object) Object {
+		return evalHashIndexExpressionFunc(ctx, target.(*ast.IndexExpression), s, op, newValue, func(hash *Hash, key Object) Object {
 			return updateHash(hash, key, op, newValue)
 		})
 	}
@@ -469,10 +679,6 @@ func evalPrefixExpression(op string, right Object) Object {
 		return evalBangExpression(right)
 	case "-":
 		return evalMinusPrefixExpression(right)
-	case "++":
-		return evalIncrPrefixExpression(right)
-	case "--":
-		return evalDecrPrefixExpression(right)
 	default:
 		return newError(PREFIXOP, op, right.Type())
 	}
@@ -498,23 +704,12 @@ func evalInfixExpression(left Object, op string, right Object) Object {
 		return nativeBoolToBooleanObject(!evalEquality(left, right))
 	case left.Type() == StringObj || right.Type() == StringObj:
 		return evalStringInfixExpression(left, op, right)
+	case isTimeOrDuration(left) || isTimeOrDuration(right):
+		return evalTimeInfixExpression(left, op, right)
 	default:
 		return newError(INFIXOP, op, left.Type(), right.Type())
 	}
 }
-func evalPostfixExpression(left Object, op string) Object {
-	if left.Type() == ErrorObj {
-		return left
-	}
-	switch op {
-	case "++":
-		return evalIncrPostfixExpression(left)
-	case "--":
-		return evalDecrPostfixExpression(left)
-	default:
-		return newError(POSTFIXOP, op, left.Type())
-	}
-}
 
 func evalEquality(left Object, right Object) bool {
 	if left.Type() != right.Type() {
@@ -531,6 +726,10 @@ func evalEquality(left Object, right Object) bool {
 		return left.(*Float).Value == right.(*Float).Value
 	case *String:
 		return left.(*String).Value == right.(*String).Value
+	case *Time:
+		return left.(*Time).Value.Equal(right.(*Time).Value)
+	case *Duration:
+		return left.(*Duration).Value == right.(*Duration).Value
 	}
 	return false
 }
@@ -604,58 +803,105 @@ func evalStringInfixExpression(left Object, op string, right Object) Object {
 	}
 }
 
-func evalIncrPrefixExpression(right Object) Object {
-	switch r := right.(type) {
-	case *Integer:
-		r.Value++
-		return &Integer{Value: r.Value}
-	case *Float:
-		r.Value++
-		return &Float{Value: r.Value}
-	default:
-		return NULL
+func evalTemplateLiteral(ctx context.Context, node *ast.TemplateLiteral, s *Scope) Object {
+	values := evalExpressions(ctx, node.Expressions, s)
+	if len(values) == 1 && values[0].Type() == ErrorObj {
+		return values[0]
+	}
+	var out strings.Builder
+	for i, part := range node.Parts {
+		out.WriteString(part)
+		if i < len(values) {
+			out.WriteString(values[i].String(0))
+		}
 	}
+	return &String{Value: out.String()}
 }
 
-func evalIncrPostfixExpression(left Object) Object {
-	switch r := left.(type) {
-	case *Integer:
-		v := r.Value
-		r.Value++
-		return &Integer{Value: v}
-	case *Float:
-		v := r.Value
-		r.Value++
-		return &Float{Value: v}
-	default:
-		return NULL
+// evalTaggedTemplateExpression calls the tag with two arrays: the literal parts and the interpolated values
+func evalTaggedTemplateExpression(ctx context.Context, node *ast.TaggedTemplateExpression, s *Scope) Object {
+	tag := Eval(ctx, node.Tag, s)
+	if tag.Type() == ErrorObj {
+		return tag
 	}
+	values := evalExpressions(ctx, node.Template.Expressions, s)
+	if len(values) == 1 && values[0].Type() == ErrorObj {
+		return values[0]
+	}
+	parts := make([]Object, 0, len(node.Template.Parts))
+	for _, part := range node.Template.Parts {
+		parts = append(parts, &String{Value: part})
+	}
+	return applyFunction(ctx, tag, []Object{&Array{Elements: parts}, &Array{Elements: values}})
 }
-func evalDecrPrefixExpression(right Object) Object {
-	switch r := right.(type) {
-	case *Integer:
-		r.Value--
-		return &Integer{Value: r.Value}
-	case *Float:
-		r.Value--
-		return &Float{Value: r.Value}
+
+// evalUpdateExpression evaluates ++ or -- on target. The new number is stored like by += rather than changing the
+// old one, which other variables and elements may share. A postfix returns the number before the update.
+func evalUpdateExpression(ctx context.Context, op string, target ast.Expression, postfix bool, s *Scope) Object {
+	one, delta := &Integer{Value: 1}, map[string]string{"++": "+=", "--": "-="}[op]
+	var old, updated Object
+	switch t := target.(type) {
+	case *ast.Identifier:
+		if s.IsConst(t.Value) {
+			return newError(CONSTASSIGN, map[string]string{"++": "increment", "--": "decrement"}[op], t.Value)
+		}
+		if old = Eval(ctx, t, s); !isNumber(old) {
+			return nonNumber(old)
+		}
+		updated = compound(old, delta, one)
+		s.Reset(t.Value, updated)
+	case *ast.IndexExpression:
+		left := Eval(ctx, t.Left, s)
+		if left.Type() == ErrorObj {
+			return left
+		}
+		index := Eval(ctx, t.Index, s)
+		if index.Type() == ErrorObj {
+			return index
+		}
+		switch c := left.(type) {
+		case *Array:
+			i, err := calcIndex(len(c.Elements), index, false)
+			if err != nil {
+				return err
+			}
+			if old = c.Elements[i]; !isNumber(old) {
+				return nonNumber(old)
+			}
+			updated = updateArray(c, i, delta, one)
+		case *Hash:
+			hashable, ok := index.(Hashable)
+			if !ok {
+				return newError(NOTHASHABLE, index.Type())
+			}
+			if old = c.Pairs[hashable.HashKey()].Value; old == nil || !isNumber(old) {
+				return nonNumber(old)
+			}
+			updated = updateHash(c, index, delta, one)
+		case *String:
+			return newErrorf("string is immutable")
+		default:
+			return newError(NOINDEXERROR, left.Type())
+		}
 	default:
-		return NULL
+		// like ++1, there is nothing to store the number in
+		if old = Eval(ctx, target, s); !isNumber(old) {
+			return nonNumber(old)
+		}
+		updated = compound(old, delta, one)
+	}
+	if postfix && updated.Type() != ErrorObj {
+		return old
 	}
+	return updated
 }
-func evalDecrPostfixExpression(left Object) Object {
-	switch r := left.(type) {
-	case *Integer:
-		v := r.Value
-		r.Value--
-		return &Integer{Value: v}
-	case *Float:
-		v := r.Value
-		r.Value--
-		return &Float{Value: v}
-	default:
-		return NULL
+
+// nonNumber is what ++ and -- give for v, which is not a number: v if it is an error, null otherwise
+func nonNumber(v Object) Object {
+	if v != nil && v.Type() == ErrorObj {
+		return v
 	}
+	return NULL
 }
 
 func evalMinusPrefixExpression(right Object) Object {
@@ -701,6 +947,13 @@ func evalCallExpression(ctx context.Context, node *ast.CallExpression, s *Scope)
 		return function
 	}
 
+	if builtin, ok := function.(*Builtin); ok && builtin.Options != nil {
+		options, args, err := evalBuiltinArguments(ctx, builtin, node.Arguments, s)
+		if err != nil {
+			return err
+		}
+		return builtin.Fn(withOptions(ctx, options), args...)
+	}
 	args := evalExpressions(ctx, node.Arguments, s)
 	if len(args) == 1 && args[0].Type() == ErrorObj {
 		return args[0]
@@ -708,9 +961,46 @@ func evalCallExpression(ctx context.Context, node *ast.CallExpression, s *Scope)
 	return applyFunction(ctx, function, args)
 }
 
+// evalBuiltinArguments separates keyword options like sep="|" from the positional arguments
+func evalBuiltinArguments(ctx context.Context, builtin *Builtin, arguments []ast.Expression, s *Scope) (map[string]Object, []Object, Object) {
+	options := make(map[string]Object, len(builtin.Options))
+	for name, value := range builtin.Options {
+		options[name] = value
+	}
+	positional := make([]ast.Expression, 0, len(arguments))
+	for _, argument := range arguments {
+		if assign, ok := argument.(*ast.AssignExpression); ok && assign.Token.Literal == "=" {
+			if name, ok := assign.Name.(*ast.Identifier); ok {
+				if _, ok := builtin.Options[name.Value]; ok {
+					value := Eval(ctx, assign.Value, s)
+					if value.Type() == ErrorObj {
+						return nil, nil, value
+					}
+					options[name.Value] = value
+					continue
+				}
+			}
+		}
+		positional = append(positional, argument)
+	}
+	args := evalExpressions(ctx, positional, s)
+	if len(args) == 1 && args[0].Type() == ErrorObj {
+		return nil, nil, args[0]
+	}
+	return options, args, nil
+}
+
 func evalExpressions(ctx context.Context, expressions []ast.Expression, s *Scope) []Object {
 	results := make([]Object, 0)
 	for _, argument := range expressions {
+		if spread, ok := argument.(*ast.SpreadExpression); ok {
+			elements, err := evalSpread(ctx, spread, s)
+			if err != nil {
+				return []Object{err}
+			}
+			results = append(results, elements...)
+			continue
+		}
 		result := Eval(ctx, argument, s)
 		if result.Type() == ErrorObj {
 			return []Object{result}
@@ -720,28 +1010,109 @@ func evalExpressions(ctx context.Context, expressions []ast.Expression, s *Scope
 	return results
 }
 
+// iterableTypes are the types ...value spreads into an array or the arguments of a call
+const iterableTypes = ArrayObj + ", " + StringObj + ", " + HashObj + ", " + IteratorObj + ", " + GeneratorObj + " or " + ChannelObj
+
+// evalSpread returns the elements of the value spread by node, like for-of would loop over them
+func evalSpread(ctx context.Context, node *ast.SpreadExpression, s *Scope) ([]Object, Object) {
+	value := Eval(ctx, node.Value, s)
+	if value.Type() == ErrorObj {
+		return nil, value
+	}
+	next, stop, e := iterate(ctx, value)
+	if e != nil {
+		return nil, spreadError(node, iterableTypes, value)
+	}
+	defer stop()
+	elements := make([]Object, 0)
+	for {
+		if err := preempt(ctx); err != nil {
+			return nil, err
+		}
+		element, ok := next()
+		if !ok {
+			return elements, nil
+		}
+		if element.Type() == ErrorObj {
+			return nil, element
+		}
+		elements = append(elements, element)
+	}
+}
+
+// spreadError reports that node spreads value, which is not of the expected types, at the span of node rather than
+// the literal or the call it is in
+func spreadError(node *ast.SpreadExpression, expected string, value Object) Object {
+	err := newError(ARGUMENTTYPEERROR, expected, value.Type()).(*Error)
+	err.Pos, err.End = node.Pos(), node.End()
+	return err
+}
+
 func applyFunction(ctx context.Context, funcObj Object, args []Object) Object {
 	switch function := funcObj.(type) {
 	case *Function:
-		sub := NewScope(function.Scope)
-		for i, param := range function.Parameters {
-			sub.Set(param.Value, args[i])
-		}
-		result := Eval(ctx, function.Body, sub)
-		if rv, ok := result.(*ReturnValue); ok {
-			return rv.Value
+		caller := ctx
+		for {
+			if err := preempt(ctx); err != nil {
+				return err
+			}
+			if len(args) < len(function.Parameters) {
+				// a spread may leave parameters without arguments
+				return newError(ARGUMENTNUMERROR, strconv.Itoa(len(function.Parameters)), len(args))
+			}
+			sub := NewScope(function.Scope)
+			for i, param := range function.Parameters {
+				if ident, ok := param.(*ast.Identifier); ok {
+					sub.Set(ident.Value, args[i])
+					continue
+				}
+				err := bind(ctx, param, args[i], sub, func(target ast.Expression, v Object) Object {
+					return sub.Set(target.String(), v)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if function.IsGenerator {
+				return newGenerator(ctx, function.Body, sub)
+			}
+			if hookOf(caller) != nil {
+				// a call in tail position replaces the frame of the call it returns from
+				ctx = enterFrame(caller, function, sub)
+			}
+			result := Eval(ctx, function.Body, sub)
+			if rv, ok := result.(*ReturnValue); ok {
+				result = rv.Value
+			}
+			// a return in tail position hands over the next call instead of making it, see tailCall
+			tc, ok := result.(*tailCall)
+			if !ok {
+				return result
+			}
+			function, args = tc.function, tc.args
 		}
-		return result
 	case *Builtin:
-		return function.Fn(args...)
+		return function.Fn(withOptions(ctx, function.Options), args...)
+	case *Module:
+		if function.Call != nil {
+			return applyFunction(ctx, function.Call, args)
+		}
 	}
 	return newError(NOTFUNC, funcObj.String(0))
 }
 
-func evalArrayLiteral(ctx context.Context, node *ast.ArrayLiteral, s *Scope) *Array {
+func evalArrayLiteral(ctx context.Context, node *ast.ArrayLiteral, s *Scope) Object {
 	arr := &Array{}
 	elements := make([]Object, 0)
 	for _, expr := range node.Elements {
+		if spread, ok := expr.(*ast.SpreadExpression); ok {
+			spreadElements, err := evalSpread(ctx, spread, s)
+			if err != nil {
+				return err
+			}
+			elements = append(elements, spreadElements...)
+			continue
+		}
 		elements = append(elements, Eval(ctx, expr, s))
 	}
 	arr.Elements = elements
@@ -755,7 +1126,7 @@ func evalIndexExpression(ctx context.Context, node *ast.IndexExpression, s *Scop
 	} else {
 		switch e.(type) {
 		case *Array:
-			return evalArrayIndexExpressionFunc(ctx, node, s, "", nil, func(arr []Object, idx int) Object { return arr[idx] })
+			return evalArrayIndexExpressionFunc(ctx, node, s, "", nil, func(arr *Array, idx int) Object { return arr.Elements[idx] })
 		case *String:
 			return evalStringIndexExpression(ctx, node, s)
 		case *Hash:
@@ -794,7 +1165,7 @@ func evalStringIndexExpression(ctx context.Context, node *ast.IndexExpression, s
 	}
 }
 
-func evalArrayIndexExpressionFunc(ctx context.Context, node *ast.IndexExpression, s *Scope, op string, newValue Object, f func([]Object, int) Object) Object {
+func evalArrayIndexExpressionFunc(ctx context.Context, node *ast.IndexExpression, s *Scope, op string, newValue Object, f func(*Array, int) Object) Object {
 	left := Eval(ctx, node.Left, s)
 	if left.Type() == ErrorObj {
 		return left
@@ -809,7 +1180,7 @@ func evalArrayIndexExpressionFunc(ctx context.Context, node *ast.IndexExpression
 		if i, e := calcIndex(length, index, false); e != nil {
 			return e
 		} else {
-			return f(l.Elements, i)
+			return f(l, i)
 		}
 	case *String:
 		return newErrorf("string is immutable")
@@ -819,207 +1190,51 @@ func evalArrayIndexExpressionFunc(ctx context.Context, node *ast.IndexExpression
 		return newErrorf("%s is not a hash", left.String(0))
 	}
 }
-func updateArray(objects []Object, idx int, op string, newValue Object) Object {
-	if op == "=" {
-		objects[idx] = newValue
-		return newValue
+func updateArray(a *Array, idx int, op string, newValue Object) Object {
+	if a.Frozen {
+		return newError(FROZEN, a.Type())
 	}
-	switch old := objects[idx].(type) {
-	case *Integer:
-		switch op {
-		case "+=":
-			if newValue.Type() == IntegerObj {
-				old.Value += newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				objects[idx] = &Float{Value: float64(old.Value) + newValue.(*Float).Value}
-				return objects[idx]
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		case "-=":
-			if newValue.Type() == IntegerObj {
-				old.Value -= newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				objects[idx] = &Float{Value: float64(old.Value) - newValue.(*Float).Value}
-				return objects[idx]
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		case "*=":
-			if newValue.Type() == IntegerObj {
-				old.Value *= newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				objects[idx] = &Float{Value: float64(old.Value) * newValue.(*Float).Value}
-				return objects[idx]
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		case "/=":
-			if newValue.Type() == IntegerObj {
-				if newValue.(*Integer).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				old.Value /= newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				if newValue.(*Float).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				objects[idx] = &Float{Value: float64(old.Value) / newValue.(*Float).Value}
-				return objects[idx]
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		}
-	case *Float:
-		switch op {
-		case "+=":
-			if newValue.Type() == IntegerObj {
-				old.Value += float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				old.Value += newValue.(*Float).Value
-			}
-			return old
-		case "-=":
-			if newValue.Type() == IntegerObj {
-				old.Value -= float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				old.Value -= newValue.(*Float).Value
-			}
-			return old
-		case "*=":
-			if newValue.Type() == IntegerObj {
-				old.Value *= float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				old.Value *= newValue.(*Float).Value
-			}
-			return old
-		case "/=":
-			if newValue.Type() == IntegerObj {
-				if newValue.(*Integer).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				old.Value /= float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				if newValue.(*Float).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				old.Value /= newValue.(*Float).Value
-			}
-			return old
-		}
-	case *String:
-		switch op {
-		case "+=":
-			old.Value += newValue.String(0)
-			return old
+	if op != "=" {
+		if newValue = compound(a.Elements[idx], op, newValue); newValue.Type() == ErrorObj {
+			return newValue
 		}
 	}
-	return newError(INFIXOP, op, objects[idx].Type(), newValue.Type())
+	a.Elements[idx] = newValue
+	return newValue
 }
 
 func updateHash(h *Hash, k Object, op string, newValue Object) Object {
-	key, hash := k, h
-	var hashkey HashKey
-	if k, ok := key.(Hashable); !ok {
-		return newError(NOTHASHABLE, key.Type())
-	} else {
-		hashkey = k.HashKey()
-	}
-	if op == "=" {
-		hash.Pairs[hashkey] = HashPair{Key: key, Value: newValue}
-		return newValue
-	}
-	switch old := hash.Pairs[hashkey].Value.(type) {
-	case *Integer:
-		switch op {
-		case "+=":
-			if newValue.Type() == IntegerObj {
-				old.Value += newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				hash.Pairs[hashkey] = HashPair{Key: key, Value: &Float{Value: float64(old.Value) + newValue.(*Float).Value}}
-				return hash.Pairs[hashkey].Value
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		case "-=":
-			if newValue.Type() == IntegerObj {
-				old.Value -= newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				hash.Pairs[hashkey] = HashPair{Key: key, Value: &Float{Value: float64(old.Value) - newValue.(*Float).Value}}
-				return hash.Pairs[hashkey].Value
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		case "*=":
-			if newValue.Type() == IntegerObj {
-				old.Value *= newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				hash.Pairs[hashkey] = HashPair{Key: key, Value: &Float{Value: float64(old.Value) * newValue.(*Float).Value}}
-				return hash.Pairs[hashkey].Value
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
-		case "/=":
-			if newValue.Type() == IntegerObj {
-				if newValue.(*Integer).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				old.Value /= newValue.(*Integer).Value
-				return old
-			} else if newValue.Type() == FloatObj {
-				if newValue.(*Float).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				hash.Pairs[hashkey] = HashPair{Key: key, Value: &Float{Value: float64(old.Value) / newValue.(*Float).Value}}
-				return hash.Pairs[hashkey].Value
-			}
-			return newError(INFIXOP, op, old.Type(), newValue.Type())
+	if h.Frozen {
+		return newError(FROZEN, h.Type())
+	}
+	hashable, ok := k.(Hashable)
+	if !ok {
+		return newError(NOTHASHABLE, k.Type())
+	}
+	hashkey := hashable.HashKey()
+	if op != "=" {
+		old, ok := h.Pairs[hashkey]
+		if !ok {
+			return newError(INFIXOP, op, NullObj, newValue.Type())
 		}
-	case *Float:
-		switch op {
-		case "+=":
-			if newValue.Type() == IntegerObj {
-				old.Value += float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				old.Value += newValue.(*Float).Value
-			}
-			return old
-		case "-=":
-			if newValue.Type() == IntegerObj {
-				old.Value -= float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				old.Value -= newValue.(*Float).Value
-			}
-			return old
-		case "*=":
-			if newValue.Type() == IntegerObj {
-				old.Value *= float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				old.Value *= newValue.(*Float).Value
-			}
-			return old
-		case "/=":
-			if newValue.Type() == IntegerObj {
-				if newValue.(*Integer).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				old.Value /= float64(newValue.(*Integer).Value)
-			} else if newValue.Type() == FloatObj {
-				if newValue.(*Float).Value == 0 {
-					return newError(DIVIDEBYZERO)
-				}
-				old.Value /= newValue.(*Float).Value
-			}
-			return old
-		}
-	case *String:
-		switch op {
-		case "+=":
-			old.Value += newValue.String(0)
-			return old
+		if newValue = compound(old.Value, op, newValue); newValue.Type() == ErrorObj {
+			return newValue
 		}
 	}
-	return newError(INFIXOP, op, hash.Pairs[hashkey].Value.Type(), newValue.Type())
+	h.Pairs[hashkey] = HashPair{Key: k, Value: newValue}
+	return newValue
+}
+
+// compound returns the result of a compound assignment op like += to an element whose value is old, a new object
+// because old may be shared with other variables and elements
+func compound(old Object, op string, newValue Object) Object {
+	switch {
+	case isNumber(old) && isNumber(newValue):
+		return evalNumberInfixExpression(old, strings.TrimSuffix(op, "="), newValue)
+	case old.Type() == StringObj && op == "+=":
+		return &String{Value: old.(*String).Value + newValue.String(0)}
+	}
+	return newError(INFIXOP, op, old.Type(), newValue.Type())
 }
 
 func evalHashIndexExpressionFunc(ctx context.Context, node *ast.IndexExpression, s *Scope, op string, newValue Object, f func(hash *Hash, key Object) Object) Object {
@@ -1037,9 +1252,8 @@ func evalHashIndexExpressionFunc(ctx context.Context, node *ast.IndexExpression,
 	case *Hash:
 		return f(l, index)
 	case *Array:
-		objects := l.Elements
 		if idx, ok := index.(*Integer); ok {
-			return updateArray(objects, int(idx.Value), op, newValue)
+			return updateArray(l, int(idx.Value), op, newValue)
 		} else {
 			return newError(INDEXINT)
 		}
@@ -1069,8 +1283,8 @@ func evalSliceExpression(ctx context.Context, obj Object, sliceExpr *ast.SliceEx
 	}
 
 	var endIdx int
-	if sliceExpr.End != nil {
-		end := Eval(ctx, sliceExpr.End, s)
+	if sliceExpr.Stop != nil {
+		end := Eval(ctx, sliceExpr.Stop, s)
 		if end.Type() == ErrorObj {
 			return end
 		}
@@ -1118,8 +1332,20 @@ func calcIndex(max int, idxExpr Object, end bool) (int, *Error) {
 
 func evalMethodCallExpression(ctx context.Context, node *ast.MethodCallExpression, s *Scope) Object {
 	obj := Eval(ctx, node.Object, s)
+	if obj.Type() == ErrorObj {
+		return obj
+	}
 	if method, ok := node.Call.(*ast.CallExpression); ok {
 		args := evalExpressions(ctx, method.Arguments, s)
+		if len(args) == 1 && args[0].Type() == ErrorObj {
+			return args[0]
+		}
+		if m, ok := obj.(*Module); ok {
+			return m.call(ctx, method.Function.String(), args)
+		}
+		if _, ok := methods[obj.Type()]; ok {
+			return callBuiltinMethod(ctx, obj, method.Function.String(), args)
+		}
 		return obj.CallMethod(method.Function.String(), args...)
 	}
 	return newError(NOMETHODERROR, node.String(), obj.Type())
@@ -1127,7 +1353,23 @@ func evalMethodCallExpression(ctx context.Context, node *ast.MethodCallExpressio
 
 func evalHashLiteral(ctx context.Context, node *ast.HashLiteral, s *Scope) Object {
 	hashMap := make(map[HashKey]HashPair)
-	for key, value := range node.Pairs {
+	for _, key := range node.Keys {
+		if spread, ok := key.(*ast.SpreadExpression); ok {
+			// later pairs win over those spread before them and the other way round
+			v := Eval(ctx, spread.Value, s)
+			if v.Type() == ErrorObj {
+				return v
+			}
+			h, ok := v.(*Hash)
+			if !ok {
+				return spreadError(spread, HashObj, v)
+			}
+			for k, pair := range h.Pairs {
+				hashMap[k] = pair
+			}
+			continue
+		}
+		value := node.Pairs[key]
 		var k Object
 		if ident, ok := key.(*ast.Identifier); ok {
 			k = &String{Value: ident.Value}
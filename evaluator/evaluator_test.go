@@ -1,11 +1,21 @@
 package evaluator
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"stang/lexer"
-	"stang/parser"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"github.com/yzbmz5913/stang/vfs"
+	"io/fs"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -201,3 +211,727 @@ func TestArrayIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`plain`", "plain"},
+		{"let name = 'stan'; `hello ${name}!`", "hello stan!"},
+		{"`${1 + 2}${[1, 2]}${null}`", "3[1, 2]null"},
+		{"`line1\\nline2 \\${x}`", "line1\nline2 ${x}"},
+		{"`multi\nline`", "multi\nline"},
+		{"`outer ${`inner ${1.5}`}`", "outer inner 1.5"},
+		{"let tag = function(s, v) { return s[0] + v[1] + s[1] + v[0] + s[2] }; tag`<${1}|${2}>`", "<2|1>"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+	if err, ok := testEval("`${undefinedName}`").(*Error); !ok {
+		t.Errorf("expected error for unknown identifier in template")
+	} else if err.Msg != "unknown identifier: 'undefinedName' is not defined" {
+		t.Errorf("wrong error message. got=%q", err.Msg)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("%d|%5d|%-5d|%05d", 1, 2, 3, -4)`, "1|    2|3    |-0004"},
+		{`format("%f %.2f %8.3f", 1, 3.14159, 2.5)`, "1.000000 3.14    2.500"},
+		{`format("%s|%-4s|%q", "a", "b", "c")`, `a|b   |"c"`},
+		{`format("%x %x %v %v %%", 255, "hi", [1, "a"], null)`, "ff 6869 [1, a] null %"},
+		{`format("no directives")`, "no directives"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`format("%d", "a")`, "wrong type of arguments. expected: INTEGER, got: STRING"},
+		{`format("%s", 1)`, "wrong type of arguments. expected: STRING, got: INTEGER"},
+		{`format("%f", true)`, "wrong type of arguments. expected: FLOAT, got: BOOLEAN"},
+		{`format("%d %d", 1)`, "wrong number of arguments. expected: 3, got: 2"},
+		{`format("%d", 1, 2)`, "wrong number of arguments. expected: 2, got: 3"},
+		{`format(1)`, "wrong type of arguments. expected: STRING, got: INTEGER"},
+		{`format("%y", 1)`, "format: unknown verb 'y'"},
+	}
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		err, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if err.Msg != tt.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", err.Msg, tt.expected)
+		}
+	}
+}
+
+func TestPrintOutput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`print(1, "a", [2])`, "1, a, [2]\n"},
+		{`print(1, 2, sep="|", end=";")`, "1|2;"},
+		{`let sep = "-"; print(1, 2, sep=sep)`, "1-2\n"},
+		{`printf("%s=%03d;", "x", 7)`, "x=007;"},
+		{"printf(`%.1f\\n`, 0.25)", "0.2\n"},
+	}
+	for _, tt := range tests {
+		out := &bytes.Buffer{}
+		ctx := WithRuntime(context.Background(), &Runtime{Stdout: out})
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if result := Eval(ctx, program, NewScope(nil)); result != NULL {
+			t.Errorf("print should return null. got=%s", result.String(0))
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong output. got=%q, want=%q", out.String(), tt.expected)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	clock := func() time.Time { return time.Date(2022, 3, 30, 4, 35, 6, 0, time.UTC) }
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"now()", "2022-03-30 04:35:06"},
+		{"typeof now()", "TIME"},
+		{"now().format('Jan 2, 2006')", "Mar 30, 2022"},
+		{"[now().year(), now().month(), now().day(), now().hour(), now().weekday()]", "[2022, 3, 30, 4, Wednesday]"},
+		{"now().unix()", "1648614906"},
+		{"time.unix(1648614906).format()", "2022-03-30 04:35:06"},
+		{"now().in('Asia/Shanghai')", "2022-03-30 12:35:06"},
+		{"now().in('Asia/Shanghai').zone()", "CST"},
+		{"time.parse('2006-01-02', '2022-04-01') - now()", "43h24m54s"},
+		{"time.parse('2006-01-02 15:04', '2022-04-01 08:00', 'Asia/Shanghai').utc()", "2022-04-01 00:00:00"},
+		{"now() + time.hours(1.5)", "2022-03-30 06:05:06"},
+		{"now() - time.duration('36h')", "2022-03-28 16:35:06"},
+		{"time.minutes(1) * 3 + time.seconds(30)", "3m30s"},
+		{"2 * time.seconds(1) == time.milliseconds(2000)", "true"},
+		{"time.date(2022, 3, 30, 4, 35, 6) == now()", "true"},
+		{"now() < now() + time.seconds(1)", "true"},
+		{"time.hours(3) / time.minutes(90)", "2"},
+		{"time.since(time.date(2022, 3, 29)).hours()", "28.585"},
+		{"now().in('Mars/Olympus')", "Error: unknown time zone Mars/Olympus"},
+		{"time.parse('2006', 'abc')", `Error: cannot parse time: parsing time "abc" as "2006": cannot parse "abc" as "2006"`},
+		{"now() + 1", "Error: unsupported infix operator '+' for type TIME and INTEGER"},
+		{"time.nope()", "Error: undefined method 'nope' for object time"},
+		{"time.seconds('1')", "Error: wrong type of arguments. expected: INTEGER or FLOAT, got: STRING"},
+	}
+	for _, tt := range tests {
+		ctx := WithRuntime(context.Background(), &Runtime{Now: clock, Location: time.UTC})
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := Eval(ctx, program, NewScope(nil))
+		if result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	input := `
+let r = random()
+let f = random.random()
+let i = random.randint(1, 6)
+let c = random.choice(["a", "b", "c"])
+let s = random.shuffle([1, 2, 3, 4, 5])
+let picked = random.sample([1, 2, 3, 4, 5], 3)
+print(r < 1 && r >= 0, f < 1 && f >= 0, i >= 1 && i <= 6, len(s), len(picked))
+print(r, f, i, c, s, picked, now(), {b: 2, a: 1, 3: "x", 1: "y"})
+`
+	run := func(seed int64) string {
+		out := &bytes.Buffer{}
+		rt := NewDeterministicRuntime(out, time.Date(2022, 3, 30, 4, 35, 6, 0, time.UTC), seed)
+		program := parser.New(lexer.New(input)).ParseProgram()
+		if result := Eval(WithRuntime(context.Background(), rt), program, NewScope(nil)); result.Type() == ErrorObj {
+			t.Fatalf("unexpected error: %s", result.String(0))
+		}
+		return out.String()
+	}
+	first := run(42)
+	if !strings.HasPrefix(first, "true, true, true, 5, 3\n") {
+		t.Fatalf("random values out of range. got=%q", first)
+	}
+	if !strings.Contains(first, "2022-03-30 04:35:06, {1:y, 3:x, a:1, b:2}") {
+		t.Errorf("clock or hash order is not pinned. got=%q", first)
+	}
+	for i := 0; i < 5; i++ {
+		if again := run(42); again != first {
+			t.Fatalf("output is not reproducible. got=%q, want=%q", again, first)
+		}
+	}
+	if run(7) == first {
+		t.Errorf("different seeds should produce different output")
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"random.randint(3, 1)", "randint: lower bound 3 is greater than upper bound 1"},
+		{"random.choice([])", "array is empty"},
+		{"random.sample([1], 2)", "sample: size 2 is out of range [0, 1]"},
+		{"random.shuffle(1)", "wrong type of arguments. expected: ARRAY, got: INTEGER"},
+	}
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		err, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if err.Msg != tt.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", err.Msg, tt.expected)
+		}
+	}
+}
+
+func TestFileSystem(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fs.read("notes/todo.txt")`, "buy milk\nwalk dog"},
+		{`fs.write("out.txt", "a"); fs.append("out.txt", "b"); fs.read("out.txt")`, "ab"},
+		{`[fs.exists("notes/todo.txt"), fs.exists("nope.txt"), fs.exists("notes")]`, "[true, false, true]"},
+		{`fs.mkdir("x/y"); fs.write("x/y/z.txt", ""); [fs.list(), fs.list("x")]`, "[[notes/, x/], [y/]]"},
+		{`fs.write("tmp.txt", ""); fs.remove("tmp.txt"); fs.exists("tmp.txt")`, "false"},
+		{`let it = fs.lines("notes/todo.txt"); [it.done(), it.next(), it.next(), it.done(), it.next()]`, "[false, buy milk, walk dog, true, null]"},
+		{`fs.lines("notes/todo.txt").toArray()`, "[buy milk, walk dog]"},
+		{`fs.read("../etc/passwd")`, "Error: open ../etc/passwd: path escapes the file system root"},
+		{`fs.read("/etc/passwd")`, "Error: open /etc/passwd: path escapes the file system root"},
+		{`fs.read("missing.txt")`, "Error: open missing.txt: file does not exist"},
+		{`fs.read(1)`, "Error: wrong type of arguments. expected: STRING, got: INTEGER"},
+	}
+	for _, tt := range tests {
+		mem := vfs.NewMemory(map[string]string{"notes/todo.txt": "buy milk\nwalk dog"})
+		ctx := WithRuntime(context.Background(), &Runtime{FS: mem})
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if result := Eval(ctx, program, NewScope(nil)); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+
+	readOnly := WithRuntime(context.Background(), &Runtime{FS: vfs.ReadOnly(vfs.NewMemory(nil))})
+	program := parser.New(lexer.New(`fs.write("a.txt", "a")`)).ParseProgram()
+	if result := Eval(readOnly, program, NewScope(nil)); result.String(0) != "Error: file system is read-only" {
+		t.Errorf("writing to a read-only file system should fail. got=%q", result.String(0))
+	}
+	if result := testEval(`fs.exists("a.txt")`); result.String(0) != "Error: file system access is not enabled" {
+		t.Errorf("file system access should be disabled by default. got=%q", result.String(0))
+	}
+}
+
+// countingFS counts the files opened and not closed yet
+type countingFS struct {
+	fs.FS
+	open int32
+}
+
+type countedFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&c.open, 1)
+	return &countedFile{File: f, fsys: c}, nil
+}
+
+func (f *countedFile) Close() error {
+	atomic.AddInt32(&f.fsys.open, -1)
+	return f.File.Close()
+}
+
+func TestFileSystemLinesClosed(t *testing.T) {
+	tests := []string{
+		`fs.lines("a.txt").toArray()`,
+		`for (let line of fs.lines("a.txt")) { break }`,
+		`let it = fs.lines("a.txt"); it.next(); it.close()`,
+		// the dropped iterators are closed once they are garbage collected
+		`for (let i = 0; i < 20; i++) { fs.lines("a.txt").next() }`,
+	}
+	for _, input := range tests {
+		fsys := &countingFS{FS: vfs.NewMemory(map[string]string{"a.txt": "1\n2\n3"})}
+		ctx := WithRuntime(context.Background(), &Runtime{FS: fsys})
+		Eval(ctx, parser.New(lexer.New(input)).ParseProgram(), NewScope(nil))
+		for i := 0; i < 50 && atomic.LoadInt32(&fsys.open) > 0; i++ {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := atomic.LoadInt32(&fsys.open); n != 0 {
+			t.Errorf("%s: %d files were left open", input, n)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let count = function(n) { for (let i = 0; i < n; i++) { yield i } }; let g = count(2); [typeof g, g.done(), g.next(), g.next(), g.done(), g.next()]", "[GENERATOR, false, 0, 1, true, null]"},
+		{"let naturals = function() { let i = 0; while (true) { yield i; i++ } }; let out = []; for (let x of naturals()) { if (x > 3) { break }; out.push(x) }; out", "[0, 1, 2, 3]"},
+		{"let f = function() { yield 1; return 5; yield 2 }; f().toArray()", "[1]"},
+		{"let f = function() { yield; yield [1] }; f().toArray()", "[null, [1]]"},
+		{"let f = function(xs) { for (let x of xs) { yield x * 10 } }; f([1, 2]).toArray()", "[10, 20]"},
+		{"let f = function() { let inner = function() { yield 1 }; return inner }; typeof f()", "FUNCTION"},
+		{"let f = function() { yield 1; missing }; let g = f(); [g.next(), g.next(), g.done()]", "[1, Error: unknown identifier: 'missing' is not defined, true]"},
+		{"let f = function() { yield 1; yield 2 }; let g = f(); g.next(); g.close(); [g.done(), g.next()]", "[true, null]"},
+		{"let s = 0; for (x of [1, 2, 3]) { s += x }; s", "6"},
+		{"let out = ''; for (let c of 'abc') { if (c == 'b') { continue }; out += c }; out", "ac"},
+		{"let out = []; for (let k of {b: 1, a: 2}) { out.push(k) }; out", "[a, b]"},
+		{"let f = function() { for (let x of [1, 2, 3]) { if (x == 2) { return x } } }; f()", "2"},
+		{"for (let x of 5) {}", "Error: type INTEGER is not iterable"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+}
+
+func TestConstAndFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const a = 1; a", "1"},
+		{"const a = 1; a = 2", "Error: cannot assign to constant a"},
+		{"const a = 1; a += 2", "Error: cannot assign to constant a"},
+		{"const a = 1; a++", "Error: cannot increment constant a"},
+		{"const a = 1; --a", "Error: cannot decrement constant a"},
+		{"const a = 1; delete a", "Error: cannot delete constant a"},
+		{"const a = 1; let f = function() { a = 2 }; f()", "Error: cannot assign to constant a"},
+		{"const a = 1; let f = function() { let a = 2; a++; a }; [f(), a]", "[3, 1]"},
+		{"let a = 1; let f = function() { const a = 2; a }; a = f(); a", "2"},
+		{"const a = 1; const a = 2", "Error: variable a has been defined"},
+		{"const a = [1]; a.push(2); a[0] = 3; a", "[3, 2]"},
+		{"let a = freeze([1, [2]]); a.push(3)", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1, [2]]); a.pop()", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1, [2]]); a[0] = 3", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1, [2]]); a[1][0] += 3", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1, [2]]); a[0]++", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1, [2]]); delete a[0]", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1, [2]]); random.shuffle(a)", "Error: cannot modify a frozen ARRAY"},
+		{"let h = freeze({k: {n: 1}}); h['k'] = 2", "Error: cannot modify a frozen HASH"},
+		{"let h = freeze({k: {n: 1}}); h['k']['n'] = 2", "Error: cannot modify a frozen HASH"},
+		{"let h = freeze({k: {n: 1}}); delete h['k']", "Error: cannot modify a frozen HASH"},
+		{"let h = freeze({k: [1]}); h['k'].push(2)", "Error: cannot modify a frozen ARRAY"},
+		{"let a = freeze([1]); let b = a[0:1]; b.push(2); [a, b]", "[[1], [1, 2]]"},
+		{"let a = freeze([1]); a = [2]; a.push(3); a", "[2, 3]"},
+		{"[freeze(1), freeze('s'), freeze(null)]", "[1, s, null]"},
+		{"let a = [1]; a.push(a); freeze(a); a.pop()", "Error: cannot modify a frozen ARRAY"},
+		{"const c = 1; let d = c; d++; [c, d]", "[1, 2]"},
+		{"const c = 1; let f = function(x) { x++; x }; [f(c), c]", "[2, 1]"},
+		{"let a = freeze([1]); let b = a[0]; b++; [a, b]", "[[1], 2]"},
+		{"const h = freeze({n: 1}); let m = h['n']; m--; [h, m]", "[{n:1}, 0]"},
+		{"let s = 'a'; let a = [s]; a[0] += 'b'; let h = {k: a[0]}; h['k'] += 'c'; [s, a, h]", "[a, [ab], {k:abc}]"},
+		{"let n = 0; let f = function() { n += 1; return [1] }; f()[0]++; n", "1"},
+		{"let n = 0; let f = function() { n += 1; return {k: 1} }; --f()['k']; n", "1"},
+		{"let a = [1]; [a[0]++, ++a[0], a[0]--, --a[0], a]", "[1, 3, 3, 1, [1]]"},
+		{"let h = {}; [h['x']++, h]", "[null, {}]"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+
+	// the host can define constants too
+	s := NewScope(nil)
+	s.SetConst("config", &String{Value: "prod"})
+	if v, ok := s.Reset("config", &String{Value: "dev"}); ok || v.String(0) != "prod" {
+		t.Errorf("Reset should leave a constant alone. got=%v, %v", v, ok)
+	}
+	if _, ok := s.Delete("config"); ok {
+		t.Errorf("Delete should leave a constant alone")
+	}
+	program := parser.New(lexer.New("config = 'dev'")).ParseProgram()
+	if result := Eval(context.Background(), program, NewScope(s)); result.String(0) != "Error: cannot assign to constant config" {
+		t.Errorf("wrong result %q", result.String(0))
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; [a, b, rest]", "[1, 2, [3, 4]]"},
+		{"let [a, ...rest] = [1]; rest", "[]"},
+		{"let [] = []; 1", "1"},
+		{"let [a, b = a + 1] = [1]; b", "2"},
+		{"let [a = f()] = [1]; a", "1"},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", "6"},
+		{"let {name, age: years, city = 'n/a'} = {name: 'stan', age: 8}; [name, years, city]", "[stan, 8, n/a]"},
+		{"let {'a b': x, 1: y, ...rest} = {'a b': 1, 1: 2, c: 3}; [x, y, rest]", "[1, 2, {c:3}]"},
+		{"let {a: [b, {c}]} = {a: [1, {c: 2}]}; b + c", "3"},
+		{"let a = 1; let b = 2; [a, b] = [b, a]; [a, b]", "[2, 1]"},
+		{"let a = 1; let b = 2\n[a, b] = [b, a]\n[a, b]", "[2, 1]"},
+		{"let arr = [0, 0]; let h = {}; [arr[1], h['k']] = [1, 2]; [arr, h]", "[[0, 1], {k:2}]"},
+		{"let a = 0; let b = 0; {x: a, y: b = 3} = {x: 1}; [a, b]", "[1, 3]"},
+		{"let f = function([a, b], {c = 3}) { a + b + c }; f([1, 2], {})", "6"},
+		{"let f = function(n, [a, ...b]) { [n, a, b] }; f(0, [1, 2])", "[0, 1, [2]]"},
+		{"const [a, b] = [1, 2]; a = 3", "Error: cannot assign to constant a"},
+		{"const {a} = {a: 1}; let b = 0; [a, b] = [2, 3]", "Error: cannot assign to constant a"},
+		{"let a = 1; let [a] = [2]", "Error: variable a has been defined"},
+		{"let [a] = [1, 2]", "Error: cannot destructure an array of length 2 with a pattern of length 1"},
+		{"let [a, b = 0, ...c] = []", "Error: cannot destructure an array of length 0 with a pattern of length at least 1"},
+		{"let [a, b = 0] = []", "Error: cannot destructure an array of length 0 with a pattern of length 1 to 2"},
+		{"let [a] = 'a'", "Error: cannot destructure STRING with an array pattern"},
+		{"let {a} = [1]", "Error: cannot destructure ARRAY with a hash pattern"},
+		{"let {a} = {b: 1}", "Error: cannot destructure a hash without key a, the pattern gives it no default"},
+		{"let {[1]: a} = {}", "Error: type ARRAY is not hashable"},
+		{"let [a = 1 / 0] = []", "Error: cannot divide by zero"},
+		{"let f = function([a]) { a }; f(1)", "Error: cannot destructure INTEGER with an array pattern"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+}
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2]; let b = [3]; [...a, 0, ...b]", "[1, 2, 0, 3]"},
+		{"[...[], ...'ab', ...{y: 1, x: 2}]", "[a, b, x, y]"},
+		{"let g = function() { yield 1; yield 2 }; [...g()]", "[1, 2]"},
+		{"let a = [1]; let b = [...a]; b.push(2); [a, b]", "[[1], [1, 2]]"},
+		{"let d = {color: 'red', size: 1}; {...d, ...{size: 2}}", "{color:red, size:2}"},
+		{"let d = {color: 'red', size: 1}; [{...d, size: 3}, {size: 3, ...d}]", "[{color:red, size:3}, {color:red, size:1}]"},
+		{"let f = function(x, y, z) { [x, y, z] }; let xs = [1, 2]; f(...xs, 3)", "[1, 2, 3]"},
+		{"let f = function(x, y) { return x + y }; let g = function(xs) { return f(...xs) }; g([1, 2])", "3"},
+		{"len(...[[3, 9, 1]])", "3"},
+		{"let a = []; a.push(...[1, 2]); a", "[1, 2]"},
+		{"let t = spawn len(...[[1, 2]]); t.wait()", "2"},
+		{"let a = 0; let b = 0; [a, ...b] = [1, 2, 3]; [a, b]", "[1, [2, 3]]"},
+		{"let a = 0; let b = 0; {x: a, ...b} = {x: 1, y: 2}; [a, b]", "[1, {y:2}]"},
+		{"[...1]", "Error: wrong type of arguments. expected: ARRAY, STRING, HASH, ITERATOR, GENERATOR or CHANNEL, got: INTEGER"},
+		{"len(...null)", "Error: wrong type of arguments. expected: ARRAY, STRING, HASH, ITERATOR, GENERATOR or CHANNEL, got: NULL"},
+		{"{a: 1, ...[1]}", "Error: wrong type of arguments. expected: HASH, got: ARRAY"},
+		{"[...x]", "Error: unknown identifier: 'x' is not defined"},
+		{"let f = function(a, b) { a }; f(...[1])", "Error: wrong number of arguments. expected: 2, got: 1"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+}
+
+func TestGeneratorCleanup(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	input := "let forever = function() { while (true) { yield 1 } }; let g = forever(); g.next(); for (let x of forever()) { }"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if result := Eval(ctx, program, NewScope(nil)); result.String(0) != "Error: evaluation timeout" {
+		t.Errorf("generator should stop when the context is done. got=%q", result.String(0))
+	}
+
+	// abandoned generators are stopped once they are garbage collected
+	testEval("let f = function() { yield 1; yield 2 }; for (let i = 0; i < 20; i++) { f().next() }")
+	for i := 0; i < 50 && runtime.NumGoroutine() > before; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("generator goroutines leaked. before=%d, after=%d", before, n)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let ch = channel(); let f = function(n) { for (let i = 0; i < n; i++) { ch.send(i * i) }; ch.close(); return 'done' }; let t = spawn f(4); let out = []; for (v of ch) { out.push(v) }; [out, t.wait(), t.done()]", "[[0, 1, 4, 9], done, true]"},
+		{"let ch = channel(2); ch.send(1); ch.send(2); ch.close(); [ch.len(), ch.cap(), ch.closed(), ch.recv(), ch.recv(), ch.recv()]", "[2, 2, true, 1, 2, null]"},
+		{"let h = {}; let f = function(k) { for (let i = 0; i < 3000; i++) { h[k] = i + 1 } }; let ts = [spawn f('a'), spawn f('b')]; for (let i = 0; i < 3000; i++) { h['c'] = i + 1 }; ts[0].wait(); ts[1].wait(); h", "{a:3000, b:3000, c:3000}"},
+		{"let f = function() { return missing }; (spawn f()).wait()", "Error: unknown identifier: 'missing' is not defined"},
+		{"let t = spawn print('x', end=''); t.wait()", "null"},
+		{"let ch = channel(3); let f = function(n) { ch.send(n) }; for (let i = 0; i < 3; i++) { spawn f(i) }; ch.recv() + ch.recv() + ch.recv()", "3"},
+		// ++ and += store new numbers, what was sent or yielded before keeps its value
+		{"let ch = channel(3); let i = 0; ch.send(i); i++; ch.send(i); i += 1; ch.send(i); [ch.recv(), ch.recv(), ch.recv()]", "[0, 1, 2]"},
+		{"let g = function() { let i = 0; while (i < 3) { yield i; i++ } }; let it = g(); [it.next(), it.next(), it.next()]", "[0, 1, 2]"},
+		{"let a = channel(1); let b = channel(1); b.send('hi'); select { case let x = a.recv() { 'a' + x } case let y = b.recv() { 'b' + y } }", "bhi"},
+		{"let a = channel(); select { case let x = a.recv() { x } default { 'none' } }", "none"},
+		{"let a = channel(1); select { case a.send(5) { a.recv() } }", "5"},
+		{"let a = channel(); a.close(); [select { case let v = a.recv() { v } }, a.send(1), a.close()]", "[null, Error: send on closed channel, Error: close on closed channel]"},
+		{"let ch = channel(); let f = function() { let n = 0; while (true) { n++; if (n == 2000) { ch.send(n) } } }; spawn f(); ch.recv()", "2000"},
+		{"let n = 1; select { case let x = n.recv() { x } }", "Error: wrong type of arguments. expected: CHANNEL, got: INTEGER"},
+		{"channel(-1)", "Error: channel capacity must not be negative, got -1"},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		ctx, cancel := context.WithTimeout(WithRuntime(context.Background(), &Runtime{Stdout: &bytes.Buffer{}}), time.Second)
+		result := Eval(ctx, program, NewScope(nil))
+		cancel()
+		if result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+}
+
+func TestTaskCancellation(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	input := "let ch = channel(); let busy = function() { while (true) { 1 } }; let waiter = function() { ch.recv() }; spawn busy(); spawn waiter(); ch.recv()"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if result := Eval(ctx, program, NewScope(nil)); result.String(0) != "Error: evaluation timeout" {
+		t.Errorf("a blocked program should time out. got=%q", result.String(0))
+	}
+	for i := 0; i < 50 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("tasks outlived their context. before=%d, after=%d", before, n)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// without tail calls the deep recursions below exceed this stack, which crashes the test binary
+	defer debug.SetMaxStack(debug.SetMaxStack(32 << 20))
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let count = function(n, acc) { if (n == 0) { return acc }; return count(n - 1, acc + 1) }; count(200000, 0)", "200000"},
+		{"let even = function(n) { if (n == 0) { return true }; return odd(n - 1) }; let odd = function(n) { if (n == 0) { return false }; return even(n - 1) }; [even(100001), odd(100001)]", "[false, true]"},
+		{"let find = function(xs, i) { for (let x of xs) { if (x == i) { return found(x) } }; return null }; let found = function(x) { return 'found ' + x }; [find([1, 2], 2), find([1], 3)]", "[found 2, null]"},
+		{"let f = function(n) { while (true) { if (n > 2) { return g(n) }; n++ } }; let g = function(n) { return n * 10 }; f(0)", "30"},
+		{"let inc = function(n) { return n + 1 }; let f = function(n) { return inc(n) }; 1 + f(1) * 2", "5"},
+		{"let f = function() { return g() }; let g = function() { return missing }; f()", "Error: unknown identifier: 'missing' is not defined"},
+		{"let f = function() { return len([1, 2]) }; f()", "2"},
+		{"let f = function(n) { return n }; return f(3)", "3"},
+		{"let out = []; let log = function(x) { out.push(x) }; let gen = function() { yield 1; return log(2) }; gen().toArray(); out", "[2]"},
+		{"let make = function() { yield 1 }; let f = function() { return make() }; typeof f()", "GENERATOR"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"methods('abc')", "[split, toLower, toUpper]"},
+		{"methods([1])", "[pop, push]"},
+		{"methods(1)", "[]"},
+		{"methods(channel())", "[cap, close, closed, len, recv, send]"},
+		{"let g = function() { yield 1 }; methods(g())", "[close, done, next, toArray]"},
+		{"methods(time.duration('1s'))", "[hours, milliseconds, minutes, nanoseconds, seconds]"},
+		{"methods(random)", "[choice, randint, random, sample, seed, shuffle]"},
+		{"'a,b'.split(',')", "[a, b]"},
+		{"'a'.split(1)", "Error: wrong type of arguments. expected: STRING, got: INTEGER"},
+		{"'a'.nope()", "Error: undefined method 'nope' for object STRING"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+	if got := (&String{Value: "Ab"}).CallMethod("toLower"); got.String(0) != "ab" {
+		t.Errorf("CallMethod should still reach the method table. got=%q", got.String(0))
+	}
+	if names := Builtins(); len(names) == 0 || LookupBuiltin("time") == nil || LookupBuiltin("print") == nil || LookupBuiltin("nope") != nil {
+		t.Errorf("builtins and modules should be listed and looked up. got=%v", names)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert(1 < 2)", "null"},
+		{"assert(false)", "Error: assertion failed"},
+		{"assert(0, 'zero')", "Error: assertion failed: zero"},
+		{"assertEqual([1, {a: [2]}], [1, {a: [2]}])", "null"},
+		{"assertEqual('1', 1)", "Error: assertion failed: values are not equal\n    expected: 1\n    got:      \"1\"\n    value: expected INTEGER 1, got STRING \"1\""},
+		{"assertEqual([1, 2, 3], [1, 5])", "Error: assertion failed: values are not equal\n    expected: [1, 5]\n    got:      [1, 2, 3]\n    [1]: expected 5, got 2\n    [2]: unexpected 3"},
+		{"assertEqual({a: 1}, {a: 1, 2: true})", "Error: assertion failed: values are not equal\n    expected: {2: true, \"a\": 1}\n    got:      {\"a\": 1}\n    [2]: missing true"},
+		{"let f = function() {}; assertEqual(f, f)", "null"},
+		{"assertThrows(function() { 1 / 0 }, 'divide')", "cannot divide by zero"},
+		{"assertThrows(function() { 1 / 0 }, 'nope')", "Error: assertion failed: expected an error containing \"nope\", got \"cannot divide by zero\""},
+		{"assertThrows(function() { 1 })", "Error: assertion failed: expected an error, got 1"},
+		{"assertThrows(function(a) { 1 })", "Error: the function must not take arguments, it takes 1"},
+		{"test('name', 1)", "Error: wrong type of arguments. expected: FUNCTION, got: INTEGER"},
+	}
+	for _, tt := range tests {
+		if result := testEval(tt.input); result.String(0) != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, result.String(0), tt.expected)
+		}
+	}
+
+	rt := &Runtime{}
+	ctx := WithRuntime(context.Background(), rt)
+	program := parser.New(lexer.New("test('a', function() { assert(true) }); test('b', function() { assert(false) })")).ParseProgram()
+	Eval(ctx, program, NewScope(nil))
+	if len(rt.Tests) != 2 || rt.Tests[0].Name != "a" || rt.Tests[1].Name != "b" {
+		t.Fatalf("test should register the tests with the runtime. got=%v", rt.Tests)
+	}
+	if err := RunTest(ctx, rt.Tests[0]); err != nil {
+		t.Errorf("test a should pass. got=%s", err.String(0))
+	}
+	if err := RunTest(ctx, rt.Tests[1]); err == nil || err.String(0) != "Error: assertion failed" {
+		t.Errorf("test b should fail. got=%v", err)
+	}
+}
+
+type recordingHook struct {
+	events []string
+}
+
+func (h *recordingHook) Before(ctx context.Context, node ast.Node, pos token.Position, s *Scope) Object {
+	if _, ok := node.(ast.Statement); ok {
+		h.events = append(h.events, fmt.Sprintf("%d:%d %T depth=%d", pos.Line, pos.Col, node, len(Frames(ctx))))
+	}
+	if id, ok := node.(*ast.Identifier); ok && id.Value == "stop" {
+		return newErrorf("stopped at %s", pos)
+	}
+	return nil
+}
+
+func TestHook(t *testing.T) {
+	input := "let f = function(n) {\n  return n + 1\n}\nf(1)\nstop\n2"
+	h := &recordingHook{}
+	ctx := WithHook(context.Background(), h)
+	result := Eval(ctx, parser.New(lexer.New(input)).ParseProgram(), NewScope(nil))
+	if result.String(0) != "Error: stopped at 5:1" {
+		t.Errorf("the error of the hook should stop the evaluation. got=%q", result.String(0))
+	}
+	expected := []string{
+		"1:1 *ast.LetStatement depth=0",
+		"4:1 *ast.ExpressionStatement depth=0",
+		"2:3 *ast.ReturnStatement depth=1",
+		"5:1 *ast.ExpressionStatement depth=0",
+	}
+	if strings.Join(h.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events. got=%q, want=%q", h.events, expected)
+	}
+	if frames := Frames(context.Background()); len(frames) != 0 {
+		t.Errorf("there should be no frames without a hook. got=%v", frames)
+	}
+}
+
+func TestEmptyBlocks(t *testing.T) {
+	tests := []string{
+		"let f = function() {}; f()",
+		"if (true) {}",
+		"let i = 0; while (i++ < 3) {}",
+		"for (let x of [1]) {}",
+		"let t = spawn (function() {})(); t.wait()",
+	}
+	for _, input := range tests {
+		if result := testEval(input); result != NULL {
+			t.Errorf("%q: an empty block should be null. got=%v", input, result)
+		}
+	}
+}
+
+// panickingHook panics at the identifier boom, like a bug of the evaluator would
+type panickingHook struct{}
+
+func (panickingHook) Before(ctx context.Context, node ast.Node, pos token.Position, s *Scope) Object {
+	if id, ok := node.(*ast.Identifier); ok && id.Value == "boom" {
+		panic("boom")
+	}
+	return nil
+}
+
+func TestRecover(t *testing.T) {
+	tests := []string{
+		"1 + boom",
+		"let f = function() { boom }\nlet t = spawn f()\nt.wait()",
+		"let g = function() { yield 1; boom }\nlet it = g()\nit.next()\nit.next()",
+	}
+	for _, input := range tests {
+		ctx := WithHook(WithScheduler(context.Background()), panickingHook{})
+		program := parser.New(lexer.New(input)).ParseProgram()
+		var result Object
+		func() {
+			defer Recover(&result)
+			result = Eval(ctx, program, NewScope(nil))
+		}()
+		if err, ok := result.(*Error); !ok || err.Msg != "internal error: boom" {
+			t.Errorf("%q: the panic should be an error. got=%v", input, result)
+		}
+	}
+	rt := &Runtime{}
+	ctx := WithHook(WithRuntime(context.Background(), rt), panickingHook{})
+	Eval(ctx, parser.New(lexer.New("test('panics', function() { boom })")).ParseProgram(), NewScope(nil))
+	if err, ok := RunTest(ctx, rt.Tests[0]).(*Error); !ok || err.Msg != "internal error: boom" {
+		t.Errorf("a panicking test should fail. got=%v", err)
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	fset := token.NewFileSet()
+	lib := parser.New(lexer.NewFile(fset.AddFile("lib.stg", "let get = function(a, i) {\n  return a[i]\n}"))).ParseProgram()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + missing", "main.stg:1:5-11"},
+		{"let x = [1, 2]\nx.nope(\n  1)", "main.stg:2:1-3:4"},
+		{"get([1], 3)", "lib.stg:2:10-13"},
+		{"`a${missing}b`", "main.stg:1:5-11"},
+		{"let g = function() { yield 1; missing }\nlet it = g(); it.next(); it.next()", "main.stg:1:31-37"},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.NewFile(fset.AddFile("main.stg", tt.input))).ParseProgram()
+		ctx := WithScheduler(context.Background())
+		s := NewScope(nil)
+		Eval(ctx, lib, s)
+		err, ok := Eval(ctx, program, s).(*Error)
+		if !ok {
+			t.Errorf("%q should fail", tt.input)
+			continue
+		}
+		if span := token.Span(err.Pos, err.End); span != tt.expected {
+			t.Errorf("%q: wrong position of %q. got=%s, want=%s", tt.input, err.Msg, span, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package evaluator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/yzbmz5913/stang/vfs"
+	"io/fs"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// filesystem.go defines the fs module, every path is resolved against the FS of the Runtime
+
+// fsArgs checks that the arguments of an fs function are n strings, the first one being a path
+func fsArgs(ctx context.Context, n int, args []Object) (fs.FS, []string, Object) {
+	if len(args) != n {
+		return nil, nil, newError(ARGUMENTNUMERROR, strconv.Itoa(n), len(args))
+	}
+	strs := make([]string, 0, n)
+	for _, arg := range args {
+		str, ok := arg.(*String)
+		if !ok {
+			return nil, nil, newError(ARGUMENTTYPEERROR, StringObj, arg.Type())
+		}
+		strs = append(strs, str.Value)
+	}
+	fsys := runtimeOf(ctx).FS
+	if fsys == nil {
+		return nil, nil, newErrorf("file system access is not enabled")
+	}
+	name, err := vfs.Clean(strs[0])
+	if err != nil {
+		return nil, nil, fsError(err)
+	}
+	strs[0] = name
+	return fsys, strs, nil
+}
+
+func writableFS(fsys fs.FS) (vfs.FS, Object) {
+	if w, ok := fsys.(vfs.FS); ok {
+		return w, nil
+	}
+	return nil, newErrorf("file system is read-only")
+}
+
+func fsError(err error) Object {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return newErrorf("%s %s: %s", pathErr.Op, pathErr.Path, pathErr.Err)
+	}
+	return newErrorf("%s", err)
+}
+
+func init() {
+	registerModule(&Module{Name: "fs", Functions: map[string]*Builtin{
+		"read": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 1, args)
+			if e != nil {
+				return e
+			}
+			data, err := fs.ReadFile(fsys, strs[0])
+			if err != nil {
+				return fsError(err)
+			}
+			return &String{Value: string(data)}
+		}},
+		"write": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 2, args)
+			if e != nil {
+				return e
+			}
+			w, e := writableFS(fsys)
+			if e != nil {
+				return e
+			}
+			if err := w.WriteFile(strs[0], []byte(strs[1])); err != nil {
+				return fsError(err)
+			}
+			return &Integer{Value: int64(len(strs[1]))}
+		}},
+		"append": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 2, args)
+			if e != nil {
+				return e
+			}
+			w, e := writableFS(fsys)
+			if e != nil {
+				return e
+			}
+			if err := w.AppendFile(strs[0], []byte(strs[1])); err != nil {
+				return fsError(err)
+			}
+			return &Integer{Value: int64(len(strs[1]))}
+		}},
+		"lines": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 1, args)
+			if e != nil {
+				return e
+			}
+			f, err := fsys.Open(strs[0])
+			if err != nil {
+				return fsError(err)
+			}
+			scanner := bufio.NewScanner(f)
+			it := NewIterator(func() (Object, bool) {
+				if scanner.Scan() {
+					return &String{Value: strings.TrimSuffix(scanner.Text(), "\r")}, true
+				}
+				if err := scanner.Err(); err != nil {
+					return fsError(err), true
+				}
+				return nil, false
+			}, func() { _ = f.Close() })
+			// for-of closes the iterator when it stops early, one dropped before the end closes the file once collected
+			runtime.SetFinalizer(it, (*Iterator).Close)
+			return it
+		}},
+		"exists": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 1, args)
+			if e != nil {
+				return e
+			}
+			_, err := fs.Stat(fsys, strs[0])
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fsError(err)
+			}
+			return nativeBoolToBooleanObject(err == nil)
+		}},
+		"list": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) == 0 {
+				args = []Object{&String{Value: "."}}
+			}
+			fsys, strs, e := fsArgs(ctx, 1, args)
+			if e != nil {
+				return e
+			}
+			entries, err := fs.ReadDir(fsys, strs[0])
+			if err != nil {
+				return fsError(err)
+			}
+			names := make([]Object, 0, len(entries))
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() {
+					name += "/"
+				}
+				names = append(names, &String{Value: name})
+			}
+			return &Array{Elements: names}
+		}},
+		"mkdir": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 1, args)
+			if e != nil {
+				return e
+			}
+			w, e := writableFS(fsys)
+			if e != nil {
+				return e
+			}
+			if err := w.MkdirAll(strs[0]); err != nil {
+				return fsError(err)
+			}
+			return NULL
+		}},
+		"remove": {Fn: func(ctx context.Context, args ...Object) Object {
+			fsys, strs, e := fsArgs(ctx, 1, args)
+			if e != nil {
+				return e
+			}
+			w, e := writableFS(fsys)
+			if e != nil {
+				return e
+			}
+			if err := w.Remove(strs[0]); err != nil {
+				return fsError(err)
+			}
+			return NULL
+		}},
+	}})
+}
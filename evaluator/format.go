@@ -0,0 +1,113 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// format.go implements the printf-style formatting behind format() and printf()
+// A directive looks like %[flags][width][.precision]verb, supported flags are '-', '+', ' ' and '0'.
+//   %d  INTEGER in decimal
+//   %x  INTEGER or STRING in hexadecimal
+//   %f  INTEGER or FLOAT as a decimal fraction, 6 digits of precision by default
+//   %s  STRING
+//   %q  STRING, double-quoted and escaped
+//   %v  any value, as print would show it
+//   %%  a literal percent sign
+
+func format(f string, args []Object) (string, Object) {
+	var out strings.Builder
+	next := 0
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			out.WriteByte(f[i])
+			continue
+		}
+		// collect flags, width and precision
+		start := i
+		i++
+		for i < len(f) && strings.IndexByte("-+ 0", f[i]) >= 0 {
+			i++
+		}
+		for i < len(f) && isDigit(f[i]) {
+			i++
+		}
+		if i < len(f) && f[i] == '.' {
+			i++
+			for i < len(f) && isDigit(f[i]) {
+				i++
+			}
+		}
+		if i >= len(f) {
+			return "", newErrorf("format: missing verb at end of %q", f)
+		}
+		verb := f[i]
+		spec := f[start:i]
+		if verb == '%' {
+			if spec != "%" {
+				return "", newErrorf("format: %%%% does not take flags")
+			}
+			out.WriteByte('%')
+			continue
+		}
+		if next >= len(args) {
+			return "", newError(ARGUMENTNUMERROR, strconv.Itoa(countDirectives(f)+1), len(args)+1)
+		}
+		arg := args[next]
+		next++
+		str, err := formatOne(spec, verb, arg)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(str)
+	}
+	if next != len(args) {
+		return "", newError(ARGUMENTNUMERROR, strconv.Itoa(next+1), len(args)+1)
+	}
+	return out.String(), nil
+}
+
+func formatOne(spec string, verb byte, arg Object) (string, Object) {
+	directive := spec + string(verb)
+	switch verb {
+	case 'd':
+		if i, ok := arg.(*Integer); ok {
+			return fmt.Sprintf(directive, i.Value), nil
+		}
+		return "", newError(ARGUMENTTYPEERROR, IntegerObj, arg.Type())
+	case 'x':
+		switch a := arg.(type) {
+		case *Integer:
+			return fmt.Sprintf(directive, a.Value), nil
+		case *String:
+			return fmt.Sprintf(directive, a.Value), nil
+		}
+		return "", newError(ARGUMENTTYPEERROR, IntegerObj+" or "+StringObj, arg.Type())
+	case 'f':
+		switch a := arg.(type) {
+		case *Integer:
+			return fmt.Sprintf(directive, float64(a.Value)), nil
+		case *Float:
+			return fmt.Sprintf(directive, a.Value), nil
+		}
+		return "", newError(ARGUMENTTYPEERROR, FloatObj, arg.Type())
+	case 's', 'q':
+		if s, ok := arg.(*String); ok {
+			return fmt.Sprintf(directive, s.Value), nil
+		}
+		return "", newError(ARGUMENTTYPEERROR, StringObj, arg.Type())
+	case 'v':
+		return fmt.Sprintf(spec+"s", arg.String(0)), nil
+	}
+	return "", newErrorf("format: unknown verb '%c'", verb)
+}
+
+// countDirectives counts the directives in f that consume an argument
+func countDirectives(f string) int {
+	return strings.Count(f, "%") - 2*strings.Count(f, "%%")
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
@@ -0,0 +1,138 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/yzbmz5913/stang/ast"
+	"runtime"
+	"sync"
+)
+
+// generator.go runs the body of a generator function on its own goroutine.
+// The goroutine and the caller hand control back and forth, so the body never runs concurrently with the caller:
+// next() resumes the body until it yields a value or finishes, yield parks the body until the next resume.
+
+// Generator is the object returned by calling a function containing yield
+type Generator struct {
+	*Iterator
+}
+
+func (g *Generator) Type() ObjectType  { return GeneratorObj }
+func (g *Generator) String(int) string { return "[generator]" }
+
+// generatorState is shared by the caller and the goroutine of a generator.
+// It must not reference the Generator, otherwise an abandoned generator would never be collected.
+type generatorState struct {
+	ctx      context.Context
+	resume   chan struct{}
+	yields   chan Object // closed when the body finished
+	stop     chan struct{}
+	stopOnce sync.Once
+	started  bool
+}
+
+type generatorKey struct{}
+
+// errGeneratorClosed unwinds the body of a generator closed while parked at a yield
+var errGeneratorClosed = &Error{Msg: "generator is closed"}
+
+func newGenerator(ctx context.Context, body *ast.BlockStatement, s *Scope) Object {
+	st := &generatorState{
+		ctx:    ctx,
+		resume: make(chan struct{}),
+		yields: make(chan Object),
+		stop:   make(chan struct{}),
+	}
+	g := &Generator{Iterator: NewIterator(func() (Object, bool) {
+		return st.produce(body, s)
+	}, st.close)}
+	// a generator dropped before it finished would leave its goroutine parked forever.
+	// The finalizer is set on the embedded iterator, which is what method values like g.Next keep alive.
+	runtime.SetFinalizer(g.Iterator, func(*Iterator) { st.close() })
+	return g
+}
+
+func (st *generatorState) produce(body *ast.BlockStatement, s *Scope) (Object, bool) {
+	if !st.started {
+		st.started = true
+		go st.run(body, s)
+	} else {
+		select {
+		case st.resume <- struct{}{}:
+		case <-st.stop:
+			return nil, false
+		case <-st.ctx.Done():
+			return newError(TIMEOUT), true
+		}
+	}
+	select {
+	case v, ok := <-st.yields:
+		if !ok && st.ctx.Err() != nil {
+			// the body gave up because the evaluation timed out, rather than finishing
+			return newError(TIMEOUT), true
+		}
+		return v, ok
+	case <-st.ctx.Done():
+		return newError(TIMEOUT), true
+	}
+}
+
+func (st *generatorState) run(body *ast.BlockStatement, s *Scope) {
+	defer close(st.yields)
+	result := st.eval(body, s)
+	if err, ok := result.(*Error); ok && err != errGeneratorClosed {
+		select {
+		case st.yields <- err:
+		case <-st.stop:
+		case <-st.ctx.Done():
+		}
+	}
+}
+
+// eval runs the body, a panic in it is reported to the caller rather than ending the process
+func (st *generatorState) eval(body *ast.BlockStatement, s *Scope) (result Object) {
+	defer Recover(&result)
+	ctx := context.WithValue(st.ctx, generatorKey{}, st)
+	result = Eval(ctx, body, s)
+	if rv, ok := result.(*ReturnValue); ok {
+		result = finishTailCall(ctx, rv.Value)
+	}
+	return result
+}
+
+// yield hands v to the caller and parks the body until it is resumed
+func (st *generatorState) yield(v Object) Object {
+	select {
+	case st.yields <- v:
+	case <-st.stop:
+		return errGeneratorClosed
+	case <-st.ctx.Done():
+		return newError(TIMEOUT)
+	}
+	select {
+	case <-st.resume:
+		return NULL
+	case <-st.stop:
+		return errGeneratorClosed
+	case <-st.ctx.Done():
+		return newError(TIMEOUT)
+	}
+}
+
+func (st *generatorState) close() {
+	st.stopOnce.Do(func() { close(st.stop) })
+}
+
+func evalYieldExpression(ctx context.Context, node *ast.YieldExpression, s *Scope) Object {
+	st, ok := ctx.Value(generatorKey{}).(*generatorState)
+	if !ok {
+		return newErrorf("yield outside of a generator")
+	}
+	var value Object = NULL
+	if node.Value != nil {
+		value = Eval(ctx, node.Value, s)
+		if value.Type() == ErrorObj {
+			return value
+		}
+	}
+	return st.yield(value)
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/token"
+)
+
+// Hook observes an evaluation, Eval calls Before with every statement and expression it is about to evaluate
+// except programs and blocks, which only hold statements. The evaluation stops with the error Before returns, if any.
+type Hook interface {
+	Before(ctx context.Context, node ast.Node, pos token.Position, s *Scope) Object
+}
+
+// BranchHook is a Hook that is also told which way the evaluation goes at each branch: if takes the consequence 0
+// or the alternative 1, a missing one included, loops run their body 0 or exit 1 each time they check whether to go on,
+// and select runs the case with the index it chose
+type BranchHook interface {
+	Hook
+	Branch(ctx context.Context, node ast.Node, branch int)
+}
+
+type hookKey struct{}
+
+// WithHook returns a copy of ctx whose evaluations call h, a nil h removes the hook of ctx
+func WithHook(ctx context.Context, h Hook) context.Context {
+	return context.WithValue(ctx, hookKey{}, h)
+}
+
+func hookOf(ctx context.Context) Hook {
+	h, _ := ctx.Value(hookKey{}).(Hook)
+	return h
+}
+
+// Frame is a call of a function in progress, frames are only kept while a hook is installed
+type Frame struct {
+	Function *Function
+	Scope    *Scope // holds the parameters of the call
+	caller   *Frame
+}
+
+// Name returns the name of the variable the function was bound to where it was defined, "function" if there is none
+func (f *Frame) Name() string {
+	for s := f.Function.Scope; s != nil; s = s.parentScope {
+		for name, v := range s.store {
+			if v == Object(f.Function) {
+				return name
+			}
+		}
+	}
+	return "function"
+}
+
+// branch tells the hook of ctx, if it is a BranchHook, that node took the branch
+func branch(ctx context.Context, node ast.Node, b int) {
+	if h, ok := hookOf(ctx).(BranchHook); ok {
+		h.Branch(ctx, node, b)
+	}
+}
+
+type frameKey struct{}
+
+// Frames returns the calls in progress in ctx, the innermost first
+func Frames(ctx context.Context) []*Frame {
+	var frames []*Frame
+	for f, _ := ctx.Value(frameKey{}).(*Frame); f != nil; f = f.caller {
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// enterFrame returns a copy of ctx in which a call of fn with the parameters in s is in progress
+func enterFrame(ctx context.Context, fn *Function, s *Scope) context.Context {
+	caller, _ := ctx.Value(frameKey{}).(*Frame)
+	return context.WithValue(ctx, frameKey{}, &Frame{Function: fn, Scope: s, caller: caller})
+}
@@ -0,0 +1,157 @@
+package evaluator
+
+import "context"
+
+// Iterator is a lazily produced sequence of objects.
+// next() returns the following element, or null once the sequence is exhausted, which done() reports ahead of time.
+type Iterator struct {
+	produce func() (Object, bool) // returns false when there is nothing left
+	release func()                // optional, frees the resources of the producer
+	peeked  Object
+	done    bool
+}
+
+func NewIterator(produce func() (Object, bool), release func()) *Iterator {
+	return &Iterator{produce: produce, release: release}
+}
+
+func (it *Iterator) Type() ObjectType  { return IteratorObj }
+func (it *Iterator) String(int) string { return "[iterator]" }
+func (it *Iterator) CallMethod(method string, args ...Object) Object {
+	return callBuiltinMethod(context.Background(), it, method, args)
+}
+
+// iteratorMethods are shared by ITERATOR and GENERATOR
+var iteratorMethods = map[string]Method{
+	"next": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		if obj, ok := iteratorOf(this).Next(); ok {
+			return obj
+		}
+		return NULL
+	},
+	"done": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		return nativeBoolToBooleanObject(iteratorOf(this).Done())
+	},
+	"close": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		iteratorOf(this).Close()
+		return NULL
+	},
+	"toArray": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		it := iteratorOf(this)
+		elements := make([]Object, 0)
+		for {
+			obj, ok := it.Next()
+			if !ok {
+				return &Array{Elements: elements}
+			}
+			if obj.Type() == ErrorObj {
+				return obj
+			}
+			elements = append(elements, obj)
+		}
+	},
+}
+
+func iteratorOf(obj Object) *Iterator {
+	if g, ok := obj.(*Generator); ok {
+		return g.Iterator
+	}
+	return obj.(*Iterator)
+}
+
+func init() {
+	registerMethods(IteratorObj, iteratorMethods)
+	registerMethods(GeneratorObj, iteratorMethods)
+}
+
+// Done reports whether the iterator is exhausted, it may produce the next element to find out
+func (it *Iterator) Done() bool {
+	if it.done || it.peeked != nil {
+		return it.done
+	}
+	obj, ok := it.produce()
+	if !ok {
+		it.Close()
+		return true
+	}
+	it.peeked = obj
+	return false
+}
+
+// Next returns the next element, or false once the iterator is exhausted
+func (it *Iterator) Next() (Object, bool) {
+	if it.Done() {
+		return nil, false
+	}
+	obj := it.peeked
+	it.peeked = nil
+	if obj.Type() == ErrorObj {
+		it.Close()
+	}
+	return obj, true
+}
+
+// Close ends the iteration early and releases the resources of the producer
+func (it *Iterator) Close() {
+	if it.done {
+		return
+	}
+	it.done = true
+	it.peeked = nil
+	if it.release != nil {
+		it.release()
+	}
+}
+
+// iterate returns a function producing the elements of obj one by one, and one stopping the iteration early
+func iterate(ctx context.Context, obj Object) (func() (Object, bool), func(), Object) {
+	switch o := obj.(type) {
+	case *Array:
+		i := 0
+		return func() (Object, bool) {
+			if i >= len(o.Elements) {
+				return nil, false
+			}
+			i++
+			return o.Elements[i-1], true
+		}, func() {}, nil
+	case *String:
+		i := 0
+		return func() (Object, bool) {
+			if i >= len(o.Value) {
+				return nil, false
+			}
+			i++
+			return &String{Value: string(o.Value[i-1])}, true
+		}, func() {}, nil
+	case *Hash:
+		pairs := o.OrderedPairs()
+		i := 0
+		return func() (Object, bool) {
+			if i >= len(pairs) {
+				return nil, false
+			}
+			i++
+			return pairs[i-1].Key, true
+		}, func() {}, nil
+	case *Iterator:
+		return o.Next, o.Close, nil
+	case *Generator:
+		return o.Next, o.Close, nil
+	case *Channel:
+		return func() (Object, bool) { return o.recv(ctx) }, func() {}, nil
+	}
+	return nil, nil, newError(NOTITERABLE, obj.Type())
+}
@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"context"
+	"sort"
+)
+
+// methods.go keeps the methods of the builtin object types in tables, so that they can be listed as well as called.
+// Object types defined by hosts may still implement their methods in CallMethod.
+
+// Method implements a method, this is the object it is called on
+type Method func(ctx context.Context, this Object, args ...Object) Object
+
+var methods = map[ObjectType]map[string]Method{}
+
+func registerMethods(t ObjectType, table map[string]Method) {
+	methods[t] = table
+}
+
+// callBuiltinMethod calls a method from the table of the type of obj
+func callBuiltinMethod(ctx context.Context, obj Object, method string, args []Object) Object {
+	if fn, ok := methods[obj.Type()][method]; ok {
+		return fn(ctx, obj, args...)
+	}
+	return newError(NOMETHODERROR, method, obj.Type())
+}
+
+// Methods returns the sorted names of the methods obj supports, for a module the names of its functions
+func Methods(obj Object) []string {
+	var names []string
+	if m, ok := obj.(*Module); ok {
+		for name := range m.Functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	return MethodsOf(obj.Type())
+}
+
+// MethodsOf returns the sorted names of the methods of the builtin type t
+func MethodsOf(t ObjectType) []string {
+	var names []string
+	for name := range methods[t] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtins returns the sorted names of the builtin functions and modules
+func Builtins() []string {
+	names := make([]string, 0, len(builtins)+len(modules))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin returns the builtin function or module called name, or nil
+func LookupBuiltin(name string) Object {
+	if builtin, ok := builtins[name]; ok {
+		return builtin
+	}
+	if m, ok := modules[name]; ok {
+		return m
+	}
+	return nil
+}
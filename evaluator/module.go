@@ -0,0 +1,31 @@
+package evaluator
+
+import "context"
+
+// Module groups builtins under a name, e.g. time.parse(layout, value)
+// Calls on a module are dispatched by evalMethodCallExpression so that they receive the evaluation context.
+type Module struct {
+	Name      string
+	Functions map[string]*Builtin
+	Call      *Builtin // optional, invoked when the module itself is called, e.g. random()
+}
+
+func (m *Module) Type() ObjectType  { return ModuleObj }
+func (m *Module) String(int) string { return "[module " + m.Name + "]" }
+func (m *Module) CallMethod(method string, _ ...Object) Object {
+	return newError(NOMETHODERROR, method, m.Type())
+}
+
+func (m *Module) call(ctx context.Context, method string, args []Object) Object {
+	fn, ok := m.Functions[method]
+	if !ok {
+		return newError(NOMETHODERROR, method, m.Name)
+	}
+	return applyFunction(ctx, fn, args)
+}
+
+var modules = map[string]*Module{}
+
+func registerModule(m *Module) {
+	modules[m.Name] = m
+}
@@ -2,9 +2,12 @@ package evaluator
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/token"
 	"hash/fnv"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -27,6 +30,14 @@ const (
 	BuiltinObj     = "BUILTIN"
 	ArrayObj       = "ARRAY"
 	HashObj        = "HASH"
+	ModuleObj      = "MODULE"
+	TimeObj        = "TIME"
+	DurationObj    = "DURATION"
+	IteratorObj    = "ITERATOR"
+	GeneratorObj   = "GENERATOR"
+	TaskObj        = "TASK"
+	ChannelObj     = "CHANNEL"
+	TailCallObj    = "TAIL_CALL"
 )
 
 type Object interface {
@@ -94,6 +105,8 @@ func (n *Null) CallMethod(method string, _ ...Object) Object {
 
 type Error struct {
 	Msg string
+	Pos token.Position // where the error happened, set by Eval
+	End token.Position // the position right after the node the error happened in
 }
 
 func (e *Error) Type() ObjectType  { return ErrorObj }
@@ -128,6 +141,19 @@ func (rv *ReturnValue) CallMethod(method string, _ ...Object) Object {
 	return newError(NOMETHODERROR, method, rv.Type())
 }
 
+// tailCall is what `return f(args)` evaluates to instead of calling f, applyFunction then runs the call
+// in a loop rather than recursing, so that tail-recursive functions run in constant Go stack
+type tailCall struct {
+	function *Function
+	args     []Object
+}
+
+func (tc *tailCall) Type() ObjectType  { return TailCallObj }
+func (tc *tailCall) String(int) string { return "[tail call]" }
+func (tc *tailCall) CallMethod(method string, _ ...Object) Object {
+	return newError(NOMETHODERROR, method, tc.Type())
+}
+
 type String struct{ Value string }
 
 func (s *String) String(int) string { return s.Value }
@@ -138,40 +164,45 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 func (s *String) CallMethod(method string, args ...Object) Object {
-	switch method {
-	case "toLower":
+	return callBuiltinMethod(context.Background(), s, method, args)
+}
+
+var stringMethods = map[string]Method{
+	"toLower": func(ctx context.Context, this Object, args ...Object) Object {
 		if len(args) != 0 {
 			return newError(ARGUMENTNUMERROR, "0", len(args))
 		}
-		lower := strings.ToLower(s.Value)
+		lower := strings.ToLower(this.(*String).Value)
 		return &String{Value: lower}
-	case "toUpper":
+	},
+	"toUpper": func(ctx context.Context, this Object, args ...Object) Object {
 		if len(args) != 0 {
 			return newError(ARGUMENTNUMERROR, "0", len(args))
 		}
-		upper := strings.ToUpper(s.Value)
+		upper := strings.ToUpper(this.(*String).Value)
 		return &String{Value: upper}
-	case "split":
+	},
+	"split": func(ctx context.Context, this Object, args ...Object) Object {
 		if len(args) != 1 {
 			return newError(ARGUMENTNUMERROR, "1", len(args))
 		}
 		if args[0].Type() != StringObj {
-			return newError(ARGUMENTTYPEERROR, StringObj, args[1].Type())
+			return newError(ARGUMENTTYPEERROR, StringObj, args[0].Type())
 		}
-		strs := strings.Split(s.Value, args[0].(*String).Value)
+		strs := strings.Split(this.(*String).Value, args[0].(*String).Value)
 		elements := make([]Object, 0)
 		for _, str := range strs {
 			elements = append(elements, &String{Value: str})
 		}
 		return &Array{Elements: elements}
-	}
-	return newError(NOMETHODERROR, method, s.Type())
+	},
 }
 
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Scope      *Scope
+	Parameters  []ast.Expression // identifiers or patterns
+	Body        *ast.BlockStatement
+	Scope       *Scope
+	IsGenerator bool // calling it returns a generator running the body
 }
 
 func (f *Function) Type() ObjectType { return FunctionObj }
@@ -192,9 +223,13 @@ func (f *Function) CallMethod(method string, _ ...Object) Object {
 	return newError(NOMETHODERROR, method, f.Type())
 }
 
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(ctx context.Context, args ...Object) Object
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn  BuiltinFunction
+	Doc string // the signature and what the builtin does, shown by editors
+	// Options are the keyword options accepted by the builtin with their default values,
+	// they are passed like print(a, b, sep=" ") and read back with option(ctx, name)
+	Options map[string]Object
 }
 
 func (b *Builtin) Type() ObjectType  { return BuiltinObj }
@@ -205,6 +240,7 @@ func (b *Builtin) CallMethod(method string, _ ...Object) Object {
 
 type Array struct {
 	Elements []Object
+	Frozen   bool // set by freeze, the elements cannot be changed
 }
 
 func (a *Array) Type() ObjectType {
@@ -226,13 +262,25 @@ func (a *Array) String(stack int) string {
 	return out.String()
 }
 func (a *Array) CallMethod(method string, args ...Object) Object {
-	switch method {
-	case "push":
+	return callBuiltinMethod(context.Background(), a, method, args)
+}
+
+var arrayMethods = map[string]Method{
+	"push": func(ctx context.Context, this Object, args ...Object) Object {
+		a := this.(*Array)
+		if a.Frozen {
+			return newError(FROZEN, a.Type())
+		}
 		for _, obj := range args {
 			a.Elements = append(a.Elements, obj)
 		}
 		return &Integer{Value: int64(len(a.Elements))}
-	case "pop":
+	},
+	"pop": func(ctx context.Context, this Object, args ...Object) Object {
+		a := this.(*Array)
+		if a.Frozen {
+			return newError(FROZEN, a.Type())
+		}
 		l := len(a.Elements)
 		if l == 0 {
 			return newErrorf("array is empty")
@@ -240,8 +288,7 @@ func (a *Array) CallMethod(method string, args ...Object) Object {
 		ret := a.Elements[l-1]
 		a.Elements = a.Elements[:l-1]
 		return ret
-	}
-	return newError(NOMETHODERROR, method, a.Type())
+	},
 }
 
 type HashKey struct {
@@ -253,7 +300,8 @@ type HashPair struct {
 	Value Object
 }
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs  map[HashKey]HashPair
+	Frozen bool // set by freeze, the pairs cannot be changed
 }
 type Hashable interface {
 	HashKey() HashKey
@@ -266,7 +314,7 @@ func (h *Hash) String(stack int) string {
 	}
 	var out bytes.Buffer
 	var pairs []string
-	for _, pair := range h.Pairs {
+	for _, pair := range h.OrderedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.String(stack+1), pair.Value.String(stack+1)))
 	}
 	out.WriteString("{")
@@ -275,6 +323,65 @@ func (h *Hash) String(stack int) string {
 	return out.String()
 }
 
+// OrderedPairs returns the pairs of the hash sorted by key, so that printing and iterating a hash is stable
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *Time:
+		return a.Value.Before(b.(*Time).Value)
+	case *Duration:
+		return a.Value < b.(*Duration).Value
+	}
+	return a.String(0) < b.String(0)
+}
+
 func (h *Hash) CallMethod(method string, args ...Object) Object {
 	return newError(NOMETHODERROR, method, h.Type())
 }
+
+// freeze makes obj and the arrays and hashes in it immutable
+func freeze(obj Object) {
+	switch o := obj.(type) {
+	case *Array:
+		if o.Frozen {
+			return
+		}
+		o.Frozen = true
+		for _, e := range o.Elements {
+			freeze(e)
+		}
+	case *Hash:
+		if o.Frozen {
+			return
+		}
+		o.Frozen = true
+		for _, pair := range o.Pairs {
+			freeze(pair.Key)
+			freeze(pair.Value)
+		}
+	}
+}
+
+func init() {
+	registerMethods(StringObj, stringMethods)
+	registerMethods(ArrayObj, arrayMethods)
+}
@@ -0,0 +1,132 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+)
+
+// bind destructures value by pattern and hands each target in it with its value to set, which returns an error
+// or what it set. A pattern that is a plain target is handed value itself. A target with a default gets it when
+// the element or the key it stands for is missing.
+func bind(ctx context.Context, pattern ast.Expression, value Object, s *Scope, set func(target ast.Expression, value Object) Object) Object {
+	switch p := pattern.(type) {
+	case *ast.ArrayPattern:
+		arr, ok := value.(*Array)
+		if !ok {
+			return newError(NOTDESTRUCTURABLE, value.Type(), "an array")
+		}
+		if len(arr.Elements) > len(p.Elements) && p.Rest == nil {
+			return newError(ARRAYPATTERN, len(arr.Elements), arrayPatternLength(p))
+		}
+		for i, element := range p.Elements {
+			var v Object
+			if i < len(arr.Elements) {
+				v = arr.Elements[i]
+			}
+			target, v := withDefault(ctx, element, v, s)
+			if v == nil {
+				return newError(ARRAYPATTERN, len(arr.Elements), arrayPatternLength(p))
+			}
+			if err := bindValue(ctx, target, v, s, set); err != nil {
+				return err
+			}
+		}
+		if p.Rest != nil {
+			rest := make([]Object, 0)
+			if len(arr.Elements) > len(p.Elements) {
+				rest = append(rest, arr.Elements[len(p.Elements):]...)
+			}
+			return bind(ctx, p.Rest, &Array{Elements: rest}, s, set)
+		}
+		return nil
+	case *ast.HashPattern:
+		hash, ok := value.(*Hash)
+		if !ok {
+			return newError(NOTDESTRUCTURABLE, value.Type(), "a hash")
+		}
+		taken := map[HashKey]bool{}
+		for _, property := range p.Properties {
+			key := patternKey(ctx, property.Key, s)
+			if key.Type() == ErrorObj {
+				return key
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return newError(NOTHASHABLE, key.Type())
+			}
+			var v Object
+			if pair, ok := hash.Pairs[hashable.HashKey()]; ok {
+				v = pair.Value
+				taken[hashable.HashKey()] = true
+			}
+			target, v := withDefault(ctx, property.Value, v, s)
+			if v == nil {
+				return newError(HASHPATTERN, key.String(0))
+			}
+			if err := bindValue(ctx, target, v, s, set); err != nil {
+				return err
+			}
+		}
+		if p.Rest != nil {
+			rest := &Hash{Pairs: map[HashKey]HashPair{}}
+			for k, pair := range hash.Pairs {
+				if !taken[k] {
+					rest.Pairs[k] = pair
+				}
+			}
+			return bind(ctx, p.Rest, rest, s, set)
+		}
+		return nil
+	}
+	if r := set(pattern, value); r != nil && r.Type() == ErrorObj {
+		return r
+	}
+	return nil
+}
+
+// bindValue binds v, which may be the error evaluating a default, to target
+func bindValue(ctx context.Context, target ast.Expression, v Object, s *Scope, set func(ast.Expression, Object) Object) Object {
+	if v.Type() == ErrorObj {
+		return v
+	}
+	return bind(ctx, target, v, s, set)
+}
+
+// withDefault returns the target element stands for and its value, which is v or, when v is missing,
+// the default of element if it has one
+func withDefault(ctx context.Context, element ast.Expression, v Object, s *Scope) (ast.Expression, Object) {
+	def, ok := element.(*ast.AssignExpression)
+	if !ok {
+		return element, v
+	}
+	if v == nil {
+		v = Eval(ctx, def.Value, s)
+	}
+	return def.Name, v
+}
+
+// patternKey returns the key a property of a hash pattern looks up, a name stands for itself like in a hash literal
+func patternKey(ctx context.Context, key ast.Expression, s *Scope) Object {
+	if ident, ok := key.(*ast.Identifier); ok {
+		return &String{Value: ident.Value}
+	}
+	return Eval(ctx, key, s)
+}
+
+// arrayPatternLength describes how many elements p takes
+func arrayPatternLength(p *ast.ArrayPattern) string {
+	required := 0
+	for i, element := range p.Elements {
+		if _, ok := element.(*ast.AssignExpression); !ok {
+			required = i + 1
+		}
+	}
+	switch {
+	case p.Rest != nil:
+		return fmt.Sprintf("at least %d", required)
+	case required < len(p.Elements):
+		return fmt.Sprintf("%d to %d", required, len(p.Elements))
+	}
+	return fmt.Sprint(required)
+}
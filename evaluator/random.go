@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"context"
+	"math/rand"
+)
+
+// random.go defines the random module, all of its functions draw from the random source of the Runtime
+
+func randomFloat(ctx context.Context, args ...Object) Object {
+	if len(args) != 0 {
+		return newError(ARGUMENTNUMERROR, "0", len(args))
+	}
+	var f float64
+	runtimeOf(ctx).withRand(func(r *rand.Rand) { f = r.Float64() })
+	return &Float{Value: f}
+}
+
+func init() {
+	random := &Builtin{Fn: randomFloat}
+	registerModule(&Module{Name: "random", Call: random, Functions: map[string]*Builtin{
+		"random": random,
+		"seed": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ARGUMENTNUMERROR, "1", len(args))
+			}
+			seed, ok := args[0].(*Integer)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, IntegerObj, args[0].Type())
+			}
+			runtimeOf(ctx).withRand(func(r *rand.Rand) { r.Seed(seed.Value) })
+			return NULL
+		}},
+		"randint": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "2", len(args))
+			}
+			var bounds [2]int64
+			for i, arg := range args {
+				n, ok := arg.(*Integer)
+				if !ok {
+					return newError(ARGUMENTTYPEERROR, IntegerObj, arg.Type())
+				}
+				bounds[i] = n.Value
+			}
+			if bounds[0] > bounds[1] {
+				return newErrorf("randint: lower bound %d is greater than upper bound %d", bounds[0], bounds[1])
+			}
+			var n int64
+			runtimeOf(ctx).withRand(func(r *rand.Rand) { n = bounds[0] + r.Int63n(bounds[1]-bounds[0]+1) })
+			return &Integer{Value: n}
+		}},
+		"choice": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ARGUMENTNUMERROR, "1", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, ArrayObj, args[0].Type())
+			}
+			if len(arr.Elements) == 0 {
+				return newErrorf("array is empty")
+			}
+			var i int
+			runtimeOf(ctx).withRand(func(r *rand.Rand) { i = r.Intn(len(arr.Elements)) })
+			return arr.Elements[i]
+		}},
+		"shuffle": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ARGUMENTNUMERROR, "1", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, ArrayObj, args[0].Type())
+			}
+			if arr.Frozen {
+				return newError(FROZEN, arr.Type())
+			}
+			runtimeOf(ctx).withRand(func(r *rand.Rand) {
+				r.Shuffle(len(arr.Elements), func(i, j int) {
+					arr.Elements[i], arr.Elements[j] = arr.Elements[j], arr.Elements[i]
+				})
+			})
+			return arr
+		}},
+		"sample": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, ArrayObj, args[0].Type())
+			}
+			k, ok := args[1].(*Integer)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, IntegerObj, args[1].Type())
+			}
+			if k.Value < 0 || int(k.Value) > len(arr.Elements) {
+				return newErrorf("sample: size %d is out of range [0, %d]", k.Value, len(arr.Elements))
+			}
+			var perm []int
+			runtimeOf(ctx).withRand(func(r *rand.Rand) { perm = r.Perm(len(arr.Elements)) })
+			elements := make([]Object, 0, k.Value)
+			for _, i := range perm[:k.Value] {
+				elements = append(elements, arr.Elements[i])
+			}
+			return &Array{Elements: elements}
+		}},
+	}})
+}
@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// Runtime holds the facilities of the host that a run of the evaluator relies on.
+// It travels with the context.Context passed to Eval, a run without one uses DefaultRuntime.
+type Runtime struct {
+	Stdout   io.Writer        // where print and printf write to
+	Now      func() time.Time // the clock behind now(), defaults to time.Now
+	Location *time.Location   // the time zone of now() and parsed times, defaults to time.Local
+	// Rand is the source behind the random module, defaults to one seeded with the wall clock.
+	// It is only accessed while holding the lock of the Runtime.
+	Rand *rand.Rand
+	// FS is the file system behind the fs module, scripts cannot touch files when it is nil.
+	// Scripts may only write to it if it implements vfs.FS.
+	FS fs.FS
+	// Tests are the tests registered by test(name, fn) in the order they were registered
+	Tests []*Test
+
+	mu sync.Mutex
+}
+
+// DefaultRuntime serves evaluations without a Runtime of their own, hosts running several programs should give
+// each one a Runtime so that they do not share its random source
+var DefaultRuntime = &Runtime{Stdout: os.Stdout}
+
+// NewDeterministicRuntime returns a Runtime whose clock is frozen at clock and whose randomness is seeded with seed,
+// so that running the same script with it always produces the same output.
+func NewDeterministicRuntime(out io.Writer, clock time.Time, seed int64) *Runtime {
+	return &Runtime{
+		Stdout:   out,
+		Now:      func() time.Time { return clock },
+		Location: clock.Location(),
+		Rand:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+type runtimeKey struct{}
+
+// WithRuntime returns a copy of ctx carrying rt
+func WithRuntime(ctx context.Context, rt *Runtime) context.Context {
+	return context.WithValue(ctx, runtimeKey{}, rt)
+}
+
+func runtimeOf(ctx context.Context) *Runtime {
+	if rt, ok := ctx.Value(runtimeKey{}).(*Runtime); ok && rt != nil {
+		return rt
+	}
+	return DefaultRuntime
+}
+
+func (rt *Runtime) stdout() io.Writer {
+	if rt.Stdout == nil {
+		return os.Stdout
+	}
+	return rt.Stdout
+}
+
+func (rt *Runtime) now() time.Time {
+	if rt.Now == nil {
+		return time.Now().In(rt.location())
+	}
+	return rt.Now().In(rt.location())
+}
+
+func (rt *Runtime) location() *time.Location {
+	if rt.Location == nil {
+		return time.Local
+	}
+	return rt.Location
+}
+
+// withRand calls f with the random source of the runtime, creating it on first use
+func (rt *Runtime) withRand(f func(r *rand.Rand)) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.Rand == nil {
+		rt.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	f(rt.Rand)
+}
+
+type optionsKey struct{}
+
+// withOptions attaches the keyword options of a builtin call, e.g. print(a, sep="|")
+func withOptions(ctx context.Context, options map[string]Object) context.Context {
+	return context.WithValue(ctx, optionsKey{}, options)
+}
+
+// option returns the value of a keyword option passed to the running builtin
+func option(ctx context.Context, name string) Object {
+	options, _ := ctx.Value(optionsKey{}).(map[string]Object)
+	return options[name]
+}
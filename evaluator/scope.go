@@ -1,7 +1,10 @@
 package evaluator
 
+import "sort"
+
 type Scope struct {
 	store       map[string]Object
+	consts      map[string]bool // the names in store declared with const
 	parentScope *Scope
 }
 
@@ -22,7 +25,7 @@ func (s *Scope) Delete(key string) (Object, bool) {
 	for scope.store[key] == nil && scope.parentScope != nil {
 		scope = scope.parentScope
 	}
-	if v, ok := scope.store[key]; ok {
+	if v, ok := scope.store[key]; ok && !scope.consts[key] {
 		delete(scope.store, key)
 		return v, ok
 	}
@@ -34,16 +37,56 @@ func (s *Scope) GetCurrent(key string) (Object, bool) {
 }
 func (s *Scope) Set(key string, value Object) Object {
 	s.store[key] = value
+	delete(s.consts, key)
+	return value
+}
+
+// SetConst defines key in s as a constant, which Reset and Delete leave alone
+func (s *Scope) SetConst(key string, value Object) Object {
+	if s.consts == nil {
+		s.consts = map[string]bool{}
+	}
+	s.store[key] = value
+	s.consts[key] = true
 	return value
 }
+
+// IsConst reports whether key refers to a constant
+func (s *Scope) IsConst(key string) bool {
+	scope := s
+	for scope.store[key] == nil && scope.parentScope != nil {
+		scope = scope.parentScope
+	}
+	return scope.consts[key]
+}
+
+// Reset assigns value to the variable key refers to and reports whether there is one, a constant is not assigned
 func (s *Scope) Reset(key string, value Object) (Object, bool) {
 	scope := s
 	for scope.store[key] == nil && scope.parentScope != nil {
 		scope = scope.parentScope
 	}
+	if scope.consts[key] {
+		return scope.store[key], false
+	}
 	if _, ok := scope.store[key]; ok {
 		scope.store[key] = value
 		return value, true
 	}
 	return value, false
 }
+
+// Parent returns the scope enclosing s, nil for the outermost one
+func (s *Scope) Parent() *Scope {
+	return s.parentScope
+}
+
+// Names returns the sorted names defined in s itself, not in its parents
+func (s *Scope) Names() []string {
+	names := make([]string, 0, len(s.store))
+	for name := range s.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
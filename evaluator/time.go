@@ -0,0 +1,346 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"time"
+	_ "time/tzdata" // timezone conversion must not depend on the tz database of the host
+)
+
+// time.go defines the TIME and DURATION objects and the time module
+
+const defaultTimeLayout = "2006-01-02 15:04:05"
+
+type Time struct {
+	Value time.Time
+}
+
+func (t *Time) Type() ObjectType  { return TimeObj }
+func (t *Time) String(int) string { return t.Value.Format(defaultTimeLayout) }
+func (t *Time) HashKey() HashKey {
+	return HashKey{Type: t.Type(), Value: uint64(t.Value.UnixNano())}
+}
+func (t *Time) CallMethod(method string, args ...Object) Object {
+	return callBuiltinMethod(context.Background(), t, method, args)
+}
+
+var timeMethods = map[string]Method{
+	"format": func(ctx context.Context, this Object, args ...Object) Object {
+		t := this.(*Time)
+		if len(args) > 1 {
+			return newError(ARGUMENTNUMERROR, "0 or 1", len(args))
+		}
+		if len(args) == 0 {
+			return &String{Value: t.String(0)}
+		}
+		if args[0].Type() != StringObj {
+			return newError(ARGUMENTTYPEERROR, StringObj, args[0].Type())
+		}
+		return &String{Value: t.Value.Format(args[0].(*String).Value)}
+	},
+	"in": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		loc, err := location(args[0])
+		if err != nil {
+			return err
+		}
+		return &Time{Value: this.(*Time).Value.In(loc)}
+	},
+	"utc": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		return &Time{Value: this.(*Time).Value.UTC()}
+	},
+	"zone": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		name, _ := this.(*Time).Value.Zone()
+		return &String{Value: name}
+	},
+	"add": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		d, ok := args[0].(*Duration)
+		if !ok {
+			return newError(ARGUMENTTYPEERROR, DurationObj, args[0].Type())
+		}
+		return &Time{Value: this.(*Time).Value.Add(d.Value)}
+	},
+	"sub": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		other, ok := args[0].(*Time)
+		if !ok {
+			return newError(ARGUMENTTYPEERROR, TimeObj, args[0].Type())
+		}
+		return &Duration{Value: this.(*Time).Value.Sub(other.Value)}
+	},
+	"weekday": func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		return &String{Value: this.(*Time).Value.Weekday().String()}
+	},
+}
+
+// timeAccessors are the methods of TIME returning one of its components as an INTEGER
+var timeAccessors = map[string]func(time.Time) int64{
+	"year":       func(t time.Time) int64 { return int64(t.Year()) },
+	"month":      func(t time.Time) int64 { return int64(t.Month()) },
+	"day":        func(t time.Time) int64 { return int64(t.Day()) },
+	"hour":       func(t time.Time) int64 { return int64(t.Hour()) },
+	"minute":     func(t time.Time) int64 { return int64(t.Minute()) },
+	"second":     func(t time.Time) int64 { return int64(t.Second()) },
+	"nanosecond": func(t time.Time) int64 { return int64(t.Nanosecond()) },
+	"yearDay":    func(t time.Time) int64 { return int64(t.YearDay()) },
+	"unix":       func(t time.Time) int64 { return t.Unix() },
+	"unixMilli":  func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) },
+	"unixNano":   func(t time.Time) int64 { return t.UnixNano() },
+}
+
+type Duration struct {
+	Value time.Duration
+}
+
+func (d *Duration) Type() ObjectType  { return DurationObj }
+func (d *Duration) String(int) string { return d.Value.String() }
+func (d *Duration) HashKey() HashKey {
+	return HashKey{Type: d.Type(), Value: uint64(d.Value)}
+}
+func (d *Duration) CallMethod(method string, args ...Object) Object {
+	return callBuiltinMethod(context.Background(), d, method, args)
+}
+
+// durationAccessor builds the methods of DURATION converting it to a unit
+func durationAccessor(convert func(time.Duration) Object) Method {
+	return func(ctx context.Context, this Object, args ...Object) Object {
+		if len(args) != 0 {
+			return newError(ARGUMENTNUMERROR, "0", len(args))
+		}
+		return convert(this.(*Duration).Value)
+	}
+}
+
+var durationMethods = map[string]Method{
+	"hours":        durationAccessor(func(d time.Duration) Object { return &Float{Value: d.Hours()} }),
+	"minutes":      durationAccessor(func(d time.Duration) Object { return &Float{Value: d.Minutes()} }),
+	"seconds":      durationAccessor(func(d time.Duration) Object { return &Float{Value: d.Seconds()} }),
+	"milliseconds": durationAccessor(func(d time.Duration) Object { return &Integer{Value: int64(d / time.Millisecond)} }),
+	"nanoseconds":  durationAccessor(func(d time.Duration) Object { return &Integer{Value: int64(d)} }),
+}
+
+// location resolves a timezone name like "Asia/Shanghai", "UTC" or "Local"
+func location(name Object) (*time.Location, Object) {
+	str, ok := name.(*String)
+	if !ok {
+		return nil, newError(ARGUMENTTYPEERROR, StringObj, name.Type())
+	}
+	loc, err := time.LoadLocation(str.Value)
+	if err != nil {
+		return nil, newErrorf("unknown time zone %s", str.Value)
+	}
+	return loc, nil
+}
+
+func evalTimeInfixExpression(left Object, op string, right Object) Object {
+	switch l := left.(type) {
+	case *Time:
+		switch r := right.(type) {
+		case *Duration:
+			switch op {
+			case "+":
+				return &Time{Value: l.Value.Add(r.Value)}
+			case "-":
+				return &Time{Value: l.Value.Add(-r.Value)}
+			}
+		case *Time:
+			switch op {
+			case "-":
+				return &Duration{Value: l.Value.Sub(r.Value)}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value.Before(r.Value))
+			case "<=":
+				return nativeBoolToBooleanObject(!l.Value.After(r.Value))
+			case ">":
+				return nativeBoolToBooleanObject(l.Value.After(r.Value))
+			case ">=":
+				return nativeBoolToBooleanObject(!l.Value.Before(r.Value))
+			}
+		}
+	case *Duration:
+		switch r := right.(type) {
+		case *Duration:
+			switch op {
+			case "+":
+				return &Duration{Value: l.Value + r.Value}
+			case "-":
+				return &Duration{Value: l.Value - r.Value}
+			case "/":
+				if r.Value == 0 {
+					return newError(DIVIDEBYZERO)
+				}
+				return &Float{Value: float64(l.Value) / float64(r.Value)}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value < r.Value)
+			case "<=":
+				return nativeBoolToBooleanObject(l.Value <= r.Value)
+			case ">":
+				return nativeBoolToBooleanObject(l.Value > r.Value)
+			case ">=":
+				return nativeBoolToBooleanObject(l.Value >= r.Value)
+			}
+		case *Time:
+			if op == "+" {
+				return &Time{Value: r.Value.Add(l.Value)}
+			}
+		case *Integer, *Float:
+			n := toFloat(r)
+			switch op {
+			case "*":
+				return &Duration{Value: time.Duration(float64(l.Value) * n)}
+			case "/":
+				if n == 0 {
+					return newError(DIVIDEBYZERO)
+				}
+				return &Duration{Value: time.Duration(float64(l.Value) / n)}
+			}
+		}
+	case *Integer, *Float:
+		if r, ok := right.(*Duration); ok && op == "*" {
+			return &Duration{Value: time.Duration(toFloat(l) * float64(r.Value))}
+		}
+	}
+	return newError(INFIXOP, op, left.Type(), right.Type())
+}
+
+func toFloat(number Object) float64 {
+	switch n := number.(type) {
+	case *Integer:
+		return float64(n.Value)
+	case *Float:
+		return n.Value
+	}
+	return math.NaN()
+}
+
+// durationBuiltin builds time.seconds(n) and its siblings
+func durationBuiltin(unit time.Duration) *Builtin {
+	return &Builtin{Fn: func(ctx context.Context, args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARGUMENTNUMERROR, "1", len(args))
+		}
+		if !isNumber(args[0]) {
+			return newError(ARGUMENTTYPEERROR, IntegerObj+" or "+FloatObj, args[0].Type())
+		}
+		return &Duration{Value: time.Duration(toFloat(args[0]) * float64(unit))}
+	}}
+}
+
+func init() {
+	for name, accessor := range timeAccessors {
+		accessor := accessor
+		timeMethods[name] = func(ctx context.Context, this Object, args ...Object) Object {
+			if len(args) != 0 {
+				return newError(ARGUMENTNUMERROR, "0", len(args))
+			}
+			return &Integer{Value: accessor(this.(*Time).Value)}
+		}
+	}
+	registerMethods(TimeObj, timeMethods)
+	registerMethods(DurationObj, durationMethods)
+	registerModule(&Module{Name: "time", Functions: map[string]*Builtin{
+		"now": builtins["now"],
+		"parse": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(ARGUMENTNUMERROR, "2 or 3", len(args))
+			}
+			for _, arg := range args {
+				if arg.Type() != StringObj {
+					return newError(ARGUMENTTYPEERROR, StringObj, arg.Type())
+				}
+			}
+			loc := runtimeOf(ctx).location()
+			if len(args) == 3 {
+				var err Object
+				if loc, err = location(args[2]); err != nil {
+					return err
+				}
+			}
+			t, err := time.ParseInLocation(args[0].(*String).Value, args[1].(*String).Value, loc)
+			if err != nil {
+				return newErrorf("cannot parse time: %s", err)
+			}
+			return &Time{Value: t}
+		}},
+		"unix": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(ARGUMENTNUMERROR, "1 or 2", len(args))
+			}
+			var parts [2]int64
+			for i, arg := range args {
+				n, ok := arg.(*Integer)
+				if !ok {
+					return newError(ARGUMENTTYPEERROR, IntegerObj, arg.Type())
+				}
+				parts[i] = n.Value
+			}
+			return &Time{Value: time.Unix(parts[0], parts[1]).In(runtimeOf(ctx).location())}
+		}},
+		"date": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) < 3 || len(args) > 7 {
+				return newError(ARGUMENTNUMERROR, "3 to 7", len(args))
+			}
+			loc := runtimeOf(ctx).location()
+			if len(args) == 7 {
+				var err Object
+				if loc, err = location(args[6]); err != nil {
+					return err
+				}
+				args = args[:6]
+			}
+			var parts [6]int
+			for i, arg := range args {
+				n, ok := arg.(*Integer)
+				if !ok {
+					return newError(ARGUMENTTYPEERROR, IntegerObj, arg.Type())
+				}
+				parts[i] = int(n.Value)
+			}
+			return &Time{Value: time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, loc)}
+		}},
+		"since": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ARGUMENTNUMERROR, "1", len(args))
+			}
+			t, ok := args[0].(*Time)
+			if !ok {
+				return newError(ARGUMENTTYPEERROR, TimeObj, args[0].Type())
+			}
+			return &Duration{Value: runtimeOf(ctx).now().Sub(t.Value)}
+		}},
+		"duration": {Fn: func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ARGUMENTNUMERROR, "1", len(args))
+			}
+			if args[0].Type() != StringObj {
+				return newError(ARGUMENTTYPEERROR, StringObj, args[0].Type())
+			}
+			d, err := time.ParseDuration(args[0].(*String).Value)
+			if err != nil {
+				return newErrorf("cannot parse duration: %s", err)
+			}
+			return &Duration{Value: d}
+		}},
+		"nanoseconds":  durationBuiltin(time.Nanosecond),
+		"milliseconds": durationBuiltin(time.Millisecond),
+		"seconds":      durationBuiltin(time.Second),
+		"minutes":      durationBuiltin(time.Minute),
+		"hours":        durationBuiltin(time.Hour),
+	}})
+}
@@ -0,0 +1,76 @@
+package stang
+
+import (
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/format"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const fmtUsage = `usage: stang fmt [flags] [file...]
+  formats the files, or stdin when there are none, and prints the result
+flags:
+`
+
+func fmtCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("stang fmt", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	write := f.Bool("w", false, "write the result to the files instead of printing it")
+	diff := f.Bool("d", false, "print the changes formatting would make instead of the result")
+	f.Usage = func() {
+		_, _ = io.WriteString(stderr, fmtUsage)
+		f.PrintDefaults()
+	}
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	files := f.Args()
+	if len(files) == 0 {
+		if *write {
+			_, _ = io.WriteString(stderr, "stang fmt: -w needs files\n")
+			return ExitUsage
+		}
+		files = []string{"-"}
+	}
+
+	code := ExitOK
+	for _, name := range files {
+		src, err := readSource(name, stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			code = ExitUsage
+			continue
+		}
+		formatted, err := format.Source(src)
+		if perr, ok := err.(*format.ParseError); ok {
+			reportParseErrors(stderr, token.NewFile(name, src), perr.Errors)
+			code = ExitSyntaxError
+			continue
+		}
+		switch {
+		case *diff:
+			_, _ = io.WriteString(stdout, unifiedDiff(name, src, formatted))
+		case *write && name != "-":
+			if formatted == src {
+				continue
+			}
+			info, err := os.Stat(name)
+			if err == nil {
+				err = ioutil.WriteFile(name, []byte(formatted), info.Mode().Perm())
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+				code = ExitUsage
+			}
+		default:
+			_, _ = io.WriteString(stdout, formatted)
+		}
+	}
+	return code
+}
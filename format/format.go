@@ -0,0 +1,698 @@
+// Package format prints stang source code in its canonical style: four spaces of indentation,
+// spaced operators, one statement per line and no more parentheses or semicolons than the parser needs.
+package format
+
+import (
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"sort"
+	"strings"
+)
+
+// ParseError is returned by Source when the source does not parse
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string { return strings.Join(e.Errors, "\n") }
+
+// Source formats a program. Comments, a shebang line and single blank lines between statements are kept.
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", &ParseError{Errors: p.Errors()}
+	}
+	pr := &printer{src: src, comments: l.Comments(), closing: map[int]int{}}
+	var open []int
+	for l := lexer.New(src); ; {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		switch tok.Type {
+		case token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case token.RBRACE:
+			if len(open) != 0 {
+				pr.closing[open[len(open)-1]] = tok.Pos.Offset
+				open = open[:len(open)-1]
+			}
+		}
+		pr.tokens = append(pr.tokens, tok)
+	}
+	if strings.HasPrefix(src, "#!") {
+		shebang := strings.SplitN(src, "\n", 2)[0]
+		pr.write(strings.TrimRight(shebang, " \t\r") + "\n")
+		pr.line = 1
+	}
+	pr.statements(program.Statements, len(src)+1)
+	return string(pr.out), nil
+}
+
+// Node prints a program, statement or expression in the canonical style, on as many lines as it needs
+func Node(node ast.Node) string {
+	p := &printer{}
+	switch n := node.(type) {
+	case *ast.Program:
+		p.statements(n.Statements, 0)
+		return strings.TrimSuffix(string(p.out), "\n")
+	case *ast.BlockStatement:
+		p.block(n)
+	case ast.Statement:
+		p.statement(n)
+	case ast.Expression:
+		p.expr(n, parser.LOWEST, 0)
+	}
+	return string(p.out)
+}
+
+// highest is above the precedence of every operator, it is the precedence of expressions that are not operations
+const highest = parser.INCRDECR + 1
+
+var operators = map[string]int{
+	"||": parser.OR,
+	"&&": parser.AND,
+	"==": parser.EQUALS,
+	"!=": parser.EQUALS,
+	"<":  parser.LESSGREATER,
+	">":  parser.LESSGREATER,
+	"<=": parser.LESSGREATER,
+	">=": parser.LESSGREATER,
+	"+":  parser.SUM,
+	"-":  parser.SUM,
+	"*":  parser.PRODUCT,
+	"/":  parser.PRODUCT,
+	"%":  parser.PRODUCT,
+}
+
+type printer struct {
+	out    []byte
+	indent int
+
+	// layout of the source, empty when printing a node
+	src      string
+	tokens   []token.Token
+	closing  map[int]int // offset of each { to the offset of its }
+	comments []lexer.Comment
+	next     int // comments[next:] are not printed yet
+	line     int // line of the last statement or comment printed, 0 at the start of a block
+}
+
+func (p *printer) write(s string) {
+	p.out = append(p.out, s...)
+}
+
+func (p *printer) insert(at int, s string) {
+	p.out = append(p.out[:at], append([]byte(s), p.out[at:]...)...)
+}
+
+func (p *printer) writeIndent() {
+	p.write(strings.Repeat("    ", p.indent))
+}
+
+// separate keeps a blank line before something starting on line when the source had one
+func (p *printer) separate(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.write("\n")
+	}
+}
+
+// commentLines prints the comments before offset each on a line of its own
+func (p *printer) commentLines(offset int) {
+	for ; p.next < len(p.comments) && p.comments[p.next].Pos.Offset < offset; p.next++ {
+		c := p.comments[p.next]
+		p.separate(c.Pos.Line)
+		p.writeIndent()
+		p.write(c.Text + "\n")
+		p.line = c.Pos.Line
+	}
+}
+
+// lastToken returns the last token of the source before offset
+func (p *printer) lastToken(offset int) token.Token {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Pos.Offset >= offset })
+	if i == 0 {
+		return token.Token{}
+	}
+	return p.tokens[i-1]
+}
+
+func startOf(stmt ast.Statement) token.Position {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		return s.Token.Pos
+	case *ast.ReturnStatement:
+		return s.Token.Pos
+	case *ast.DeleteStatement:
+		return s.Token.Pos
+	case *ast.ExpressionStatement:
+		return s.Token.Pos
+	case *ast.BlockStatement:
+		return s.Token.Pos
+	}
+	return token.Position{}
+}
+
+// statements prints one statement per line, end is the offset in the source where the list ends
+func (p *printer) statements(stmts []ast.Statement, end int) {
+	var list []ast.Statement
+	for _, stmt := range stmts {
+		if es, ok := stmt.(*ast.ExpressionStatement); !ok || es.Expression != nil {
+			list = append(list, stmt)
+		}
+	}
+	semicolon := -1 // where a semicolon goes if the next statement would continue the last one without it
+	for i, stmt := range list {
+		limit := end
+		if i+1 < len(list) {
+			limit = startOf(list[i+1]).Offset
+		}
+		p.commentLines(startOf(stmt).Offset)
+		p.separate(startOf(stmt).Line)
+		p.writeIndent()
+		start := len(p.out)
+		p.statement(stmt)
+		if semicolon >= 0 && strings.IndexByte("([-+`", p.out[start]) >= 0 {
+			p.insert(semicolon, ";")
+		}
+		semicolon = -1
+		if r, ok := stmt.(*ast.ReturnStatement); ok && r.ReturnValue == nil || endsWithYield(stmt) && i+1 < len(list) {
+			p.write(";")
+		} else {
+			semicolon = len(p.out)
+		}
+
+		// comments left inside the statement and the one following it on its last line
+		last := p.lastToken(limit)
+		var trailing []string
+		for ; p.next < len(p.comments); p.next++ {
+			c := p.comments[p.next]
+			if c.Pos.Offset >= limit || c.Pos.Offset > last.Pos.Offset && c.Pos.Line != last.Pos.Line {
+				break
+			}
+			trailing = append(trailing, c.Text)
+		}
+		if len(trailing) != 0 {
+			p.write(" " + strings.Join(trailing, " "))
+		}
+		p.write("\n")
+		p.line = last.Pos.Line
+	}
+	p.commentLines(end)
+}
+
+// endsWithYield reports whether stmt ends with a yield of nothing, which would take the next statement as its value
+func endsWithYield(stmt ast.Statement) bool {
+	var e ast.Expression
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		e = s.Value
+	case *ast.ReturnStatement:
+		e = s.ReturnValue
+	case *ast.DeleteStatement:
+		e = s.Value
+	case *ast.ExpressionStatement:
+		e = s.Expression
+	}
+	for e != nil {
+		switch n := e.(type) {
+		case *ast.YieldExpression:
+			if n.Value == nil {
+				return true
+			}
+			e = n.Value
+		case *ast.InfixExpression:
+			e = n.Right
+		case *ast.PrefixExpression:
+			e = n.Right
+		case *ast.AssignExpression:
+			e = n.Value
+		case *ast.TypeofExpression:
+			e = n.Expr
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		keyword := "let "
+		if s.IsConst() {
+			keyword = "const "
+		}
+		p.write(keyword)
+		p.expr(s.Name, parser.LOWEST, 0)
+		p.write(" = ")
+		p.expr(s.Value, parser.LOWEST, 0)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expr(s.ReturnValue, parser.LOWEST, 0)
+		}
+	case *ast.DeleteStatement:
+		p.write("delete ")
+		p.expr(s.Value, parser.LOWEST, 0)
+	case *ast.ExpressionStatement:
+		p.expr(s.Expression, parser.LOWEST, 0)
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	end := p.closing[b.Token.Pos.Offset]
+	empty := p.next == len(p.comments) || p.comments[p.next].Pos.Offset >= end
+	for _, stmt := range b.Statements {
+		if es, ok := stmt.(*ast.ExpressionStatement); !ok || es.Expression != nil {
+			empty = false
+		}
+	}
+	if empty {
+		p.write("{}")
+		return
+	}
+	p.write("{\n")
+	p.indent++
+	p.line = 0
+	p.statements(b.Statements, end)
+	p.indent--
+	p.writeIndent()
+	p.write("}")
+}
+
+// precedence returns the precedence of the operator applied last in e, that of an operand e can be
+func precedence(e ast.Expression) int {
+	switch n := e.(type) {
+	case *ast.InfixExpression:
+		return operators[n.Operator]
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.SliceExpression:
+		return parser.SLICE
+	case *ast.CallExpression, *ast.MethodCallExpression, *ast.TaggedTemplateExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	case *ast.PostfixExpression:
+		return parser.INCRDECR
+	}
+	return highest
+}
+
+// openness returns the precedence the end of e is parsed at, an operator of higher precedence following e would become part of it
+func openness(e ast.Expression) int {
+	switch n := e.(type) {
+	case *ast.InfixExpression:
+		return operators[n.Operator]
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.SpawnExpression:
+		return parser.PREFIX
+	case *ast.AssignExpression, *ast.TypeofExpression, *ast.YieldExpression:
+		return parser.LOWEST
+	case *ast.SliceExpression:
+		if n.Stop != nil {
+			return parser.LOWEST
+		}
+	case *ast.MethodCallExpression:
+		if _, ok := n.Call.(*ast.CallExpression); !ok {
+			return parser.LOWEST
+		}
+	}
+	return highest
+}
+
+// expr prints e where the parser reads it at precedence min and an operator of precedence follow comes after it,
+// in parentheses if it would be read differently without them
+func (p *printer) expr(e ast.Expression, min, follow int) {
+	if e == nil {
+		return
+	}
+	if precedence(e) <= min || openness(e) < follow {
+		p.write("(")
+		p.expr(e, parser.LOWEST, 0)
+		p.write(")")
+		return
+	}
+	switch n := e.(type) {
+	case *ast.Identifier:
+		p.write(n.Value)
+	case *ast.IntegerLiteral:
+		p.write(n.Token.Literal)
+	case *ast.FloatLiteral:
+		p.write(n.Token.Literal)
+	case *ast.BooleanLiteral:
+		if n.Value {
+			p.write("true")
+		} else {
+			p.write("false")
+		}
+	case *ast.NullExpression:
+		p.write("null")
+	case *ast.BreakExpression:
+		p.write("break")
+	case *ast.ContinueExpression:
+		p.write("continue")
+	case *ast.StringLiteral:
+		p.write(p.quote(n))
+	case *ast.TemplateLiteral:
+		p.write("`" + n.Token.Literal + "`")
+	case *ast.TaggedTemplateExpression:
+		p.expr(n.Tag, min, parser.CALL)
+		p.write("`" + n.Template.Token.Literal + "`")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.list(n.Elements, n.Rbracket)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		pairs := make([]spanned, len(n.Keys))
+		for i, key := range n.Keys {
+			pairs[i] = pair{key, n.Pairs[key]}
+		}
+		p.items(pairs, n.Rbrace, func(i int) {
+			key := n.Keys[i]
+			if _, ok := key.(*ast.SpreadExpression); ok {
+				p.expr(key, parser.LOWEST, 0)
+				return
+			}
+			p.expr(key, parser.SLICE, parser.SLICE)
+			p.write(": ")
+			p.expr(n.Pairs[key], parser.LOWEST, 0)
+		})
+		p.write("}")
+	case *ast.ArrayPattern:
+		p.write("[")
+		elements := make([]spanned, 0, len(n.Elements)+1)
+		for _, e := range n.Elements {
+			elements = append(elements, e)
+		}
+		if n.Rest != nil {
+			elements = append(elements, n.Rest)
+		}
+		p.items(elements, n.Rbracket, func(i int) {
+			if i == len(n.Elements) {
+				p.write("...")
+			}
+			p.expr(elements[i].(ast.Expression), parser.LOWEST, 0)
+		})
+		p.write("]")
+	case *ast.HashPattern:
+		p.write("{")
+		properties := make([]spanned, 0, len(n.Properties)+1)
+		for _, property := range n.Properties {
+			properties = append(properties, property)
+		}
+		if n.Rest != nil {
+			properties = append(properties, n.Rest)
+		}
+		p.items(properties, n.Rbrace, func(i int) {
+			if i == len(n.Properties) {
+				p.write("...")
+				p.expr(n.Rest, parser.LOWEST, 0)
+				return
+			}
+			property := n.Properties[i]
+			if !property.IsShorthand() {
+				p.expr(property.Key, parser.SLICE, parser.SLICE)
+				p.write(": ")
+			}
+			p.expr(property.Value, parser.LOWEST, 0)
+		})
+		p.write("}")
+	case *ast.SpreadExpression:
+		p.write("...")
+		p.expr(n.Value, parser.LOWEST, follow)
+	case *ast.PrefixExpression:
+		p.write(n.Operator)
+		start := len(p.out)
+		p.expr(n.Right, parser.PREFIX, follow)
+		// - -a must not become --a
+		if strings.IndexByte("+-", n.Operator[len(n.Operator)-1]) >= 0 && start < len(p.out) && strings.IndexByte("+-", p.out[start]) >= 0 {
+			p.insert(start, "(")
+			p.write(")")
+		}
+	case *ast.InfixExpression:
+		prec := operators[n.Operator]
+		p.expr(n.Left, min, prec)
+		p.write(" " + n.Operator + " ")
+		p.expr(n.Right, prec, follow)
+	case *ast.PostfixExpression:
+		p.expr(n.Left, min, parser.INCRDECR)
+		p.write(n.Operator)
+	case *ast.AssignExpression:
+		p.expr(n.Name, min, parser.ASSIGN)
+		p.write(" " + n.Token.Literal + " ")
+		p.expr(n.Value, parser.LOWEST, follow)
+	case *ast.CallExpression:
+		p.expr(n.Function, min, parser.CALL)
+		p.arguments(n.Arguments, n.Rparen)
+	case *ast.IndexExpression:
+		p.expr(n.Left, min, parser.INDEX)
+		p.write("[")
+		p.expr(n.Index, parser.LOWEST, 0)
+		p.write("]")
+	case *ast.SliceExpression:
+		// the parser fills in the start of [:end] with a 0 that is not in the source
+		if start, ok := n.Start.(*ast.IntegerLiteral); !ok || start.Token.Pos.Line != 0 || start.Value != 0 {
+			p.expr(n.Start, min, parser.SLICE)
+		}
+		p.write(":")
+		p.expr(n.Stop, parser.LOWEST, follow)
+	case *ast.MethodCallExpression:
+		p.receiver(n.Object, min)
+		p.write(".")
+		if call, ok := n.Call.(*ast.CallExpression); ok {
+			p.expr(call.Function, parser.LOWEST, parser.CALL)
+			p.arguments(call.Arguments, call.Rparen)
+		} else {
+			p.expr(n.Call, parser.LOWEST, follow)
+		}
+	case *ast.TypeofExpression:
+		p.write("typeof ")
+		p.expr(n.Expr, parser.LOWEST, follow)
+	case *ast.YieldExpression:
+		p.write("yield")
+		if n.Value != nil {
+			p.write(" ")
+			p.expr(n.Value, parser.LOWEST, follow)
+		}
+	case *ast.SpawnExpression:
+		p.write("spawn ")
+		p.expr(n.Call, parser.PREFIX, follow)
+	case *ast.FunctionLiteral:
+		p.write("function(")
+		p.list(n.Parameters, n.Body.Token.Pos)
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expr(n.Condition, parser.LOWEST, 0)
+		p.write(") ")
+		p.block(n.Consequence)
+		if n.Alternative != nil {
+			// a comment after the } of the consequence stays there, else goes to the next line
+			if p.trailing(n.Alternative.Token.Pos.Offset) {
+				p.writeIndent()
+				p.write("else ")
+			} else {
+				p.write(" else ")
+			}
+			p.block(n.Alternative)
+		}
+	case *ast.WhileExpression:
+		p.write("while (")
+		p.expr(n.Condition, parser.LOWEST, 0)
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.ForExpression:
+		p.write("for (")
+		switch init := n.Init.(type) {
+		case *ast.LetStatement:
+			p.statement(init)
+		case ast.Expression:
+			p.expr(init, parser.LOWEST, 0)
+		}
+		p.write(";")
+		if n.Condition != nil {
+			p.write(" ")
+			p.expr(n.Condition, parser.LOWEST, 0)
+		}
+		p.write(";")
+		if n.Update != nil {
+			p.write(" ")
+			p.expr(n.Update, parser.LOWEST, 0)
+		}
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.ForOfExpression:
+		p.write("for (let " + n.Name.Value + " of ")
+		p.expr(n.Iterable, parser.LOWEST, 0)
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.SelectExpression:
+		p.write("select {\n")
+		p.indent++
+		for _, c := range n.Cases {
+			p.writeIndent()
+			switch {
+			case c.Channel == nil:
+				p.write("default")
+			case c.Send != nil:
+				p.write("case ")
+				p.receiver(c.Channel, parser.LOWEST)
+				p.write(".send(")
+				p.expr(c.Send, parser.LOWEST, 0)
+				p.write(")")
+			default:
+				p.write("case ")
+				if c.Name != nil {
+					p.write("let " + c.Name.Value + " = ")
+				}
+				p.receiver(c.Channel, parser.LOWEST)
+				p.write(".recv()")
+			}
+			p.write(" ")
+			p.block(c.Body)
+			p.write("\n")
+		}
+		p.indent--
+		p.writeIndent()
+		p.write("}")
+	}
+}
+
+// receiver prints the object of a method call, a number needs parentheses or its dot would be read as a decimal point
+func (p *printer) receiver(e ast.Expression, min int) {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		p.write("(")
+		p.expr(e, parser.LOWEST, 0)
+		p.write(")")
+	default:
+		p.expr(e, min, parser.CALL)
+	}
+}
+
+// spanned is an item of a list, which covers the source from Pos to End
+type spanned interface {
+	Pos() token.Position
+	End() token.Position
+}
+
+// pair is a key of a hash literal and its value, a spread has no value
+type pair struct {
+	key, value ast.Expression
+}
+
+func (pr pair) Pos() token.Position { return pr.key.Pos() }
+func (pr pair) End() token.Position {
+	if pr.value == nil {
+		return pr.key.End()
+	}
+	return pr.value.End()
+}
+
+// list prints elements, close is where the bracket closing them is in the source
+func (p *printer) list(elements []ast.Expression, close token.Position) {
+	items := make([]spanned, len(elements))
+	for i, e := range elements {
+		items[i] = e
+	}
+	p.items(items, close, func(i int) { p.expr(elements[i], parser.LOWEST, 0) })
+}
+
+// items prints a list separated by commas, item prints the i-th one. The list is printed on one line unless comments
+// are between its items, then each item gets a line of its own followed by the comment after it in the source
+func (p *printer) items(items []spanned, close token.Position, item func(i int)) {
+	if !p.commented(items, close.Offset) {
+		for i := range items {
+			if i > 0 {
+				p.write(", ")
+			}
+			item(i)
+		}
+		return
+	}
+	p.write("\n")
+	p.indent++
+	p.line = 0
+	for i := range items {
+		p.commentLines(items[i].Pos().Offset)
+		p.writeIndent()
+		item(i)
+		limit := close.Offset
+		if i+1 < len(items) {
+			p.write(",")
+			limit = items[i+1].Pos().Offset
+		}
+		line := items[i].End().Line
+		for ; p.next < len(p.comments) && p.comments[p.next].Pos.Offset < limit && p.comments[p.next].Pos.Line == line; p.next++ {
+			p.write(" " + p.comments[p.next].Text)
+		}
+		p.write("\n")
+		p.line = line
+	}
+	p.commentLines(close.Offset)
+	p.indent--
+	p.writeIndent()
+}
+
+// commented reports whether comments are between the items of a list that ends at offset, rather than inside them
+func (p *printer) commented(items []spanned, offset int) bool {
+	for _, c := range p.comments[p.next:] {
+		if c.Pos.Offset >= offset {
+			return false
+		}
+		inside := false
+		for _, item := range items {
+			if item.Pos().Offset <= c.Pos.Offset && c.Pos.Offset < item.End().Offset {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return true
+		}
+	}
+	return false
+}
+
+// trailing prints the comments before offset after the code printed last, the first one on its line and the others on
+// lines of their own. It reports whether there were any, what follows them needs a new line
+func (p *printer) trailing(offset int) bool {
+	if p.next == len(p.comments) || p.comments[p.next].Pos.Offset >= offset {
+		return false
+	}
+	c := p.comments[p.next]
+	p.write(" " + c.Text + "\n")
+	p.line = c.Pos.Line
+	p.next++
+	p.commentLines(offset)
+	return true
+}
+
+func (p *printer) arguments(args []ast.Expression, close token.Position) {
+	p.write("(")
+	p.list(args, close)
+	p.write(")")
+}
+
+// quote returns s in the quotes it has in the source, strings have no escapes so a string holding " is quoted with '
+func (p *printer) quote(s *ast.StringLiteral) string {
+	if offset := s.Token.Pos.Offset; offset < len(p.src) && (p.src[offset] == '\'' || p.src[offset] == '"') {
+		return p.src[offset:offset+1] + s.Value + p.src[offset:offset+1]
+	}
+	if strings.Contains(s.Value, `"`) {
+		return "'" + s.Value + "'"
+	}
+	return `"` + s.Value + `"`
+}
@@ -0,0 +1,120 @@
+package format
+
+import (
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"io/ioutil"
+	"regexp"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a=1;let b =  0.5", "let a = 1\nlet b = 0.5\n"},
+		{"const a=freeze([1])", "const a = freeze([1])\n"},
+		{"let [a,b=1,...c]=x;let {name,'k':v=2,...r}=h", "let [a, b = 1, ...c] = x\nlet {name, 'k': v = 2, ...r} = h\n"},
+		{"f(...xs,1);[...a,0];{...d,k:1}", "f(...xs, 1);\n[...a, 0]\n{...d, k: 1}\n"},
+		{"[a,b]=[b,a];let f=function([x],{y}){x}", "[a, b] = [b, a]\nlet f = function([x], {y}) {\n    x\n}\n"},
+		{"let h = function(x,y) { return x+y }", "let h = function(x, y) {\n    return x + y\n}\n"},
+		{"if (x>0) {\nreturn true\n  } else {  }", "if (x > 0) {\n    return true\n} else {}\n"},
+		{"print(typeof a == 'x', (typeof a) == \"y\")", "print(typeof a == 'x', (typeof a) == \"y\")\n"},
+		{"print((a+b)*c, a-(b-c), (a-b)-c, a*b+c, -(-a), - -1, !(a&&b))", "print((a + b) * c, a - (b - c), a - b - c, a * b + c, -(-a), -(-1), !(a && b))\n"},
+		{"arr[:2]; arr[1:]; arr[i+1:n]", "arr[:2]\narr[1:]\narr[i + 1:n]\n"},
+		{"(h.name) + 1; h.name + 1; h.f() + 1", "(h.name) + 1\nh.name + 1\nh.f() + 1\n"},
+		{"(1).abs(); a = b = c; (a = 1) + 2", "(1).abs()\na = b = c;\n(a = 1) + 2\n"},
+		{"a;\n(b + 1) * 2\nx; [1].len()\ny; -1\ni;++j", "a;\n(b + 1) * 2\nx;\n[1].len()\ny;\n-1\ni;\n++j\n"},
+		{"for (let i=0;i<3;i++) { print(i) }\nfor (;;) {break}\nfor (x of xs) {}", "for (let i = 0; i < 3; i++) {\n    print(i)\n}\nfor (;;) {\n    break\n}\nfor (let x of xs) {}\n"},
+		{"let g = function() { yield; yield 1\nyield }", "let g = function() {\n    yield;\n    yield 1\n    yield\n}\n"},
+		{"let f = function() { return; }", "let f = function() {\n    return;\n}\n"},
+		{"select { case let v = ch.recv() { print(v) } case ch.send(1) {} default {} }", "select {\n    case let v = ch.recv() {\n        print(v)\n    }\n    case ch.send(1) {}\n    default {}\n}\n"},
+		{"spawn f(1,2); print({name:'stan', arr:[1,2]}, `x ${a+1}`, tag`y`)", "spawn f(1, 2)\nprint({name: 'stan', arr: [1, 2]}, `x ${a+1}`, tag`y`)\n"},
+		// comments and blank lines
+		{"#!/usr/bin/env stang\n// header\n\nlet a = 1 // one\n\n\n\nlet b = 2\n// last", "#!/usr/bin/env stang\n// header\n\nlet a = 1 // one\n\nlet b = 2\n// last\n"},
+		{"let f = function() { // starts\n  a   // in\n\n  // end\n}", "let f = function() {\n    // starts\n    a // in\n\n    // end\n}\n"},
+		{"let x = [1, // one\n2 // two\n]", "let x = [\n    1, // one\n    2 // two\n]\n"},
+		{"f(1, // one\n// before two\n2); let h = {a: 1, // one\n...d}", "f(\n    1, // one\n    // before two\n    2\n)\nlet h = {\n    a: 1, // one\n    ...d\n}\n"},
+		{"let f = function(a, // the a\nb) {}; let [x, // first\n...rest] = xs", "let f = function(\n    a, // the a\n    b\n) {}\nlet [\n    x, // first\n    ...rest\n] = xs\n"},
+		{"test('t', function() {\n// in the body\na })", "test('t', function() {\n    // in the body\n    a\n})\n"},
+		{"if (a) {\nb\n} // after if\nelse {\nc\n}", "if (a) {\n    b\n} // after if\nelse {\n    c\n}\n"},
+		{"if (a) { b } // after if\n// before else\nelse { c } // after else", "if (a) {\n    b\n} // after if\n// before else\nelse {\n    c\n} // after else\n"},
+		{"if (a) {\n// only a comment\n}", "if (a) {\n    // only a comment\n}\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		actual, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("%q does not format: %s", tt.input, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong format of %q.\ngot=%q\nwant=%q", tt.input, actual, tt.expected)
+		}
+		checkRoundTrip(t, tt.input)
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	_, err := Source("let = 1")
+	perr, ok := err.(*ParseError)
+	if !ok || len(perr.Errors) == 0 {
+		t.Fatalf("a program that does not parse should give a ParseError. got=%v", err)
+	}
+}
+
+// TestRoundTrip formats the examples of the README
+func TestRoundTrip(t *testing.T) {
+	readme, err := ioutil.ReadFile("../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := regexp.MustCompile("(?s)```\n(.*?)```").FindAllStringSubmatch(string(readme), -1)
+	checked := 0
+	for _, block := range blocks {
+		if p := parser.New(lexer.New(block[1])); len(p.ParseProgram().Statements) == 0 || len(p.Errors()) != 0 {
+			continue // output or shell commands
+		}
+		checkRoundTrip(t, block[1])
+		checked++
+	}
+	if checked < 10 {
+		t.Fatalf("only %d examples were checked", checked)
+	}
+}
+
+// checkRoundTrip checks that formatting src is idempotent and does not change what it parses into
+func checkRoundTrip(t *testing.T, src string) {
+	t.Helper()
+	formatted, err := Source(src)
+	if err != nil {
+		t.Errorf("%q does not format: %s", src, err)
+		return
+	}
+	again, err := Source(formatted)
+	if err != nil {
+		t.Errorf("formatted %q does not parse: %s", formatted, err)
+		return
+	}
+	if again != formatted {
+		t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", formatted, again)
+	}
+	before := parser.New(lexer.New(src)).ParseProgram().String()
+	after := parser.New(lexer.New(formatted)).ParseProgram().String()
+	if before != after {
+		t.Errorf("formatting changed the program.\nbefore=%q\nafter=%q", before, after)
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parser.New(lexer.New("let f = function(a) { if (a) { return -a } }; f(1) * 2")).ParseProgram()
+	expected := "let f = function(a) {\n    if (a) {\n        return -a\n    }\n}\nf(1) * 2"
+	if actual := Node(program); actual != expected {
+		t.Errorf("wrong program. got=%q, want=%q", actual, expected)
+	}
+	call := program.Statements[2]
+	if actual := Node(call); actual != "f(1) * 2" {
+		t.Errorf("wrong statement. got=%q", actual)
+	}
+}
@@ -3,6 +3,7 @@ package lexer
 import (
 	"errors"
 	"github.com/yzbmz5913/stang/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -12,16 +13,41 @@ type Lexer struct {
 	ch           byte // current character
 	line         int
 	col          int
+	filename     string // set on every position
+	base         int    // the offset of input in its file
+	comments     []Comment
+}
+
+// Comment is a // comment, which runs to the end of the line and is skipped like whitespace
+type Comment struct {
+	Text string // the comment including the leading //, without the line break
+	Pos  token.Position
 }
 
 func New(input string) *Lexer {
 	l := &Lexer{input: input, line: 1, col: 1}
 	l.readChar()
+	// an executable script starts with a shebang line like #!/usr/bin/env stang, which is skipped
+	if strings.HasPrefix(input, "#!") {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+	return l
+}
+
+// NewFile returns a lexer for the source of f, whose positions carry the name of f
+func NewFile(f *token.File) *Lexer {
+	l := New(f.Source())
+	l.filename = f.Name()
 	return l
 }
 
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
+		if l.readPosition == len(l.input) {
+			l.col++ // the end of the input is right after its last character
+		}
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.readPosition]
@@ -63,15 +89,17 @@ var tokenMap = map[byte]token.TokenType{
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 	var tok token.Token
-	pos := token.Position{
-		Offset: l.position,
-		Line:   l.line,
-		Col:    l.col - 1,
-	}
+	pos := l.pos()
 	// starts with a symbol
 	if t, ok := tokenMap[l.ch]; ok {
 		switch t {
-		// multiple-characters operators: <= >= == != += ++ -= -- *= /=
+		// multiple-characters operators: <= >= == != += ++ -= -- *= /= ...
+		case token.DOT:
+			if strings.HasPrefix(l.input[l.position:], "...") {
+				tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+				l.readChar()
+				l.readChar()
+			}
 		case token.LT:
 			if l.peekChar() == '=' {
 				tok = token.Token{Type: token.LTE, Literal: "<="}
@@ -133,15 +161,45 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.NewToken(t, l.ch)
 		}
 		l.readChar()
-		tok.Pos = pos
+		tok.Pos, tok.End = pos, l.end(pos)
 		return tok
 	}
 	// not starts with a symbol
 	tok = l.readMultiCharToken()
-	tok.Pos = pos
+	tok.Pos, tok.End = pos, l.end(pos)
 	return tok
 }
 
+// pos returns the position of the current character
+func (l *Lexer) pos() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.base + l.position, Line: l.line, Col: l.col - 1}
+}
+
+// end returns the position right after a token starting at pos, which is the last token read
+func (l *Lexer) end(pos token.Position) token.Position {
+	offset := l.position
+	if offset > len(l.input) {
+		offset = len(l.input)
+	}
+	start := pos.Offset - l.base
+	if offset <= start {
+		return pos
+	}
+	return advance(pos, l.input[start:offset])
+}
+
+// advance returns the position right after text, which starts at pos
+func advance(pos token.Position, text string) token.Position {
+	pos.Offset += len(text)
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		pos.Line += strings.Count(text, "\n")
+		pos.Col = len(text) - i
+	} else {
+		pos.Col += len(text)
+	}
+	return pos
+}
+
 func (l *Lexer) readMultiCharToken() token.Token {
 	var tok token.Token
 	switch {
@@ -174,15 +232,43 @@ func (l *Lexer) readMultiCharToken() token.Token {
 			l.readChar()
 			return tok
 		}
+	case l.ch == '`':
+		if str, err := l.readTemplate(); err == nil {
+			tok.Type = token.TEMPLATE
+			tok.Literal = str
+			l.readChar()
+			return tok
+		}
 	}
 	l.readChar()
 	return token.NewToken(token.ILLEGAL, l.ch)
 }
 
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) skipComment() {
+	pos := l.pos()
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	text := strings.TrimRight(l.input[pos.Offset-l.base:l.position], " \t\r")
+	l.comments = append(l.comments, Comment{Text: text, Pos: pos})
+}
+
+// Comments returns the comments skipped so far, in source order
+func (l *Lexer) Comments() []Comment {
+	return l.comments
 }
 
 func (l *Lexer) peekChar() byte {
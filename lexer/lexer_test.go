@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"fmt"
 	"github.com/yzbmz5913/stang/token"
+	"strings"
 	"testing"
 )
 
@@ -74,3 +76,112 @@ let result = add(five, ten+++ten);
 		}
 	}
 }
+
+func TestTemplateToken(t *testing.T) {
+	input := "`a ${ `b ${c}` } \\`\nd`;"
+	l := New(input)
+	tok := l.NextToken()
+	if tok.Type != token.TEMPLATE {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.TEMPLATE, tok.Type)
+	}
+	if tok.Literal != "a ${ `b ${c}` } \\`\nd" {
+		t.Fatalf("literal wrong. got=%q", tok.Literal)
+	}
+	if tok = l.NextToken(); tok.Type != token.SEMICOLON {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.SEMICOLON, tok.Type)
+	}
+	if tok = New("`abc ${d").NextToken(); tok.Type != token.ILLEGAL {
+		t.Fatalf("unterminated template should be ILLEGAL, got=%q", tok.Type)
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	tests := []struct {
+		raw   string
+		parts []string
+		exprs []string
+	}{
+		{"plain", []string{"plain"}, nil},
+		{"${a}", []string{"", ""}, []string{"a"}},
+		{"x=${x}, y=${ {k:'}'}['k'] }!", []string{"x=", ", y=", "!"}, []string{"x", " {k:'}'}['k'] "}},
+		{"\\t\\${no}\\q", []string{"\t${no}q"}, nil},
+	}
+	for i, tt := range tests {
+		parts, exprs, err := SplitTemplate(tt.raw)
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %v", i, err)
+		}
+		if fmt.Sprint(parts) != fmt.Sprint(tt.parts) || fmt.Sprint(exprs) != fmt.Sprint(tt.exprs) {
+			t.Errorf("tests[%d] - expected %q %q, got %q %q", i, tt.parts, tt.exprs, parts, exprs)
+		}
+	}
+	if _, _, err := SplitTemplate("${a"); err == nil {
+		t.Errorf("expected error for unterminated interpolation")
+	}
+}
+
+func TestShebang(t *testing.T) {
+	l := New("#!/usr/bin/env stang\nlet")
+	tok := l.NextToken()
+	if tok.Type != token.LET || tok.Pos.Line != 2 || tok.Pos.Col != 1 {
+		t.Fatalf("shebang line should be skipped. got=%q at %s", tok.Type, tok.Pos)
+	}
+	if tok = New("#!").NextToken(); tok.Type != token.EOF {
+		t.Fatalf("a lone shebang should leave nothing. got=%q", tok.Type)
+	}
+}
+
+func TestComments(t *testing.T) {
+	l := New("let a = 1 // one  \n// two\na / 2")
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.IDENT, token.SLASH, token.INT}
+	if fmt.Sprint(types) != fmt.Sprint(expected) {
+		t.Fatalf("comments should be skipped. got=%v", types)
+	}
+	comments := l.Comments()
+	if len(comments) != 2 {
+		t.Fatalf("wrong number of comments. got=%d", len(comments))
+	}
+	if comments[0].Text != "// one" || comments[0].Pos.String() != "1:11" {
+		t.Errorf("wrong first comment. got=%q at %s", comments[0].Text, comments[0].Pos)
+	}
+	if comments[1].Text != "// two" || comments[1].Pos.String() != "2:1" {
+		t.Errorf("wrong second comment. got=%q at %s", comments[1].Text, comments[1].Pos)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	src := "let s = 'a b'\nx >= `one\ntwo ${y +\n1}`"
+	l := NewFile(token.NewFile("f.stg", src))
+	expected := []string{
+		"f.stg:1:1 f.stg:1:4", "f.stg:1:5 f.stg:1:6", "f.stg:1:7 f.stg:1:8", "f.stg:1:9 f.stg:1:14",
+		"f.stg:2:1 f.stg:2:2", "f.stg:2:3 f.stg:2:5", "f.stg:2:6 f.stg:4:4", "f.stg:4:4 f.stg:4:4",
+	}
+	var toks []token.Token
+	for i := range expected {
+		tok := l.NextToken()
+		toks = append(toks, tok)
+		if got := fmt.Sprintf("%s %s", tok.Pos, tok.End); got != expected[i] {
+			t.Errorf("tests[%d] - %q: wrong span. got=%s, want=%s", i, tok.Literal, got, expected[i])
+		}
+	}
+
+	// the embedded expressions are where they are in the file
+	_, exprs, err := SplitTemplateToken(toks[6])
+	if err != nil || len(exprs) != 1 {
+		t.Fatalf("wrong split %v %v", exprs, err)
+	}
+	var got []string
+	for tok := exprs[0].NextToken(); tok.Type != token.EOF; tok = exprs[0].NextToken() {
+		got = append(got, fmt.Sprintf("%s@%s", tok.Literal, tok.Pos))
+		if src[tok.Pos.Offset:tok.End.Offset] != tok.Literal {
+			t.Errorf("%q: wrong offsets %d-%d", tok.Literal, tok.Pos.Offset, tok.End.Offset)
+		}
+	}
+	if expected := "y@f.stg:3:7 +@f.stg:3:9 1@f.stg:4:1"; strings.Join(got, " ") != expected {
+		t.Errorf("wrong interpolation tokens. got=%s, want=%s", strings.Join(got, " "), expected)
+	}
+}
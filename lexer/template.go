@@ -0,0 +1,150 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/yzbmz5913/stang/token"
+	"strings"
+)
+
+// template.go handles backtick template literals, e.g. `hello ${name}!`
+// The lexer emits the raw body of a template as a single TEMPLATE token,
+// SplitTemplate is then used by the parser to cut it into literal parts and embedded expressions.
+
+func (l *Lexer) readTemplate() (string, error) {
+	start := l.readPosition
+	end := scanTemplate(l.input, l.position)
+	if end < 0 {
+		for l.ch != 0 {
+			l.readChar()
+		}
+		return "", errors.New("unterminated template literal")
+	}
+	for l.position < end {
+		l.readChar()
+	}
+	return l.input[start:end], nil
+}
+
+// scanTemplate returns the index of the backtick closing the template opened at input[open], or -1
+func scanTemplate(input string, open int) int {
+	for i := open + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case '`':
+			return i
+		case '$':
+			if i+1 < len(input) && input[i+1] == '{' {
+				if i = scanInterpolation(input, i+2); i < 0 {
+					return -1
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// scanInterpolation returns the index of the '}' closing an interpolation whose body starts at input[start], or -1
+func scanInterpolation(input string, start int) int {
+	depth := 1
+	for i := start; i < len(input); i++ {
+		switch c := input[i]; c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '\'', '"':
+			closing := strings.IndexByte(input[i+1:], c)
+			if closing < 0 {
+				return -1
+			}
+			i += closing + 1
+		case '`':
+			if i = scanTemplate(input, i); i < 0 {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+var templateEscapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'`':  '`',
+	'$':  '$',
+	'\'': '\'',
+	'"':  '"',
+}
+
+// SplitTemplate cuts the raw body of a template literal into its literal parts and the source of its
+// embedded expressions. Escape sequences in the literal parts are resolved.
+// The result always satisfies len(parts) == len(exprs)+1.
+func SplitTemplate(raw string) (parts []string, exprs []string, err error) {
+	parts, exprs, _, err = splitTemplate(raw)
+	return parts, exprs, err
+}
+
+// SplitTemplateToken is SplitTemplate for a TEMPLATE token, the embedded expressions come as lexers whose
+// positions are where the expressions are in the file of tok
+func SplitTemplateToken(tok token.Token) (parts []string, exprs []*Lexer, err error) {
+	parts, sources, offsets, err := splitTemplate(tok.Literal)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := tok.Pos
+	if body.IsValid() {
+		body = advance(body, "`")
+	}
+	for i, src := range sources {
+		l := &Lexer{input: src, base: body.Offset, filename: body.Filename, line: body.Line, col: body.Col}
+		if body.IsValid() {
+			at := advance(body, tok.Literal[:offsets[i]])
+			l.base, l.line, l.col = at.Offset, at.Line, at.Col
+		}
+		l.readChar()
+		exprs = append(exprs, l)
+	}
+	return parts, exprs, nil
+}
+
+// splitTemplate is SplitTemplate which also returns the offsets in raw where the embedded expressions start
+func splitTemplate(raw string) (parts []string, exprs []string, offsets []int, err error) {
+	var buf strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(raw) {
+				return nil, nil, nil, errors.New("unterminated escape sequence in template literal")
+			}
+			i++
+			if escaped, ok := templateEscapes[raw[i]]; ok {
+				buf.WriteByte(escaped)
+			} else {
+				buf.WriteByte(raw[i])
+			}
+		case c == '$' && i+1 < len(raw) && raw[i+1] == '{':
+			end := scanInterpolation(raw, i+2)
+			if end < 0 {
+				return nil, nil, nil, fmt.Errorf("unterminated interpolation at offset %d in template literal", i)
+			}
+			parts = append(parts, buf.String())
+			buf.Reset()
+			exprs = append(exprs, raw[i+2:end])
+			offsets = append(offsets, i+2)
+			i = end
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	parts = append(parts, buf.String())
+	return parts, exprs, offsets, nil
+}
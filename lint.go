@@ -0,0 +1,69 @@
+package stang
+
+import (
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/lint"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"sort"
+)
+
+const lintUsage = `usage: stang lint [file...]
+  reports likely mistakes in the files, or stdin when there are none, and exits with 1 if there are any.
+  A comment // lint:ignore rule,... silences rules on its line and the next. The rules are:
+`
+
+func lintCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("stang lint", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	f.Usage = func() {
+		_, _ = io.WriteString(stderr, lintUsage)
+		var rules []string
+		for rule := range lint.Rules {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+		for _, rule := range rules {
+			_, _ = fmt.Fprintf(stderr, "  %-20s %s\n", rule, lint.Rules[rule])
+		}
+	}
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	files := f.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	code := ExitOK
+	for _, name := range files {
+		src, err := readSource(name, stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			code = ExitUsage
+			continue
+		}
+		file := token.NewFile(name, src)
+		l := lexer.NewFile(file)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			reportParseErrors(stderr, file, p.Errors())
+			code = ExitSyntaxError
+			continue
+		}
+		for _, d := range lint.Check(program, l.Comments()) {
+			_, _ = fmt.Fprintf(stdout, "%s\n", d) // the position of d names the file
+			if code == ExitOK {
+				code = ExitRuntimeError
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,425 @@
+// Package lint finds likely mistakes in stang programs without running them.
+//
+// A comment like // lint:ignore unused,arity silences the listed rules, or all of them when none is listed,
+// on its own line and the line after it.
+package lint
+
+import (
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/token"
+	"sort"
+	"strings"
+)
+
+// Rules maps the ID of each rule to what it reports
+var Rules = map[string]string{
+	"unused":              "a variable declared with let inside a function or loop is never read",
+	"unreachable":         "a statement follows return, break or continue",
+	"assign-in-condition": "the condition of an if, while or for is an assignment, == was probably intended",
+	"shadow-builtin":      "a variable or parameter hides a builtin like len or print",
+	"arity":               "a function is called with a different number of arguments than it has parameters",
+	"duplicate-key":       "a hash literal has the same key twice",
+}
+
+// Diagnostic is a problem found in a program
+type Diagnostic struct {
+	Pos     token.Position
+	End     token.Position // right after the code the problem is about
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Check lints program, comments are those of its source and may hold lint:ignore directives
+func Check(program *ast.Program, comments []lexer.Comment) []Diagnostic {
+	l := &linter{}
+	l.open(false)
+	l.statements(program.Statements)
+	l.close()
+
+	ignored := map[int][]string{} // line to the rules ignored on it, an empty list ignores all
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		if !strings.HasPrefix(text, "lint:ignore") {
+			continue
+		}
+		rules := strings.FieldsFunc(strings.TrimPrefix(text, "lint:ignore"), func(r rune) bool { return r == ',' || r == ' ' })
+		for _, line := range []int{c.Pos.Line, c.Pos.Line + 1} {
+			if existing, ok := ignored[line]; ok && (len(existing) == 0 || len(rules) == 0) {
+				ignored[line] = []string{}
+			} else {
+				ignored[line] = append(existing, rules...)
+			}
+		}
+	}
+	var result []Diagnostic
+	for _, d := range l.diagnostics {
+		if rules, ok := ignored[d.Pos.Line]; ok && (len(rules) == 0 || contains(rules, d.Rule)) {
+			continue
+		}
+		result = append(result, d)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Pos.Offset < result[j].Pos.Offset })
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// variable is a name declared by let, a parameter or a loop
+type variable struct {
+	name       string
+	pos, end   token.Position
+	isLet      bool
+	used       bool
+	function   *ast.FunctionLiteral // the function a let is bound to
+	reassigned bool
+	calls      []*ast.CallExpression
+}
+
+// scope mirrors the scopes the evaluator creates: functions and loops get their own, if blocks do not
+type scope struct {
+	parent    *scope
+	local     bool // whether unused variables are reported, they are not at the top level
+	variables map[string]*variable
+	order     []*variable
+	// unresolved are the names used in functions before they were declared, they are looked up when the function runs
+	unresolved map[string]bool
+}
+
+type linter struct {
+	scope       *scope
+	diagnostics []Diagnostic
+}
+
+func (l *linter) report(pos, end token.Position, rule, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Pos: pos, End: end, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) open(local bool) {
+	l.scope = &scope{parent: l.scope, local: local, variables: map[string]*variable{}, unresolved: map[string]bool{}}
+}
+
+func (l *linter) close() {
+	s := l.scope
+	for _, v := range s.order {
+		if s.local && v.isLet && !v.used {
+			l.report(v.pos, v.end, "unused", "%s is declared but never used", v.name)
+		}
+		if v.function == nil || v.reassigned {
+			continue
+		}
+		for _, call := range v.calls {
+			if len(call.Arguments) != len(v.function.Parameters) && !hasSpread(call.Arguments) {
+				l.report(call.Token.Pos, call.End(), "arity", "%s takes %d arguments but is called with %d", v.name, len(v.function.Parameters), len(call.Arguments))
+			}
+		}
+	}
+	l.scope = s.parent
+}
+
+func (l *linter) declare(name *ast.Identifier, isLet bool) *variable {
+	if evaluator.LookupBuiltin(name.Value) != nil {
+		l.report(name.Token.Pos, name.End(), "shadow-builtin", "%s hides the builtin of the same name", name.Value)
+	}
+	v := &variable{name: name.Value, pos: name.Token.Pos, end: name.End(), isLet: isLet, used: l.scope.unresolved[name.Value]}
+	if _, ok := l.scope.variables[name.Value]; !ok {
+		l.scope.order = append(l.scope.order, v)
+	}
+	l.scope.variables[name.Value] = v
+	return v
+}
+
+// bind declares the names a let or a parameter binds, the defaults of a pattern are checked before the names after them
+func (l *linter) bind(target ast.Expression, isLet bool) {
+	switch n := target.(type) {
+	case *ast.Identifier:
+		l.declare(n, isLet)
+	case *ast.AssignExpression:
+		l.expr(n.Value)
+		l.bind(n.Name, isLet)
+	case *ast.ArrayPattern:
+		for _, e := range n.Elements {
+			l.bind(e, isLet)
+		}
+		l.bind(n.Rest, isLet)
+	case *ast.HashPattern:
+		for _, p := range n.Properties {
+			l.bind(p.Value, isLet)
+		}
+		l.bind(n.Rest, isLet)
+	}
+}
+
+// assign checks the target of an assignment, only a compound assignment reads the variable it assigns
+func (l *linter) assign(target ast.Expression, reads bool) {
+	switch n := target.(type) {
+	case *ast.Identifier:
+		if v := l.lookup(n.Value); v != nil {
+			v.reassigned = true
+			if reads {
+				v.used = true
+			}
+		}
+	case *ast.AssignExpression:
+		// a default in a pattern, [a = 1] = xs
+		l.expr(n.Value)
+		l.assign(n.Name, false)
+	case *ast.ArrayPattern:
+		for _, e := range n.Elements {
+			l.assign(e, false)
+		}
+		l.assign(n.Rest, false)
+	case *ast.HashPattern:
+		for _, p := range n.Properties {
+			l.assign(p.Value, false)
+		}
+		l.assign(n.Rest, false)
+	default:
+		l.expr(target)
+	}
+}
+
+// hasSpread reports whether some of args are spread, so that their number is only known when the call runs
+func hasSpread(args []ast.Expression) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) lookup(name string) *variable {
+	for s := l.scope; s != nil; s = s.parent {
+		if v, ok := s.variables[name]; ok {
+			return v
+		}
+	}
+	for s := l.scope; s != nil; s = s.parent {
+		s.unresolved[name] = true
+	}
+	return nil
+}
+
+func (l *linter) statements(stmts []ast.Statement) {
+	terminated := false
+	for _, stmt := range stmts {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && es.Expression == nil {
+			continue
+		}
+		if terminated {
+			l.report(startOf(stmt), stmt.End(), "unreachable", "unreachable code")
+			terminated = false
+		}
+		l.statement(stmt)
+		switch s := stmt.(type) {
+		case *ast.ReturnStatement:
+			terminated = true
+		case *ast.ExpressionStatement:
+			switch s.Expression.(type) {
+			case *ast.BreakExpression, *ast.ContinueExpression:
+				terminated = true
+			}
+		}
+	}
+}
+
+func startOf(stmt ast.Statement) token.Position {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		return s.Token.Pos
+	case *ast.ReturnStatement:
+		return s.Token.Pos
+	case *ast.DeleteStatement:
+		return s.Token.Pos
+	case *ast.ExpressionStatement:
+		return s.Token.Pos
+	}
+	return token.Position{}
+}
+
+func (l *linter) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		l.expr(s.Value)
+		if name, ok := s.Name.(*ast.Identifier); ok {
+			v := l.declare(name, true)
+			v.function, _ = s.Value.(*ast.FunctionLiteral)
+		} else {
+			l.bind(s.Name, true)
+		}
+	case *ast.ReturnStatement:
+		l.expr(s.ReturnValue)
+	case *ast.DeleteStatement:
+		l.expr(s.Value)
+	case *ast.ExpressionStatement:
+		l.expr(s.Expression)
+	case *ast.BlockStatement:
+		l.statements(s.Statements)
+	}
+}
+
+// condition checks the condition of an if or a loop
+func (l *linter) condition(cond ast.Expression) {
+	if assign, ok := cond.(*ast.AssignExpression); ok {
+		l.report(assign.Token.Pos, assign.End(), "assign-in-condition", "assignment used as a condition, == was probably intended")
+	}
+	l.expr(cond)
+}
+
+func (l *linter) expr(e ast.Expression) {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		if v := l.lookup(n.Value); v != nil {
+			v.used = true
+		}
+	case *ast.PrefixExpression:
+		l.expr(n.Right)
+	case *ast.InfixExpression:
+		l.expr(n.Left)
+		l.expr(n.Right)
+	case *ast.PostfixExpression:
+		l.expr(n.Left)
+	case *ast.AssignExpression:
+		l.assign(n.Name, n.Token.Type != token.ASSIGN)
+		l.expr(n.Value)
+	case *ast.CallExpression:
+		if name, ok := n.Function.(*ast.Identifier); ok {
+			if v := l.lookup(name.Value); v != nil {
+				v.calls = append(v.calls, n)
+			}
+		}
+		l.expr(n.Function)
+		l.exprs(n.Arguments)
+	case *ast.IndexExpression:
+		l.expr(n.Left)
+		l.expr(n.Index)
+	case *ast.SliceExpression:
+		l.expr(n.Start)
+		l.expr(n.Stop)
+	case *ast.MethodCallExpression:
+		l.expr(n.Object)
+		// the method name is not a variable, its arguments are
+		switch call := n.Call.(type) {
+		case *ast.CallExpression:
+			l.exprs(call.Arguments)
+		case *ast.Identifier:
+		default:
+			l.expr(call)
+		}
+	case *ast.ArrayLiteral:
+		l.exprs(n.Elements)
+	case *ast.SpreadExpression:
+		l.expr(n.Value)
+	case *ast.HashLiteral:
+		seen := map[string]bool{}
+		for _, key := range n.Keys {
+			if k, pos, ok := hashKey(key); ok {
+				if seen[k] {
+					l.report(pos, key.End(), "duplicate-key", "duplicate key %s in hash literal", key.String())
+				}
+				seen[k] = true
+			}
+			if _, ok := key.(*ast.Identifier); !ok {
+				l.expr(key)
+			}
+			l.expr(n.Pairs[key])
+		}
+	case *ast.TemplateLiteral:
+		l.exprs(n.Expressions)
+	case *ast.TaggedTemplateExpression:
+		l.expr(n.Tag)
+		l.expr(n.Template)
+	case *ast.TypeofExpression:
+		l.expr(n.Expr)
+	case *ast.YieldExpression:
+		l.expr(n.Value)
+	case *ast.SpawnExpression:
+		l.expr(n.Call)
+	case *ast.IfExpression:
+		l.condition(n.Condition)
+		l.statement(n.Consequence)
+		if n.Alternative != nil {
+			l.statement(n.Alternative)
+		}
+	case *ast.WhileExpression:
+		l.open(true)
+		l.condition(n.Condition)
+		l.statement(n.Body)
+		l.close()
+	case *ast.ForExpression:
+		l.open(true)
+		switch init := n.Init.(type) {
+		case *ast.LetStatement:
+			l.statement(init)
+		case ast.Expression:
+			l.expr(init)
+		}
+		if n.Condition != nil {
+			l.condition(n.Condition)
+		}
+		l.expr(n.Update)
+		l.open(true)
+		l.statement(n.Body)
+		l.close()
+		l.close()
+	case *ast.ForOfExpression:
+		l.expr(n.Iterable)
+		l.open(true)
+		l.declare(n.Name, false)
+		l.statement(n.Body)
+		l.close()
+	case *ast.FunctionLiteral:
+		l.open(true)
+		for _, param := range n.Parameters {
+			l.bind(param, false)
+		}
+		l.statement(n.Body)
+		l.close()
+	case *ast.SelectExpression:
+		for _, c := range n.Cases {
+			l.expr(c.Channel)
+			l.expr(c.Send)
+			l.open(true)
+			if c.Name != nil {
+				l.declare(c.Name, false)
+			}
+			l.statement(c.Body)
+			l.close()
+		}
+	}
+}
+
+func (l *linter) exprs(list []ast.Expression) {
+	for _, e := range list {
+		l.expr(e)
+	}
+}
+
+// hashKey returns what a literal key of a hash literal evaluates to and where it is, identifiers are strings
+func hashKey(key ast.Expression) (string, token.Position, bool) {
+	switch k := key.(type) {
+	case *ast.Identifier:
+		return "STRING:" + k.Value, k.Token.Pos, true
+	case *ast.StringLiteral:
+		return "STRING:" + k.Value, k.Token.Pos, true
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("INTEGER:%d", k.Value), k.Token.Pos, true
+	case *ast.BooleanLiteral:
+		return fmt.Sprintf("BOOLEAN:%t", k.Value), k.Token.Pos, true
+	}
+	return "", token.Position{}, false
+}
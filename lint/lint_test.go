@@ -0,0 +1,51 @@
+package lint
+
+import (
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let f = function(a) { let unused = 1\nreturn a }", []string{"1:27: unused is declared but never used (unused)"}},
+		{"let top = 1", nil},
+		{"let f = function() { let x = 1\nx = 2 }", []string{"1:26: x is declared but never used (unused)"}},
+		{"let f = function() { let x = 1\nx += 2 }", nil},
+		{"let f = function() { let g = function() { return h() }\nlet h = function() { 1 }\ng() }", nil},
+		{"while (true) { let i = 0 }", []string{"1:20: i is declared but never used (unused)"}},
+		{"let f = function() { return 1\nprint(2)\nprint(3) }", []string{"2:1: unreachable code (unreachable)"}},
+		{"while (true) { break\n1 }", []string{"2:1: unreachable code (unreachable)"}},
+		{"let a = 0\nif (a = 1) { a }\nwhile (a = 2) {}", []string{"2:7: assignment used as a condition, == was probably intended (assign-in-condition)", "3:10: assignment used as a condition, == was probably intended (assign-in-condition)"}},
+		{"if (a == 1) { a }", nil},
+		{"let len = 1\nlet f = function(print) { print }\nfor (let time of []) { time }", []string{"1:5: len hides the builtin of the same name (shadow-builtin)", "2:18: print hides the builtin of the same name (shadow-builtin)", "3:10: time hides the builtin of the same name (shadow-builtin)"}},
+		{"let add = function(a, b) { a + b }\nadd(1)\nadd(1, 2)\nadd(1, 2, 3)", []string{"2:4: add takes 2 arguments but is called with 1 (arity)", "4:4: add takes 2 arguments but is called with 3 (arity)"}},
+		{"let add = function(a, b) { a + b }\nadd(...[1, 2])\nadd(1, ...[2])", nil},
+		{"let add = function(a, b) { a + b }\nadd = function(a) { a }\nadd(1)", nil},
+		{"let h = {a: 1, 'a': 2, 1: 3, 1: 4, true: 5, x + 1: 6, x + 1: 7}", []string{"1:16: duplicate key a in hash literal (duplicate-key)", "1:30: duplicate key 1 in hash literal (duplicate-key)"}},
+		// suppression
+		{"let len = 1 // lint:ignore shadow-builtin", nil},
+		{"// lint:ignore\nlet len = {a: 1, a: 2}", nil},
+		{"let len = {a: 1, a: 2} // lint:ignore duplicate-key", []string{"1:5: len hides the builtin of the same name (shadow-builtin)"}},
+		{"// lint:ignore unused\nlet len = 1", []string{"2:5: len hides the builtin of the same name (shadow-builtin)"}},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q does not parse: %v", tt.input, p.Errors())
+		}
+		var actual []string
+		for _, d := range Check(program, l.Comments()) {
+			actual = append(actual, d.String())
+		}
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\ngot=%q\nwant=%q", tt.input, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package stang
+
+import (
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/lsp"
+	"io"
+)
+
+const lspUsage = `usage: stang lsp
+  starts a language server speaking the Language Server Protocol on stdin and stdout, for editors to run.
+`
+
+func lspCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("stang lsp", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	f.Usage = func() { _, _ = io.WriteString(stderr, lspUsage) }
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if f.NArg() != 0 {
+		f.Usage()
+		return ExitUsage
+	}
+	if err := lsp.Serve(stdin, stdout); err != nil {
+		_, _ = fmt.Fprintf(stderr, "stang lsp: %s\n", err)
+		return ExitRuntimeError
+	}
+	return ExitOK
+}
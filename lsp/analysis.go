@@ -0,0 +1,459 @@
+package lsp
+
+import (
+	"context"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"sort"
+	"time"
+)
+
+// analysis.go indexes a document: which declaration each identifier refers to, its symbols and what its variables hold
+
+type document struct {
+	text     string
+	program  *ast.Program
+	errors   []string // of the parser
+	comments []lexer.Comment
+	refs     []*reference // every identifier naming a variable, in source order
+	decls    []*declaration
+	symbols  []DocumentSymbol
+	lines    []int // the offsets the lines start at
+	utf16    bool  // whether positions count utf-16 code units instead of bytes
+}
+
+// declaration is where a variable is introduced
+type declaration struct {
+	name  *ast.Identifier
+	kind  string         // let, const, parameter or loop variable
+	value ast.Expression // the value of a let
+	owner *ast.FunctionLiteral
+}
+
+type reference struct {
+	ident *ast.Identifier
+	decl  *declaration // nil for builtins and unknown names
+}
+
+type scope struct {
+	parent *scope
+	decls  map[string]*declaration
+}
+
+// resolver walks a program the way the evaluator scopes it: functions and loops get a scope of their own, if blocks do not.
+// Functions run after the statements following them, so names they use that are not declared yet are resolved at the end.
+type resolver struct {
+	doc      *document
+	scope    *scope
+	pending  []pendingRef
+	symbols  *[]DocumentSymbol
+	function *ast.FunctionLiteral
+}
+
+type pendingRef struct {
+	ref   *reference
+	scope *scope
+}
+
+func analyze(text string, utf16 bool) (doc *document) {
+	l := lexer.New(text)
+	p := parser.New(l)
+	doc = &document{text: text, program: p.ParseProgram(), errors: p.Errors(), comments: l.Comments(), lines: []int{0}, utf16: utf16}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lines = append(doc.lines, i+1)
+		}
+	}
+	defer func() {
+		// the program of a document being edited may be missing any part, it is indexed as far as possible
+		if recover() != nil {
+			doc.refs, doc.decls, doc.symbols = nil, nil, nil
+		}
+	}()
+	r := &resolver{doc: doc, scope: &scope{decls: map[string]*declaration{}}, symbols: &doc.symbols}
+	r.statements(doc.program.Statements)
+	for _, p := range r.pending {
+		p.ref.decl = lookup(p.scope, p.ref.ident.Value)
+	}
+	sort.SliceStable(doc.refs, func(i, j int) bool { return doc.refs[i].ident.Token.Pos.Offset < doc.refs[j].ident.Token.Pos.Offset })
+	return doc
+}
+
+func lookup(s *scope, name string) *declaration {
+	for ; s != nil; s = s.parent {
+		if d, ok := s.decls[name]; ok {
+			return d
+		}
+	}
+	return nil
+}
+
+func (r *resolver) open() {
+	r.scope = &scope{parent: r.scope, decls: map[string]*declaration{}}
+}
+
+func (r *resolver) close() {
+	r.scope = r.scope.parent
+}
+
+func (r *resolver) declare(name *ast.Identifier, kind string, value ast.Expression) *declaration {
+	d := &declaration{name: name, kind: kind, value: value, owner: r.function}
+	r.scope.decls[name.Value] = d
+	r.doc.decls = append(r.doc.decls, d)
+	r.doc.refs = append(r.doc.refs, &reference{ident: name, decl: d})
+	return d
+}
+
+// bind declares the names bound by a pattern of a let or a parameter, each listed as a variable symbol of a let
+func (r *resolver) bind(target ast.Expression, kind string) {
+	switch n := target.(type) {
+	case *ast.Identifier:
+		if kind != "parameter" {
+			*r.symbols = append(*r.symbols, DocumentSymbol{Name: n.Value, Kind: SymbolVariable, Range: r.doc.identRange(n), SelectionRange: r.doc.identRange(n)})
+		}
+		r.declare(n, kind, nil)
+	case *ast.AssignExpression:
+		r.expr(n.Value)
+		r.bind(n.Name, kind)
+	case *ast.ArrayPattern:
+		for _, e := range n.Elements {
+			r.bind(e, kind)
+		}
+		r.bind(n.Rest, kind)
+	case *ast.HashPattern:
+		for _, p := range n.Properties {
+			r.bind(p.Value, kind)
+		}
+		r.bind(n.Rest, kind)
+	}
+}
+
+func (r *resolver) use(ident *ast.Identifier) {
+	ref := &reference{ident: ident, decl: lookup(r.scope, ident.Value)}
+	r.doc.refs = append(r.doc.refs, ref)
+	if ref.decl == nil && evaluator.LookupBuiltin(ident.Value) == nil {
+		r.pending = append(r.pending, pendingRef{ref: ref, scope: r.scope})
+	}
+}
+
+func (r *resolver) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		name, ok := s.Name.(*ast.Identifier)
+		if !ok {
+			r.expr(s.Value)
+			r.bind(s.Name, s.Token.Literal)
+			return
+		}
+		symbol := DocumentSymbol{Name: name.Value, Kind: SymbolVariable, Range: r.doc.identRange(name), SelectionRange: r.doc.identRange(name)}
+		if _, ok := s.Value.(*ast.FunctionLiteral); ok {
+			symbol.Kind = SymbolFunction
+		}
+		outer := r.symbols
+		r.symbols = &symbol.Children
+		r.expr(s.Value)
+		r.symbols = outer
+		*r.symbols = append(*r.symbols, symbol)
+		r.declare(name, s.Token.Literal, s.Value)
+	case *ast.ReturnStatement:
+		r.expr(s.ReturnValue)
+	case *ast.DeleteStatement:
+		r.expr(s.Value)
+	case *ast.ExpressionStatement:
+		r.expr(s.Expression)
+	case *ast.BlockStatement:
+		if s != nil {
+			r.statements(s.Statements)
+		}
+	}
+}
+
+func (r *resolver) exprs(list []ast.Expression) {
+	for _, e := range list {
+		r.expr(e)
+	}
+}
+
+func (r *resolver) expr(e ast.Expression) {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		r.use(n)
+	case *ast.PrefixExpression:
+		r.expr(n.Right)
+	case *ast.InfixExpression:
+		r.expr(n.Left)
+		r.expr(n.Right)
+	case *ast.PostfixExpression:
+		r.expr(n.Left)
+	case *ast.AssignExpression:
+		r.expr(n.Name)
+		r.expr(n.Value)
+	case *ast.ArrayPattern:
+		r.exprs(n.Elements)
+		r.expr(n.Rest)
+	case *ast.HashPattern:
+		// the keys are not variables
+		for _, p := range n.Properties {
+			r.expr(p.Value)
+		}
+		r.expr(n.Rest)
+	case *ast.CallExpression:
+		r.expr(n.Function)
+		r.exprs(n.Arguments)
+	case *ast.IndexExpression:
+		r.expr(n.Left)
+		r.expr(n.Index)
+	case *ast.SliceExpression:
+		r.expr(n.Start)
+		r.expr(n.Stop)
+	case *ast.MethodCallExpression:
+		r.expr(n.Object)
+		switch call := n.Call.(type) {
+		case *ast.CallExpression:
+			r.exprs(call.Arguments)
+		case *ast.Identifier:
+		default:
+			r.expr(call)
+		}
+	case *ast.ArrayLiteral:
+		r.exprs(n.Elements)
+	case *ast.SpreadExpression:
+		r.expr(n.Value)
+	case *ast.HashLiteral:
+		for _, key := range n.Keys {
+			if _, ok := key.(*ast.Identifier); !ok {
+				r.expr(key)
+			}
+			r.expr(n.Pairs[key])
+		}
+	case *ast.TemplateLiteral:
+		// the expressions of a template are parsed from its body, their positions are not those of the document
+	case *ast.TaggedTemplateExpression:
+		r.expr(n.Tag)
+	case *ast.TypeofExpression:
+		r.expr(n.Expr)
+	case *ast.YieldExpression:
+		r.expr(n.Value)
+	case *ast.SpawnExpression:
+		if n.Call != nil {
+			r.expr(n.Call)
+		}
+	case *ast.IfExpression:
+		r.expr(n.Condition)
+		r.statement(n.Consequence)
+		if n.Alternative != nil {
+			r.statement(n.Alternative)
+		}
+	case *ast.WhileExpression:
+		r.open()
+		r.expr(n.Condition)
+		r.statement(n.Body)
+		r.close()
+	case *ast.ForExpression:
+		r.open()
+		switch init := n.Init.(type) {
+		case *ast.LetStatement:
+			r.statement(init)
+		case ast.Expression:
+			r.expr(init)
+		}
+		r.expr(n.Condition)
+		r.expr(n.Update)
+		r.open()
+		r.statement(n.Body)
+		r.close()
+		r.close()
+	case *ast.ForOfExpression:
+		r.expr(n.Iterable)
+		r.open()
+		r.declare(n.Name, "loop variable", nil)
+		r.statement(n.Body)
+		r.close()
+	case *ast.FunctionLiteral:
+		outer := r.function
+		r.function = n
+		r.open()
+		for _, param := range n.Parameters {
+			r.bind(param, "parameter")
+		}
+		r.statement(n.Body)
+		r.close()
+		r.function = outer
+	case *ast.SelectExpression:
+		for _, c := range n.Cases {
+			r.expr(c.Channel)
+			r.expr(c.Send)
+			r.open()
+			if c.Name != nil {
+				r.declare(c.Name, "case variable", nil)
+			}
+			r.statement(c.Body)
+			r.close()
+		}
+	}
+}
+
+// referenceAt returns the identifier at offset, offsets just past an identifier count for it
+func (d *document) referenceAt(offset int) *reference {
+	i := sort.Search(len(d.refs), func(i int) bool { return d.refs[i].ident.Token.Pos.Offset > offset })
+	if i == 0 {
+		return nil
+	}
+	ref := d.refs[i-1]
+	if start := ref.ident.Token.Pos.Offset; offset <= start+len(ref.ident.Value) {
+		return ref
+	}
+	return nil
+}
+
+// typeOf infers the type of e without running it, "" when it is not known
+func (d *document) typeOf(e ast.Expression, depth int) evaluator.ObjectType {
+	if depth > 8 {
+		return ""
+	}
+	switch n := e.(type) {
+	case *ast.IntegerLiteral:
+		return evaluator.IntegerObj
+	case *ast.FloatLiteral:
+		return evaluator.FloatObj
+	case *ast.StringLiteral, *ast.TemplateLiteral, *ast.TypeofExpression:
+		return evaluator.StringObj
+	case *ast.BooleanLiteral:
+		return evaluator.BooleanObj
+	case *ast.NullExpression:
+		return evaluator.NullObj
+	case *ast.ArrayLiteral:
+		return evaluator.ArrayObj
+	case *ast.HashLiteral:
+		return evaluator.HashObj
+	case *ast.FunctionLiteral:
+		return evaluator.FunctionObj
+	case *ast.SpawnExpression:
+		return evaluator.TaskObj
+	case *ast.PrefixExpression:
+		if n.Operator == "!" {
+			return evaluator.BooleanObj
+		}
+		return d.typeOf(n.Right, depth+1)
+	case *ast.InfixExpression:
+		switch n.Operator {
+		case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+			return evaluator.BooleanObj
+		}
+		left, right := d.typeOf(n.Left, depth+1), d.typeOf(n.Right, depth+1)
+		switch {
+		case n.Operator == "+" && (left == evaluator.StringObj || right == evaluator.StringObj):
+			return evaluator.StringObj
+		case left == evaluator.IntegerObj && right == evaluator.IntegerObj:
+			return evaluator.IntegerObj
+		case (left == evaluator.IntegerObj || left == evaluator.FloatObj) && (right == evaluator.IntegerObj || right == evaluator.FloatObj):
+			return evaluator.FloatObj
+		}
+	case *ast.Identifier:
+		if ref := d.referenceAt(n.Token.Pos.Offset); ref != nil && ref.ident == n && ref.decl != nil && ref.decl.value != nil {
+			return d.typeOf(ref.decl.value, depth+1)
+		}
+		if obj := evaluator.LookupBuiltin(n.Value); obj != nil {
+			return obj.Type()
+		}
+	case *ast.CallExpression:
+		if ident, ok := n.Function.(*ast.Identifier); ok {
+			if ref := d.referenceAt(ident.Token.Pos.Offset); ref != nil && ref.decl != nil {
+				if fn, ok := ref.decl.value.(*ast.FunctionLiteral); ok && fn.IsGenerator {
+					return evaluator.GeneratorObj
+				}
+				return ""
+			}
+			return builtinResults[ident.Value]
+		}
+	}
+	return ""
+}
+
+// builtinResults are the types the builtins return
+var builtinResults = map[string]evaluator.ObjectType{
+	"len":     evaluator.IntegerObj,
+	"int":     evaluator.IntegerObj,
+	"string":  evaluator.StringObj,
+	"format":  evaluator.StringObj,
+	"methods": evaluator.ArrayObj,
+	"now":     evaluator.TimeObj,
+	"channel": evaluator.ChannelObj,
+}
+
+// constant reports whether e is made of literals and operators only, so that evaluating it cannot have effects
+func constant(e ast.Expression) bool {
+	switch n := e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullExpression:
+		return true
+	case *ast.PrefixExpression:
+		return n.Operator != "++" && n.Operator != "--" && constant(n.Right)
+	case *ast.InfixExpression:
+		return constant(n.Left) && constant(n.Right)
+	case *ast.ArrayLiteral:
+		for _, element := range n.Elements {
+			if !constant(element) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// valueOf evaluates a constant expression
+func valueOf(e ast.Expression) evaluator.Object {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	return evaluator.Eval(ctx, e, evaluator.NewScope(nil))
+}
+
+// position converts a line and a byte column, both counted from 1, to a position in the encoding of the client
+func (d *document) position(line, col int) Position {
+	pos := Position{Line: line - 1, Character: col - 1}
+	if !d.utf16 || line < 1 || line > len(d.lines) || col < 1 {
+		return pos
+	}
+	start, end := d.lines[line-1], d.lines[line-1]+col-1
+	if end > len(d.text) {
+		end = len(d.text)
+	}
+	pos.Character = 0
+	for _, r := range d.text[start:end] {
+		pos.Character += unitsOf(r)
+	}
+	return pos
+}
+
+// span is the range from a line and a byte column to end, a range that would be empty covers a character instead
+func (d *document) span(line, col int, end token.Position) Range {
+	r := Range{Start: d.position(line, col), End: d.position(end.Line, end.Col)}
+	if r.End.Line < r.Start.Line || r.End.Line == r.Start.Line && r.End.Character <= r.Start.Character {
+		r.End = Position{Line: r.Start.Line, Character: r.Start.Character + 1}
+	}
+	return r
+}
+
+// tokenEnds maps the line and column each token of text starts at to where it ends, parse errors only tell where they start
+func tokenEnds(text string) map[[2]int]token.Position {
+	ends := map[[2]int]token.Position{}
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		ends[[2]int{tok.Pos.Line, tok.Pos.Col}] = tok.End
+	}
+	return ends
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	pos := ident.Token.Pos
+	return Range{Start: d.position(pos.Line, pos.Col), End: d.position(pos.Line, pos.Col+len(ident.Value))}
+}
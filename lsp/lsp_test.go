@@ -0,0 +1,360 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// client talks to a server running in the same process
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+	// notifications received while waiting for a response
+	notifications []*message
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := Serve(serverIn, serverOut)
+		_ = serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.in, msg); err != nil {
+		c.t.Fatalf("send %s: %s", msg.Method, err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	raw, _ := json.Marshal(params)
+	c.send(&message{Method: method, Params: raw})
+}
+
+// call sends a request and decodes the result of its response into result
+func (c *client) call(method string, params interface{}, result interface{}) *responseError {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	raw, _ := json.Marshal(params)
+	c.send(&message{ID: &id, Method: method, Params: raw})
+	for {
+		msg := c.receive()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("%s: got response to %s", method, *msg.ID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		// a null result is decoded as a nil Result
+		if result != nil && msg.Result != nil {
+			if err := json.Unmarshal(*msg.Result, result); err != nil {
+				c.t.Fatalf("%s: cannot decode %s: %s", method, *msg.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *client) receive() *message {
+	c.t.Helper()
+	msg, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("receive: %s", err)
+	}
+	return msg
+}
+
+// diagnostics returns the next diagnostics published for a document
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	msg := c.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %s", msg.Method)
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		c.t.Fatal(err)
+	}
+	return p
+}
+
+func (c *client) open(uri, text string) PublishDiagnosticsParams {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: text}})
+	return c.diagnostics()
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+const source = `let limit = 10
+let square = function(n) {
+    let result = n * n
+    return result
+}
+let names = ["stan", "kyle"]
+print(square(limit), len(names))
+names.
+`
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+		ServerInfo   struct{ Name string }  `json:"serverInfo"`
+	}
+	params := map[string]interface{}{"capabilities": map[string]interface{}{"general": map[string]interface{}{"positionEncodings": []string{"utf-16", "utf-8"}}}}
+	if err := c.call("initialize", params, &init); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if init.ServerInfo.Name != "stang" || init.Capabilities["hoverProvider"] != true || init.Capabilities["positionEncoding"] != "utf-8" {
+		t.Errorf("unexpected initialize result %+v", init)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	uri := "file:///test.stg"
+	if d := c.open(uri, source); len(d.Diagnostics) != 1 || !strings.Contains(d.Diagnostics[0].Message, "no prefix parse function") {
+		t.Errorf("expected the dangling dot to be reported, got %+v", d.Diagnostics)
+	}
+
+	hovers := []struct {
+		line, character int
+		contains        []string
+	}{
+		{0, 5, []string{"let limit = 10", "INTEGER 10"}},
+		{6, 16, []string{"let limit = 10"}},
+		{6, 8, []string{"let square = function(n)", "FUNCTION"}},
+		{3, 12, []string{"let result = n * n"}},
+		{2, 18, []string{"parameter n of function(n)"}},
+		{6, 23, []string{"len(x)", "returns the length"}},
+		{6, 1, []string{"print(values..., sep=\", \", end=\"\\n\")"}},
+		{5, 6, []string{"ARRAY [stan, kyle]"}},
+	}
+	for _, tt := range hovers {
+		var hover Hover
+		if err := c.call("textDocument/hover", at(uri, tt.line, tt.character), &hover); err != nil {
+			t.Fatalf("hover: %v", err)
+		}
+		for _, want := range tt.contains {
+			if !strings.Contains(hover.Contents.Value, want) {
+				t.Errorf("hover at %d:%d: %q does not contain %q", tt.line, tt.character, hover.Contents.Value, want)
+			}
+		}
+	}
+	var nothing *Hover
+	if err := c.call("textDocument/hover", at(uri, 4, 0), &nothing); err != nil || nothing != nil {
+		t.Errorf("hover outside an identifier should be null, got %+v %v", nothing, err)
+	}
+
+	definitions := []struct {
+		line, character int
+		want            Range
+	}{
+		{6, 8, Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 10}}},
+		{6, 17, Range{Start: Position{Line: 0, Character: 4}, End: Position{Line: 0, Character: 9}}},
+		{2, 17, Range{Start: Position{Line: 1, Character: 22}, End: Position{Line: 1, Character: 23}}},
+		{3, 13, Range{Start: Position{Line: 2, Character: 8}, End: Position{Line: 2, Character: 14}}},
+	}
+	for _, tt := range definitions {
+		var loc Location
+		if err := c.call("textDocument/definition", at(uri, tt.line, tt.character), &loc); err != nil {
+			t.Fatalf("definition: %v", err)
+		}
+		if loc.URI != uri || loc.Range != tt.want {
+			t.Errorf("definition at %d:%d: got %+v, want %+v", tt.line, tt.character, loc.Range, tt.want)
+		}
+	}
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+		t.Fatalf("documentSymbol: %v", err)
+	}
+	if len(symbols) != 3 || symbols[1].Name != "square" || symbols[1].Kind != SymbolFunction ||
+		len(symbols[1].Children) != 1 || symbols[1].Children[0].Name != "result" {
+		t.Errorf("unexpected symbols %+v", symbols)
+	}
+
+	completions := []struct {
+		line, character int
+		want, unwanted  []string
+	}{
+		{7, 6, []string{"pop", "push"}, []string{"limit", "split"}},
+		{6, 3, []string{"print", "printf"}, []string{"len"}},
+		{8, 0, []string{"limit", "square", "names", "len", "time", "function", "let"}, nil},
+	}
+	for _, tt := range completions {
+		var items []CompletionItem
+		if err := c.call("textDocument/completion", at(uri, tt.line, tt.character), &items); err != nil {
+			t.Fatalf("completion: %v", err)
+		}
+		labels := map[string]bool{}
+		for _, item := range items {
+			labels[item.Label] = true
+		}
+		for _, want := range tt.want {
+			if !labels[want] {
+				t.Errorf("completion at %d:%d should offer %s, got %v", tt.line, tt.character, want, items)
+			}
+		}
+		for _, unwanted := range tt.unwanted {
+			if labels[unwanted] {
+				t.Errorf("completion at %d:%d should not offer %s", tt.line, tt.character, unwanted)
+			}
+		}
+	}
+
+	var edits []TextEdit
+	if err := c.call("textDocument/formatting", DocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil || len(edits) != 0 {
+		t.Errorf("a document that does not parse should not be formatted, got %+v %v", edits, err)
+	}
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		ContentChanges: []struct {
+			Text string `json:"text"`
+		}{{Text: "let f = function(a) { let unused = 1; a }\nf(1,2)\n"}},
+	})
+	d := c.diagnostics()
+	if len(d.Diagnostics) != 2 || d.Diagnostics[0].Code != "unused" || d.Diagnostics[1].Code != "arity" || d.Diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("expected lint warnings, got %+v", d.Diagnostics)
+	}
+	if err := c.call("textDocument/formatting", DocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil {
+		t.Fatalf("formatting: %v", err)
+	}
+	want := "let f = function(a) {\n    let unused = 1\n    a\n}\nf(1, 2)\n"
+	if len(edits) != 1 || edits[0].NewText != want || edits[0].Range.End != (Position{Line: 2}) {
+		t.Errorf("unexpected edits %+v", edits)
+	}
+
+	if err := c.call("textDocument/rename", at(uri, 0, 0), nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+	if err := c.call("textDocument/hover", at("file:///missing.stg", 0, 0), nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("expected invalid params for an unknown document, got %v", err)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if d := c.diagnostics(); len(d.Diagnostics) != 0 {
+		t.Errorf("closing should clear the diagnostics, got %+v", d.Diagnostics)
+	}
+	c.send(&message{ID: (*json.RawMessage)(&[]byte{'9'}), Method: "shutdown"})
+	if msg := c.receive(); msg.Error != nil || msg.Result != nil {
+		t.Errorf("shutdown should answer null, got %+v", msg)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Serve returned %s", err)
+	}
+}
+
+func TestDiagnosticRanges(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Range
+	}{
+		{"print(1 22)", []Range{{Start: Position{0, 8}, End: Position{0, 10}}, {Start: Position{0, 10}, End: Position{0, 11}}}},
+		{"let x = 1 +", []Range{{Start: Position{0, 11}, End: Position{0, 12}}}},
+		{"let f = function() { let unused = 1\nreturn 2\nprint(f, 3) }", []Range{
+			{Start: Position{0, 25}, End: Position{0, 31}},
+			{Start: Position{2, 0}, End: Position{2, 11}},
+		}},
+	}
+	c := newClient(t)
+	for i, tt := range tests {
+		d := c.open("file:///ranges"+strconv.Itoa(i)+".stg", tt.text)
+		var got []Range
+		for _, diagnostic := range d.Diagnostics {
+			got = append(got, diagnostic.Range)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got ranges %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+	c.notify("exit", nil)
+	<-c.done
+}
+
+func TestOffsetOf(t *testing.T) {
+	tests := []struct {
+		text  string
+		pos   Position
+		utf16 bool
+		want  int
+	}{
+		{"ab\ncde\n", Position{0, 0}, false, 0},
+		{"ab\ncde\n", Position{0, 9}, false, 2},
+		{"ab\ncde\n", Position{1, 2}, false, 5},
+		{"ab\ncde\n", Position{2, 0}, false, 7},
+		{"ab\ncde\n", Position{5, 0}, false, 7},
+		{"ab\ncde\n", Position{1, 2}, true, 5},
+		{"é😀x\n", Position{0, 6}, false, 6},
+		{"é😀x\n", Position{0, 1}, true, 2},
+		{"é😀x\n", Position{0, 3}, true, 6},
+		{"é😀x\n", Position{0, 9}, true, 7},
+	}
+	for _, tt := range tests {
+		if got := offsetOf(tt.text, tt.pos, tt.utf16); got != tt.want {
+			t.Errorf("offsetOf(%q, %+v, %t): got %d, want %d", tt.text, tt.pos, tt.utf16, got, tt.want)
+		}
+	}
+}
+
+func TestPositionEncoding(t *testing.T) {
+	// the declaration and the use of n follow a character of two bytes and one of four bytes,
+	// which are one and two utf-16 code units
+	text := `let s = "é😀"; let n = s; print(n)` + "\n"
+	tests := []struct {
+		encodings []string
+		want      string
+		use       int
+		decl      Range
+	}{
+		{nil, "utf-16", 32, Range{Start: Position{0, 19}, End: Position{0, 20}}},
+		{[]string{"utf-16"}, "utf-16", 32, Range{Start: Position{0, 19}, End: Position{0, 20}}},
+		{[]string{"utf-8", "utf-16"}, "utf-8", 35, Range{Start: Position{0, 22}, End: Position{0, 23}}},
+	}
+	for _, tt := range tests {
+		c := newClient(t)
+		var init struct {
+			Capabilities map[string]interface{} `json:"capabilities"`
+		}
+		params := map[string]interface{}{"capabilities": map[string]interface{}{"general": map[string]interface{}{"positionEncodings": tt.encodings}}}
+		if err := c.call("initialize", params, &init); err != nil {
+			t.Fatalf("initialize: %v", err)
+		}
+		if init.Capabilities["positionEncoding"] != tt.want {
+			t.Errorf("%v: got encoding %v, want %s", tt.encodings, init.Capabilities["positionEncoding"], tt.want)
+		}
+		uri := "file:///encoding.stg"
+		c.open(uri, text)
+		var loc Location
+		if err := c.call("textDocument/definition", at(uri, 0, tt.use), &loc); err != nil {
+			t.Fatalf("definition: %v", err)
+		}
+		if loc.Range != tt.decl {
+			t.Errorf("%v: got definition %+v, want %+v", tt.encodings, loc.Range, tt.decl)
+		}
+		c.notify("exit", nil)
+		<-c.done
+	}
+}
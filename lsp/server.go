@@ -0,0 +1,417 @@
+// Package lsp implements a language server for stang speaking the Language Server Protocol,
+// it is started by stang lsp and talks to the editor over stdin and stdout.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/format"
+	"github.com/yzbmz5913/stang/lint"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Server keeps the documents open in the editor, it handles one message at a time
+type Server struct {
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+	utf16    bool // whether positions count utf-16 code units, unless the client accepts utf-8
+}
+
+// Serve answers the messages read from r on w until the client sends exit or closes r
+func Serve(r io.Reader, w io.Writer) error {
+	s := &Server{out: w, docs: map[string]*document{}, utf16: true}
+	in := bufio.NewReader(r)
+	for {
+		msg, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, *responseError)
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/formatting":     (*Server).formatting,
+}
+
+type notificationHandler func(s *Server, params json.RawMessage) error
+
+var notificationHandlers = map[string]notificationHandler{
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+func (s *Server) handle(msg *message) error {
+	if msg.ID == nil {
+		// notifications the server does not know, like initialized, are ignored
+		if h, ok := notificationHandlers[msg.Method]; ok {
+			return h(s, msg.Params)
+		}
+		return nil
+	}
+	reply := &message{ID: msg.ID}
+	switch h, ok := handlers[msg.Method]; {
+	case msg.Error != nil:
+		reply.Error = msg.Error
+	case s.shutdown:
+		reply.Error = &responseError{Code: codeInvalidRequest, Message: "the server is shut down"}
+	case !ok:
+		reply.Error = &responseError{Code: codeMethodNotFound, Message: "unsupported method " + msg.Method}
+	default:
+		result, err := h(s, msg.Params)
+		if err != nil {
+			reply.Error = err
+			break
+		}
+		raw, merr := json.Marshal(result)
+		if merr != nil {
+			return merr
+		}
+		reply.Result = (*json.RawMessage)(&raw)
+	}
+	return writeMessage(s.out, reply)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: raw})
+}
+
+func decode(params json.RawMessage, v interface{}) *responseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, *responseError) {
+	var p InitializeParams
+	if len(params) > 0 {
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	// utf-16 is the encoding every client supports, utf-8 saves converting columns
+	encoding := "utf-16"
+	for _, e := range p.Capabilities.General.PositionEncodings {
+		if e == "utf-8" {
+			encoding = "utf-8"
+		}
+	}
+	s.utf16 = encoding == "utf-16"
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"positionEncoding":           encoding,
+			"textDocumentSync":           1, // the whole document is sent on every change
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"documentSymbolProvider":     true,
+			"completionProvider":         map[string]interface{}{"triggerCharacters": []string{"."}},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "stang"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, *responseError) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) error {
+	var p DidOpenTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil
+	}
+	return s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) error {
+	var p DidChangeTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil || len(p.ContentChanges) == 0 {
+		return nil
+	}
+	return s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) error {
+	var p DidCloseTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update analyzes the new text of a document and publishes its problems
+func (s *Server) update(uri, text string) error {
+	doc := analyze(text, s.utf16)
+	s.docs[uri] = doc
+	diagnostics := []Diagnostic{}
+	var ends map[[2]int]token.Position
+	if len(doc.errors) > 0 {
+		ends = tokenEnds(text)
+	}
+	for _, msg := range doc.errors {
+		r := Range{End: Position{Character: 1}}
+		line, col, rest := parser.SplitError(msg)
+		if line > 0 {
+			end, ok := ends[[2]int{line, col}]
+			if !ok {
+				end = token.Position{Line: line, Col: col}
+			}
+			r = doc.span(line, col, end)
+			msg = rest
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    r,
+			Severity: SeverityError,
+			Source:   "stang",
+			Message:  msg,
+		})
+	}
+	if len(doc.errors) == 0 {
+		for _, d := range lint.Check(doc.program, doc.comments) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    doc.span(d.Pos.Line, d.Pos.Col, d.End),
+				Severity: SeverityWarning,
+				Code:     d.Rule,
+				Source:   "stang lint",
+				Message:  d.Message,
+			})
+		}
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// document returns the document and the offset a position request is about
+func (s *Server) document(params json.RawMessage) (*document, string, int, *responseError) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, "", 0, err
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, "", 0, &responseError{Code: codeInvalidParams, Message: "unknown document " + p.TextDocument.URI}
+	}
+	return doc, p.TextDocument.URI, offsetOf(doc.text, p.Position, doc.utf16), nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, *responseError) {
+	doc, _, offset, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	ref := doc.referenceAt(offset)
+	if ref == nil {
+		return nil, nil
+	}
+	var text string
+	switch d := ref.decl; {
+	case d != nil:
+		text = "```stang\n" + describe(d) + "\n```"
+		if d.value != nil {
+			if typ := doc.typeOf(d.value, 0); typ != "" {
+				text += "\n\n" + string(typ)
+				if constant(d.value) {
+					text += " " + valueOf(d.value).String(0)
+				}
+			}
+		}
+	default:
+		switch b := evaluator.LookupBuiltin(ref.ident.Value).(type) {
+		case *evaluator.Builtin:
+			signature, description := b.Doc, ""
+			if i := strings.Index(b.Doc, ") "); i >= 0 {
+				signature, description = b.Doc[:i+1], b.Doc[i+2:]
+			}
+			text = "```stang\n" + signature + "\n```\n\n" + description
+		case *evaluator.Module:
+			text = "```stang\nmodule " + b.Name + "\n```\n\nfunctions: " + strings.Join(evaluator.Methods(b), ", ")
+		default:
+			return nil, nil
+		}
+	}
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: doc.identRange(ref.ident)}, nil
+}
+
+// describe shows how d was declared
+func describe(d *declaration) string {
+	switch d.kind {
+	case "let", "const":
+		if d.value == nil {
+			// bound by a pattern
+			break
+		}
+		if fn, ok := d.value.(*ast.FunctionLiteral); ok {
+			return d.kind + " " + d.name.Value + " = " + signature(fn)
+		}
+		value := format.Node(d.value)
+		if i := strings.IndexByte(value, '\n'); i >= 0 {
+			value = value[:i] + " ..."
+		}
+		return d.kind + " " + d.name.Value + " = " + value
+	case "parameter":
+		return "parameter " + d.name.Value + " of " + signature(d.owner)
+	}
+	return d.kind + " " + d.name.Value
+}
+
+func signature(fn *ast.FunctionLiteral) string {
+	var params []string
+	for _, param := range fn.Parameters {
+		params = append(params, format.Node(param))
+	}
+	return "function(" + strings.Join(params, ", ") + ")"
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, *responseError) {
+	doc, uri, offset, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	ref := doc.referenceAt(offset)
+	if ref == nil || ref.decl == nil {
+		return nil, nil
+	}
+	return Location{URI: uri, Range: doc.identRange(ref.decl.name)}, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, *responseError) {
+	var p DocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "unknown document " + p.TextDocument.URI}
+	}
+	if doc.symbols == nil {
+		return []DocumentSymbol{}, nil
+	}
+	return doc.symbols, nil
+}
+
+// completion offers the methods of the receiver after a dot, otherwise the variables of the document, builtins and keywords
+func (s *Server) completion(params json.RawMessage) (interface{}, *responseError) {
+	doc, _, offset, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	start := offset
+	for start > 0 && isIdentChar(doc.text[start-1]) {
+		start--
+	}
+	prefix := doc.text[start:offset]
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	add := func(label string, kind int, detail string) {
+		if strings.HasPrefix(label, prefix) && !seen[label] {
+			seen[label] = true
+			items = append(items, CompletionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+	if start > 0 && doc.text[start-1] == '.' {
+		for _, name := range doc.receiverMethods(start - 1) {
+			add(name, CompletionMethod, "")
+		}
+		return items, nil
+	}
+	for _, d := range doc.decls {
+		add(d.name.Value, CompletionVariable, d.kind)
+	}
+	for _, name := range evaluator.Builtins() {
+		switch b := evaluator.LookupBuiltin(name).(type) {
+		case *evaluator.Module:
+			add(name, CompletionModule, "module")
+		case *evaluator.Builtin:
+			add(name, CompletionFunction, b.Doc)
+		}
+	}
+	for _, keyword := range token.Keywords() {
+		add(keyword, CompletionKeyword, "")
+	}
+	return items, nil
+}
+
+// receiverMethods returns the methods of what is before the dot at offset dot,
+// the methods of every type when that is not known
+func (d *document) receiverMethods(dot int) []string {
+	end := dot
+	if end > 0 && strings.IndexByte("'\"`", d.text[end-1]) >= 0 {
+		return evaluator.MethodsOf(evaluator.StringObj)
+	}
+	start := end
+	for start > 0 && isIdentChar(d.text[start-1]) {
+		start--
+	}
+	name := d.text[start:end]
+	if obj := evaluator.LookupBuiltin(name); obj != nil {
+		return evaluator.Methods(obj)
+	}
+	var typ evaluator.ObjectType
+	for _, decl := range d.decls {
+		if decl.name.Value == name && decl.name.Token.Pos.Offset < dot && decl.value != nil {
+			typ = d.typeOf(decl.value, 0)
+		}
+	}
+	if typ != "" {
+		return evaluator.MethodsOf(typ)
+	}
+	var names []string
+	for _, t := range []evaluator.ObjectType{evaluator.StringObj, evaluator.ArrayObj, evaluator.HashObj, evaluator.TimeObj,
+		evaluator.DurationObj, evaluator.IteratorObj, evaluator.TaskObj, evaluator.ChannelObj} {
+		names = append(names, evaluator.MethodsOf(t)...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+func (s *Server) formatting(params json.RawMessage) (interface{}, *responseError) {
+	var p DocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "unknown document " + p.TextDocument.URI}
+	}
+	formatted, err := format.Source(doc.text)
+	if err != nil || formatted == doc.text {
+		return []TextEdit{}, nil
+	}
+	// the edit replaces the whole document, up to the end of its last line
+	end := doc.position(strings.Count(doc.text, "\n")+1, len(doc.text)-strings.LastIndexByte(doc.text, '\n'))
+	return []TextEdit{{Range: Range{End: end}, NewText: formatted}}, nil
+}
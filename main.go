@@ -4,23 +4,26 @@
 package stang
 
 import (
-	"bufio"
 	"context"
 	"errors"
-	"fmt"
 	"github.com/yzbmz5913/stang/evaluator"
 	"github.com/yzbmz5913/stang/lexer"
 	"github.com/yzbmz5913/stang/parser"
-	"io"
 	"io/ioutil"
 	"os"
-	"strings"
 	"time"
 )
 
-const prompt = ">> "
-
+// RunProgram runs sourcecode with the output, clock and file system of evaluator.DefaultRuntime,
+// every run gets a random source of its own so that random.seed in one program does not affect another
 func RunProgram(sourcecode string) (string, error) {
+	d := evaluator.DefaultRuntime
+	return RunProgramWithRuntime(sourcecode, &evaluator.Runtime{Stdout: d.Stdout, Now: d.Now, Location: d.Location, FS: d.FS})
+}
+
+// RunProgramWithRuntime runs sourcecode against the host facilities in rt, e.g. its output, clock and random source.
+// Use evaluator.NewDeterministicRuntime to replay a script byte-for-byte.
+func RunProgramWithRuntime(sourcecode string, rt *evaluator.Runtime) (string, error) {
 	l := lexer.New(sourcecode)
 	p := parser.New(l)
 	program := p.ParseProgram()
@@ -28,7 +31,7 @@ func RunProgram(sourcecode string) (string, error) {
 		return "", errors.New(p.Errors()[0])
 	}
 	scope := evaluator.NewScope(nil)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(evaluator.WithRuntime(context.Background(), rt), 3*time.Second)
 	defer cancel()
 	e := evaluator.Eval(ctx, program, scope)
 	return e.String(0), nil
@@ -45,42 +48,3 @@ func RunFile(filename string) (string, error) {
 	}
 	return RunProgram(string(f))
 }
-
-func StartCommandLine(in io.Reader, out io.Writer) {
-	fmt.Println("Welcome to use Stan's programming language(Stang)!")
-	fmt.Println("type in command line or pass in filenames as parameters to parse source code")
-	fmt.Println()
-
-	scanner := bufio.NewScanner(in)
-	scope := evaluator.NewScope(nil)
-	for {
-		fmt.Printf(prompt)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-		line := scanner.Text()
-		if strings.ToLower(line) == "exit" {
-			_, _ = io.WriteString(out, "bye")
-			return
-		}
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
-		}
-		result := evaluator.Eval(context.Background(), program, scope)
-		if result != nil {
-			_, _ = io.WriteString(out, result.String(0))
-			_, _ = io.WriteString(out, "\n")
-		}
-	}
-}
-
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		_, _ = io.WriteString(out, "Error: "+msg+"\n")
-	}
-}
@@ -0,0 +1,215 @@
+// Package optimize rewrites stang programs into ones that do less work when evaluated but behave the same, it is
+// used by stang run --optimize.
+//
+// Operators whose operands are all constants are folded into the constant they evaluate to, by the evaluator itself
+// so that its coercion rules, like "a" + 1, hold. Operations that fail, like 1 / 0, are kept to fail at runtime.
+// An if whose condition is a constant is replaced by the branch it takes, and statements that can never run, after
+// a return, break or continue, are removed.
+package optimize
+
+import (
+	"context"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Program optimizes program in place and returns it
+func Program(program *ast.Program) *ast.Program {
+	ast.Rewrite(program, optimize)
+	return program
+}
+
+func optimize(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.InfixExpression:
+		if isConstant(n.Left) && isConstant(n.Right) {
+			return fold(n)
+		}
+	case *ast.PrefixExpression:
+		if isConstant(n.Right) {
+			return fold(n)
+		}
+	case *ast.IfExpression:
+		return prune(n)
+	case *ast.BlockStatement:
+		n.Statements = statements(n.Statements, false)
+	case *ast.Program:
+		n.Statements = statements(n.Statements, true)
+	}
+	return node
+}
+
+// isConstant reports whether e is a literal of a value that cannot change
+func isConstant(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral, *ast.StringLiteral, *ast.NullExpression:
+		return true
+	}
+	return false
+}
+
+// value evaluates e, whose operands are constants
+func value(e ast.Expression) evaluator.Object {
+	return evaluator.Eval(context.Background(), e, evaluator.NewScope(nil))
+}
+
+// fold returns the literal of what e evaluates to, e itself if that is an error or has no literal
+func fold(e ast.Expression) ast.Expression {
+	tok := token.Token{Pos: e.Pos(), End: e.End()}
+	switch v := value(e).(type) {
+	case *evaluator.Integer:
+		tok.Type, tok.Literal = token.INT, strconv.FormatInt(v.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: v.Value}
+	case *evaluator.Float:
+		if math.IsInf(v.Value, 0) || math.IsNaN(v.Value) {
+			return e
+		}
+		tok.Type, tok.Literal = token.FLOAT, strconv.FormatFloat(v.Value, 'f', -1, 64)
+		if !strings.Contains(tok.Literal, ".") {
+			tok.Literal += ".0" // a float still reads as one
+		}
+		return &ast.FloatLiteral{Token: tok, Value: v.Value}
+	case *evaluator.Boolean:
+		tok.Type, tok.Literal = token.FALSE, "false"
+		if v.Value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		}
+		return &ast.BooleanLiteral{Token: tok, Value: v.Value}
+	case *evaluator.String:
+		tok.Type, tok.Literal = token.STRING, v.Value
+		return &ast.StringLiteral{Token: tok, Value: v.Value}
+	case *evaluator.Null:
+		tok.Type, tok.Literal = token.NULL, "null"
+		return &ast.NullExpression{Token: tok}
+	}
+	return e
+}
+
+// taken returns the block an if with a constant condition evaluates and true, nil for none, or false if the
+// condition is not a constant
+func taken(i *ast.IfExpression) (*ast.BlockStatement, bool) {
+	if !isConstant(i.Condition) {
+		return nil, false
+	}
+	if evaluator.Truthy(value(i.Condition)) {
+		return i.Consequence, true
+	}
+	return i.Alternative, true
+}
+
+// prune drops the branch an if with a constant condition never takes, an if that takes none evaluates to null
+func prune(i *ast.IfExpression) ast.Expression {
+	block, ok := taken(i)
+	switch {
+	case !ok:
+		return i
+	case block == nil:
+		return &ast.NullExpression{Token: token.Token{Type: token.NULL, Literal: "null", Pos: i.Pos(), End: i.End()}}
+	case block == i.Consequence:
+		i.Alternative = nil
+	default:
+		i.Consequence = &ast.BlockStatement{Token: i.Consequence.Token, Statements: []ast.Statement{}, Rbrace: i.Consequence.Rbrace}
+	}
+	return i
+}
+
+// statements returns list with the ifs with constant conditions replaced by the statements of the branch they take
+// and without the statements that never run or do nothing. The ifs are only replaced where that leaves the value
+// of the list alone: the value of the last statement is the value of the list, and a program goes on after a break
+// or a continue, which a block does not.
+func statements(list []ast.Statement, program bool) []ast.Statement {
+	last := len(list) - 1
+	for last >= 0 && isEmpty(list[last]) {
+		last--
+	}
+	kept := make([]ast.Statement, 0, len(list))
+	for i, stmt := range list {
+		if isEmpty(stmt) || i != last && isConstantStatement(stmt) {
+			continue
+		}
+		if branch, ok := constantIf(stmt); ok && spliceable(branch, i == last, program) {
+			for _, s := range branch {
+				if kept = append(kept, s); ends(s, program) {
+					return kept
+				}
+			}
+			continue
+		}
+		if kept = append(kept, stmt); ends(stmt, program) {
+			return kept
+		}
+	}
+	return kept
+}
+
+// constantIf returns the statements of the branch taken by stmt if it is an if with a constant condition
+func constantIf(stmt ast.Statement) ([]ast.Statement, bool) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	i, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	block, ok := taken(i)
+	if !ok {
+		return nil, false
+	}
+	var list []ast.Statement
+	for _, s := range block.Statements {
+		if !isEmpty(s) {
+			list = append(list, s)
+		}
+	}
+	return list, true
+}
+
+// spliceable reports whether the statements of a branch can stand for the if taking it
+func spliceable(branch []ast.Statement, last, program bool) bool {
+	if last && len(branch) == 0 {
+		// an if that ends a list gives the list a value, which the statement before it would replace
+		return false
+	}
+	if program {
+		for _, s := range branch {
+			if es, ok := s.(*ast.ExpressionStatement); ok {
+				switch es.Expression.(type) {
+				case *ast.BreakExpression, *ast.ContinueExpression:
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// ends reports whether the statements after stmt never run
+func ends(stmt ast.Statement, program bool) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.ExpressionStatement:
+		switch s.Expression.(type) {
+		case *ast.BreakExpression, *ast.ContinueExpression:
+			return !program
+		}
+	}
+	return false
+}
+
+// isConstantStatement reports whether stmt is a constant, which does nothing unless it gives a list its value
+func isConstantStatement(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	return ok && isConstant(es.Expression)
+}
+
+// isEmpty reports whether stmt is a lone semicolon, which the evaluator skips
+func isEmpty(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	return ok && es.Expression == nil
+}
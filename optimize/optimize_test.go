@@ -0,0 +1,100 @@
+package optimize
+
+import (
+	"bytes"
+	"context"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"testing"
+)
+
+func parse(t *testing.T, src string) *ast.Program {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q does not parse: %v", src, p.Errors())
+	}
+	return program
+}
+
+// run evaluates program and returns what it printed and its value
+func run(program *ast.Program) (string, string) {
+	var out bytes.Buffer
+	ctx := evaluator.WithScheduler(evaluator.WithRuntime(context.Background(), &evaluator.Runtime{Stdout: &out}))
+	result := evaluator.Eval(ctx, program, evaluator.NewScope(nil))
+	if result == nil {
+		return out.String(), "<nil>"
+	}
+	return out.String(), result.String(0)
+}
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"'a' + 1", "a1"},
+		{"-(2.5 * 2)", "-5.0"},
+		{"!null", "true"},
+		{"x + 1 * 2", "(x + 2)"},
+		{"1 / 0", "(1 / 0)"},
+		{"let f = function() { return 1; print(2) }", "let f = function()return 1; "},
+		{"if (1 > 2) { print(1) } else { print(2) }; print(3)", "print(2); print(3)"},
+		{"if (false) { print(1) }; 5", "5"},
+		{"1; 2; 3", "3"},
+		{"let x = if (true) { 1 } else { 2 }", "let x = iftrue 1; "},
+		{"let x = if (false) { 1 }", "let x = null"},
+		{"while (x) { if (true) { break }; print(1) }", "while ( x ) { break;  }"},
+		{"let g = function() { if (0) { 1 } }", "let g = function()null; "},
+		{"let g = function() { 2; if (true) { } }", "let g = function()iftrue ; "},
+		{"if (true) { break; print(1) }", "iftrue break; "},
+	}
+	for _, tt := range tests {
+		if got := Program(parse(t, tt.input)).String(); got != tt.expected {
+			t.Errorf("%q: got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSameBehaviour(t *testing.T) {
+	tests := []string{
+		"print(1 + 2 * 3, 'a' + 1, 1 + 'a', 2.5 * 2, -(3 - 5), !0, 7 / 2, 7.0 / 2, 'ab' == 'ab', null == false)",
+		"print(1 < 2 && 'x', 0 || '', 10 % 3, 1 == 1.0, 'b' > 'a')",
+		"print(1 / 0)",
+		"print('a' - 1)",
+		"let f = function(n) { if (true) { n + 1 } else { n - 1 } }; print(f(1))",
+		"let f = function() { 2; if (false) { 1 } }; print(f())",
+		"let f = function() { return 1; print('never') }; print(f())",
+		"for (let i = 0; i < 3; i++) { if (true) { continue; print('never') }; print('never') }; print('done')",
+		"for (let i = 0; i < 3; i++) { if (1 > 0) { print(i); break }; print('never') }",
+		"if (true) { break; print('after') }; print('on')",
+		"if (true) { print(1) }",
+		"if ('') { print(1) } else { if (null) { print(2) } else { print(3) } }",
+		"let x = if (2 * 2 == 4) { 'four' } else { 'five' }; print(x)",
+		"let y = if (false) { 1 }; print(y)",
+		"let g = function() { yield 1 + 1; if (false) { yield 3 }; yield 4 - 1 }; for (let v of g()) { print(v) }",
+		"1; 2; 3",
+		"return 2 * 21; print('never')",
+	}
+	for _, input := range tests {
+		wantOut, wantResult := run(parse(t, input))
+		gotOut, gotResult := run(Program(parse(t, input)))
+		if gotOut != wantOut || gotResult != wantResult {
+			t.Errorf("%q: optimized, it printed %q and gave %s, want %q and %s", input, gotOut, gotResult, wantOut, wantResult)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	program := Program(parse(t, "let x = 1 +\n  2 * 3"))
+	folded := program.Statements[0].(*ast.LetStatement).Value
+	if lit, ok := folded.(*ast.IntegerLiteral); !ok || lit.Value != 7 {
+		t.Fatalf("wrong fold %s", folded)
+	}
+	if pos, end := folded.Pos(), folded.End(); pos.String() != "1:9" || end.String() != "2:8" {
+		t.Errorf("a folded constant should span what it replaces. got=%s-%s", pos, end)
+	}
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/token"
+)
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expr := &ast.SpawnExpression{Token: p.curToken}
+	p.nextToken()
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		msg := fmt.Sprintf("[%s]spawn expects a function call", lineCol(expr.Token.Pos))
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	expr.Call = call
+	return expr
+}
+
+func (p *Parser) parseSelectExpression() ast.Expression {
+	expr := &ast.SelectExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken()
+	hasDefault := false
+	for !p.curTokenIs(token.RBRACE) {
+		var c *ast.SelectCase
+		switch p.curToken.Type {
+		case token.CASE:
+			c = p.parseSelectCase()
+		case token.DEFAULT:
+			if hasDefault {
+				p.errors = append(p.errors, fmt.Sprintf("[%s]multiple defaults in select", lineCol(p.curToken.Pos)))
+				return nil
+			}
+			hasDefault = true
+			c = &ast.SelectCase{Token: p.curToken}
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("[%s]expected case or default in select, got %s instead", lineCol(p.curToken.Pos), p.curToken.Type))
+			return nil
+		}
+		if c == nil || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		c.Body = p.parseBlockStatement()
+		expr.Cases = append(expr.Cases, c)
+		p.nextToken()
+	}
+	expr.Rbrace = p.curToken.Pos
+	return expr
+}
+
+// parseSelectCase parses the communication of a case, curToken is the CASE token
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	c := &ast.SelectCase{Token: p.curToken}
+	p.nextToken()
+	if p.curTokenIs(token.LET) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		c.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+	}
+	pos := p.curToken.Pos
+	mc, ok := p.parseExpression(LOWEST).(*ast.MethodCallExpression)
+	var call *ast.CallExpression
+	if ok {
+		call, ok = mc.Call.(*ast.CallExpression)
+	}
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("[%s]select case must be a channel send or recv", lineCol(pos)))
+		return nil
+	}
+	c.Channel = mc.Object
+	switch method := call.Function.String(); {
+	case method == "recv" && len(call.Arguments) == 0:
+	case method == "send" && len(call.Arguments) == 1 && c.Name == nil:
+		c.Send = call.Arguments[0]
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("[%s]select case must be a channel send or recv", lineCol(pos)))
+		return nil
+	}
+	return c
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/lexer"
 	"github.com/yzbmz5913/stang/token"
 	"strconv"
 )
@@ -48,9 +49,47 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	tl := &ast.TemplateLiteral{Token: p.curToken}
+	parts, sources, err := lexer.SplitTemplateToken(p.curToken)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("[%s]%s", lineCol(p.curToken.Pos), err))
+		return nil
+	}
+	tl.Parts = parts
+	for _, src := range sources {
+		sub := New(src)
+		expr := sub.parseExpression(LOWEST)
+		if expr != nil && !sub.peekTokenIs(token.EOF) {
+			sub.errors = append(sub.errors, fmt.Sprintf("unexpected %s after interpolated expression", sub.peekToken.Type))
+		}
+		if expr == nil && len(sub.errors) == 0 {
+			sub.errors = append(sub.errors, "empty interpolation")
+		}
+		for _, msg := range sub.errors {
+			p.errors = append(p.errors, fmt.Sprintf("[%s]in template literal: %s", lineCol(p.curToken.Pos), msg))
+		}
+		tl.Expressions = append(tl.Expressions, expr)
+	}
+	return tl
+}
+
+func (p *Parser) parseTaggedTemplateExpression(tag ast.Expression) ast.Expression {
+	expr := &ast.TaggedTemplateExpression{Token: p.curToken, Tag: tag}
+	tl, ok := p.parseTemplateLiteral().(*ast.TemplateLiteral)
+	if !ok {
+		return nil
+	}
+	expr.Template = tl
+	return expr
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	expr := &ast.ArrayLiteral{Token: p.curToken}
 	expr.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		expr.Rbracket = p.curToken.Pos
+	}
 	return expr
 }
 
@@ -63,9 +102,28 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	p.functions = append(p.functions, fl)
 	fl.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
 	return fl
 }
+
+// parseYieldExpression turns the enclosing function into a generator
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expr := &ast.YieldExpression{Token: p.curToken}
+	if len(p.functions) == 0 {
+		msg := fmt.Sprintf("[%s]yield outside of a function", lineCol(p.curToken.Pos))
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	p.functions[len(p.functions)-1].IsGenerator = true
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.RPAREN) || p.peekTokenIs(token.EOF) {
+		return expr
+	}
+	p.nextToken()
+	expr.Value = p.parseExpression(LOWEST)
+	return expr
+}
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := make([]ast.Expression, 0)
 	if p.peekTokenIs(end) {
@@ -73,34 +131,60 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return list
 	}
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseElement())
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseElement())
 	}
 	if !p.expectPeek(end) {
 		return nil
 	}
 	return list
 }
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	var idents []*ast.Identifier
+
+// parseElement parses an element of an array literal or an argument, which may be spread like ...xs
+func (p *Parser) parseElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	return p.parseSpread(LOWEST)
+}
+
+// parseSpread parses ...value, curToken is the ...
+func (p *Parser) parseSpread(precedence int) ast.Expression {
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	if spread.Value = p.parseExpression(precedence); spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+func (p *Parser) parseFunctionParameters() []ast.Expression {
+	var params []ast.Expression
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return idents
+		return params
 	}
 	p.nextToken()
-	idents = append(idents, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	params = append(params, p.parseParameter())
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		idents = append(idents, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		params = append(params, p.parseParameter())
 	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	return idents
+	return params
+}
+
+// parseParameter parses a parameter name or a pattern destructuring the argument
+func (p *Parser) parseParameter() ast.Expression {
+	if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE) {
+		return p.parsePattern()
+	}
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -204,9 +288,20 @@ func (p *Parser) parseForExpression() ast.Expression {
 	var update ast.Expression
 
 	p.nextToken()
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "of" {
+		return p.parseForOfExpression(curToken)
+	}
 	if !p.curTokenIs(token.SEMICOLON) {
 		if p.curTokenIs(token.LET) {
-			init = p.parseLetStatement()
+			stmt := &ast.LetStatement{Token: p.curToken}
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "of" {
+				return p.parseForOfExpression(curToken)
+			}
+			stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			init = p.parseLetValue(stmt)
 		} else {
 			init = p.parseExpression(LOWEST)
 		}
@@ -235,6 +330,23 @@ func (p *Parser) parseForExpression() ast.Expression {
 	return result
 }
 
+// parseForOfExpression parses for (let name of iterable) { body }, curToken is the name
+func (p *Parser) parseForOfExpression(forToken token.Token) ast.Expression {
+	loop := &ast.ForOfExpression{Token: forToken}
+	loop.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken() // of
+	p.nextToken()
+	loop.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	loop.Body = p.parseBlockStatement()
+	return loop
+}
+
 func (p *Parser) parseTypeofExpression() ast.Expression {
 	te := &ast.TypeofExpression{Token: p.curToken}
 	p.nextToken()
@@ -245,6 +357,9 @@ func (p *Parser) parseTypeofExpression() ast.Expression {
 func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 	expr := &ast.CallExpression{Token: p.curToken, Function: left}
 	expr.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		expr.Rparen = p.curToken.Pos
+	}
 	return expr
 }
 
@@ -263,6 +378,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	expr.Rbracket = p.curToken.Pos
 	return expr
 }
 
@@ -273,6 +389,10 @@ func (p *Parser) parseAssignExpression(name ast.Expression) ast.Expression {
 		e.Name = n
 	} else if indexExp, ok := name.(*ast.IndexExpression); ok {
 		e.Name = indexExp
+	} else if _, ok := name.(*ast.ArrayLiteral); ok && e.Token.Type == token.ASSIGN {
+		e.Name = p.toPattern(name)
+	} else if _, ok := name.(*ast.HashLiteral); ok && e.Token.Type == token.ASSIGN {
+		e.Name = p.toPattern(name)
 	} else {
 		msg := fmt.Sprintf("expected assign token to be an identifier, got %s instead", name.TokenLiteral())
 		p.errors = append(p.errors, msg)
@@ -46,6 +46,7 @@ var precedences = map[token.TokenType]int{
 	token.LPAREN:     CALL,
 	token.DOT:        CALL,
 	token.LBRACKET:   INDEX,
+	token.TEMPLATE:   CALL,
 	token.INCR:       INCRDECR,
 	token.DECR:       INCRDECR,
 }
@@ -56,6 +57,7 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 	errors    []string
+	functions []*ast.FunctionLiteral // function literals being parsed, innermost last
 
 	// parsing functions for each  type
 	prefixParseFns map[token.TokenType]prefixParseFn
@@ -76,6 +78,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
@@ -91,6 +94,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.TYPEOF, p.parseTypeofExpression)
 	p.registerPrefix(token.NULL, p.parseNullExpression)
 	p.registerPrefix(token.LBRACE, p.parseHashExpression)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.SELECT, p.parseSelectExpression)
 
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
@@ -109,6 +115,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.DOT, p.parseMethodCallExpression)
 	p.registerInfix(token.COLON, p.parseSliceExpression)
+	p.registerInfix(token.TEMPLATE, p.parseTaggedTemplateExpression)
 
 	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.PLUS_A, p.parseAssignExpression)
@@ -145,7 +152,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.DELETE:
 		return p.parseDeleteStatement()
@@ -159,10 +166,19 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if p.expectPeek(token.IDENT) {
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		if pattern := p.parsePattern(); pattern != nil {
+			stmt.Name = pattern
+		}
+	} else if p.expectPeek(token.IDENT) {
 		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
+	return p.parseLetValue(stmt)
+}
 
+// parseLetValue parses the '= value' part of a let statement, curToken ends the name
+func (p *Parser) parseLetValue(stmt *ast.LetStatement) *ast.LetStatement {
 	if p.expectPeek(token.ASSIGN) {
 		p.nextToken()
 		stmt.Value = p.parseExpressionStatement().Expression
@@ -209,6 +225,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken.Pos
+	}
 	return block
 }
 
@@ -231,6 +250,10 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		if infix == nil {
 			return leftExpr
 		}
+		// a [ starting a line starts a statement like [a, b] = [b, a] instead of indexing the line before
+		if p.peekTokenIs(token.LBRACKET) && p.peekToken.Pos.Line > p.curToken.End.Line {
+			return leftExpr
+		}
 		p.nextToken()
 		leftExpr = infix(leftExpr)
 	}
@@ -254,10 +277,10 @@ func (p *Parser) parseSliceExpression(left ast.Expression) ast.Expression {
 	expr := &ast.SliceExpression{Token: p.curToken}
 	expr.Start = left
 	if p.peekTokenIs(token.RBRACKET) { // [:end]
-		expr.End = nil
+		expr.Stop = nil
 	} else {
 		p.nextToken()
-		expr.End = p.parseExpression(LOWEST)
+		expr.Stop = p.parseExpression(LOWEST)
 	}
 	return expr
 }
@@ -267,17 +290,31 @@ func (p *Parser) parseHashExpression() ast.Expression {
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 	if p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
+		hash.Rbrace = p.curToken.Pos
 		return hash
 	}
 	for !p.curTokenIs(token.RBRACE) {
 		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			// {...defaults, k: v}, a spread is a key without a value
+			key := p.parseSpread(LOWEST)
+			if key == nil {
+				return nil
+			}
+			hash.Pairs[key] = nil
+			hash.Keys = append(hash.Keys, key)
+			p.nextToken()
+			continue
+		}
 		key := p.parseExpression(SLICE)
 		if !p.expectPeek(token.COLON) {
 			return nil
 		}
 		p.nextToken()
 		hash.Pairs[key] = p.parseExpression(LOWEST)
+		hash.Keys = append(hash.Keys, key)
 		p.nextToken()
 	}
+	hash.Rbrace = p.curToken.Pos
 	return hash
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/yzbmz5913/stang/ast"
 	"github.com/yzbmz5913/stang/lexer"
+	"strings"
 	"testing"
 )
 
@@ -459,6 +460,165 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestTemplateLiteralParsing(t *testing.T) {
+	input := "tag`a${x}b${1 + 2}`"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	tagged, ok := stmt.Expression.(*ast.TaggedTemplateExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TaggedTemplateExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, tagged.Tag, "tag") {
+		return
+	}
+	tl := tagged.Template
+	if len(tl.Parts) != 3 || tl.Parts[0] != "a" || tl.Parts[1] != "b" || tl.Parts[2] != "" {
+		t.Fatalf("wrong template parts. got=%q", tl.Parts)
+	}
+	if len(tl.Expressions) != 2 {
+		t.Fatalf("wrong length of expressions. got=%d", len(tl.Expressions))
+	}
+	testIdentifier(t, tl.Expressions[0], "x")
+	testInfixExpression(t, tl.Expressions[1], 1, "+", 2)
+	if tagged.String() != input {
+		t.Errorf("tagged.String() wrong. got=%q", tagged.String())
+	}
+
+	p = New(lexer.New("`a ${1 +} b`"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected parser errors for malformed interpolation")
+	}
+}
+
+func TestGeneratorParsing(t *testing.T) {
+	input := "let f = function(xs) { let g = function() { return 1 }; for (let x of xs) { yield x } }; for (y of f([1])) { yield }"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 1 || !strings.Contains(p.Errors()[0], "yield outside of a function") {
+		t.Fatalf("expected a single error for the top-level yield. got=%v", p.Errors())
+	}
+	fn := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if !fn.IsGenerator {
+		t.Errorf("function containing yield should be a generator")
+	}
+	inner := fn.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if inner.IsGenerator {
+		t.Errorf("nested function without yield should not be a generator")
+	}
+	loop, ok := fn.Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.ForOfExpression)
+	if !ok {
+		t.Fatalf("expected ast.ForOfExpression. got=%T", fn.Body.Statements[2].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, loop.Name, "x")
+	testIdentifier(t, loop.Iterable, "xs")
+	if _, ok := loop.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.YieldExpression); !ok {
+		t.Errorf("expected ast.YieldExpression in loop body")
+	}
+	outer, ok := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.ForOfExpression)
+	if !ok {
+		t.Fatalf("expected ast.ForOfExpression without let. got=%T", program.Statements[2].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, outer.Name, "y")
+
+	p = New(lexer.New("for (let i = 0; i < 3; i++) { of }"))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestConcurrencyParsing(t *testing.T) {
+	input := "let t = spawn worker(1, 2)\nselect { case let v = ch.recv() { v } case out.send(x + 1) { 1 } case done.recv() {} default { 0 } }"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	spawn, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.SpawnExpression)
+	if !ok {
+		t.Fatalf("expected ast.SpawnExpression. got=%T", program.Statements[0].(*ast.LetStatement).Value)
+	}
+	testIdentifier(t, spawn.Call.Function, "worker")
+	if len(spawn.Call.Arguments) != 2 {
+		t.Errorf("spawn should keep the arguments of the call. got=%d", len(spawn.Call.Arguments))
+	}
+	sel, ok := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.SelectExpression)
+	if !ok {
+		t.Fatalf("expected ast.SelectExpression. got=%T", program.Statements[1].(*ast.ExpressionStatement).Expression)
+	}
+	expected := "select { case let v = ch.recv() { v;  } case out.send((x + 1)) { 1;  } case done.recv() {  } default { 0;  } }"
+	if sel.String() != expected {
+		t.Errorf("wrong select. got=%q, want=%q", sel.String(), expected)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn ch.send(1)", "spawn expects a function call"},
+		{"select { case ch.close() {} }", "select case must be a channel send or recv"},
+		{"select { case let v = ch.send(1) {} }", "select case must be a channel send or recv"},
+		{"select { default {} default {} }", "multiple defaults in select"},
+		{"select { 1 }", "expected case or default in select"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || !strings.Contains(p.Errors()[0], tt.expected) {
+			t.Errorf("%s: expected error %q. got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestPatternParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b = 1, ...c] = x", "let [a, b=1, ...c] = x"},
+		{"let {a, 'b': [c], d = 1, ...e} = x", "let {a, b:[c], d=1, ...e} = x"},
+		{"[a, {b: c}] = x", "[a, {b:c}]=x"},
+		{"[h[0], a = 1] = x", "[(h[0]), a=1]=x"},
+		{"function([a], {b}, c) {}", "function([a],{b},c)"},
+		{"a\n[b] = x", "a; [b]=x"},
+		{"a [\n0]", "(a[0])"},
+		{"[a, ...b] = x", "[a, ...b]=x"},
+		{"{k: a, ...b} = x", "{k:a, ...b}=x"},
+		{"[...a, 1, ...f(b)]; {...a, k: 1}; f(...a, b)", "[...a, 1, ...f(b)]; {...a, k:1}; f(...a, b)"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. got=%q, want=%q", tt.input, program.String(), tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, 1] = x", "expected a name or a pattern, got INT instead"},
+		{"let {'k'} = x", "expected a name or a key followed by ':', got k instead"},
+		{"let [...a, b] = x", "expected token to be ], got , instead"},
+		{"[a, 1] = x", "cannot assign to 1"},
+		{"[...a, b] = x", "...a must come last in a pattern"},
+		{"[...] ", "no prefix parse function for ]"},
+		{"[a, f()] = x", "cannot assign to f()"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || !strings.Contains(p.Errors()[0], tt.expected) {
+			t.Errorf("%s: expected error %q. got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.Tokenliteral not 'let'. got=%q", s.TokenLiteral())
@@ -467,8 +627,8 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if letStmt, ok := s.(*ast.LetStatement); !ok {
 		t.Errorf("s not *ast.LetStatement. got=%T", s)
 		return false
-	} else if letStmt.Name.Value != name {
-		t.Errorf("ltStmt.Name.Value not '%s'. got=%s", name, letStmt.Name.Value)
+	} else if letStmt.Name.String() != name {
+		t.Errorf("ltStmt.Name.Value not '%s'. got=%s", name, letStmt.Name)
 		return false
 	} else if letStmt.Name.TokenLiteral() != name {
 		t.Errorf("s.Name not %s. got=%s", name, letStmt.Name)
@@ -534,6 +694,24 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
 	return true
 }
 
+func TestSplitError(t *testing.T) {
+	tests := []struct {
+		msg       string
+		line, col int
+		text      string
+	}{
+		{"[1:5]expected token to be IDENT, got = instead", 1, 5, "expected token to be IDENT, got = instead"},
+		{"[12:30]no prefix parse function for ] found", 12, 30, "no prefix parse function for ] found"},
+		{"too many errors", 0, 0, "too many errors"},
+	}
+	for _, tt := range tests {
+		line, col, text := SplitError(tt.msg)
+		if line != tt.line || col != tt.col || text != tt.text {
+			t.Errorf("SplitError(%q) = %d, %d, %q, want %d, %d, %q", tt.msg, line, col, text, tt.line, tt.col, tt.text)
+		}
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/token"
+)
+
+// parsePattern parses what a let or a parameter binds, curToken is its first token: a name, an array pattern
+// like [a, b] or a hash pattern like {name, age: years}
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+	msg := fmt.Sprintf("[%s]expected a name or a pattern, got %s instead", lineCol(p.curToken.Pos), p.curToken.Type)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
+// parseDefault parses the '= value' after target in a pattern if there is one
+func (p *Parser) parseDefault(target ast.Expression) ast.Expression {
+	if !p.peekTokenIs(token.ASSIGN) {
+		return target
+	}
+	p.nextToken()
+	e := &ast.AssignExpression{Token: p.curToken, Name: target}
+	p.nextToken()
+	e.Value = p.parseExpression(LOWEST)
+	return e
+}
+
+func (p *Parser) parseArrayPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			// the rest comes last
+			p.nextToken()
+			if pattern.Rest = p.parsePattern(); pattern.Rest == nil {
+				return nil
+			}
+			break
+		}
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, p.parseDefault(element))
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	pattern.Rbracket = p.curToken.Pos
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Expression {
+	pattern := &ast.HashPattern{Token: p.curToken}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if pattern.Rest = p.parsePattern(); pattern.Rest == nil {
+				return nil
+			}
+			break
+		}
+		property := &ast.PatternProperty{Key: p.parseExpression(SLICE)}
+		if property.Key == nil {
+			return nil
+		}
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if property.Value = p.parsePattern(); property.Value == nil {
+				return nil
+			}
+		} else if key, ok := property.Key.(*ast.Identifier); ok {
+			// {name} binds name
+			property.Value = &ast.Identifier{Token: key.Token, Value: key.Value}
+		} else {
+			msg := fmt.Sprintf("[%s]expected a name or a key followed by ':', got %s instead", lineCol(property.Key.Pos()), property.Key.String())
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		property.Value = p.parseDefault(property.Value)
+		pattern.Properties = append(pattern.Properties, property)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	pattern.Rbrace = p.curToken.Pos
+	return pattern
+}
+
+// toPattern turns the array or hash literal on the left of an assignment into the pattern it stands for,
+// as in [a, b] = [b, a]. It returns nil if e holds something that cannot be assigned.
+func (p *Parser) toPattern(e ast.Expression) ast.Expression {
+	switch n := e.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return n
+	case *ast.AssignExpression:
+		// a default, [a = 1] = ...
+		if n.Token.Type != token.ASSIGN {
+			break
+		}
+		if n.Name = p.toPattern(n.Name); n.Name == nil {
+			return nil
+		}
+		return n
+	case *ast.ArrayLiteral:
+		pattern := &ast.ArrayPattern{Token: n.Token, Rbracket: n.Rbracket}
+		for i, element := range n.Elements {
+			if spread, ok := element.(*ast.SpreadExpression); ok {
+				if pattern.Rest = p.toRest(spread, i == len(n.Elements)-1); pattern.Rest == nil {
+					return nil
+				}
+				continue
+			}
+			target := p.toPattern(element)
+			if target == nil {
+				return nil
+			}
+			pattern.Elements = append(pattern.Elements, target)
+		}
+		return pattern
+	case *ast.HashLiteral:
+		pattern := &ast.HashPattern{Token: n.Token, Rbrace: n.Rbrace}
+		for i, key := range n.Keys {
+			if spread, ok := key.(*ast.SpreadExpression); ok {
+				if pattern.Rest = p.toRest(spread, i == len(n.Keys)-1); pattern.Rest == nil {
+					return nil
+				}
+				continue
+			}
+			target := p.toPattern(n.Pairs[key])
+			if target == nil {
+				return nil
+			}
+			pattern.Properties = append(pattern.Properties, &ast.PatternProperty{Key: key, Value: target})
+		}
+		return pattern
+	}
+	if e != nil {
+		msg := fmt.Sprintf("[%s]cannot assign to %s", lineCol(e.Pos()), e.String())
+		p.errors = append(p.errors, msg)
+	}
+	return nil
+}
+
+// toRest turns the spread in an array or hash literal on the left of an assignment into the rest of its pattern,
+// as in [first, ...others] = xs
+func (p *Parser) toRest(spread *ast.SpreadExpression, isLast bool) ast.Expression {
+	if !isLast {
+		msg := fmt.Sprintf("[%s]%s must come last in a pattern", lineCol(spread.Pos()), spread.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	return p.toPattern(spread.Value)
+}
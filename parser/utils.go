@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/yzbmz5913/stang/ast"
 	"github.com/yzbmz5913/stang/token"
+	"regexp"
+	"strconv"
 )
 
 type (
@@ -56,10 +58,30 @@ func (p *Parser) curPrecedence() int {
 
 // parser error handlers
 func (p *Parser) peekError(typ token.TokenType) {
-	msg := fmt.Sprintf("[%s]expected token to be %s, got %s instead", p.peekToken.Pos, typ, p.peekToken.Type)
+	msg := fmt.Sprintf("[%s]expected token to be %s, got %s instead", lineCol(p.peekToken.Pos), typ, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
 }
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("[%s]no prefix parse function for %s found", p.curToken.Pos, t)
+	msg := fmt.Sprintf("[%s]no prefix parse function for %s found", lineCol(p.curToken.Pos), t)
 	p.errors = append(p.errors, msg)
 }
+
+// lineCol returns pos without its file for the errors, the file is left to whoever reports them
+func lineCol(pos token.Position) string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Col)
+}
+
+// errorPos matches the position lineCol puts in front of an error
+var errorPos = regexp.MustCompile(`^\[(\d+):(\d+)\]`)
+
+// SplitError splits a message of Errors into the line and column it starts with and the text after them,
+// line is 0 for a message without a position
+func SplitError(msg string) (line, col int, text string) {
+	m := errorPos.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, 0, msg
+	}
+	line, _ = strconv.Atoi(m[1])
+	col, _ = strconv.Atoi(m[2])
+	return line, col, msg[len(m[0]):]
+}
@@ -0,0 +1,184 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// pprof.go writes profiles in the gzipped protocol buffer format of pprof, see
+// https://github.com/google/pprof/blob/main/proto/profile.proto for the fields written here.
+// The stang functions and lines take the place of Go ones, so go tool pprof shows the calls of the program.
+
+// buffer encodes protocol buffer messages
+type buffer struct {
+	data []byte
+}
+
+func (b *buffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// uint64Field writes a field of wire type varint, zero values are left out like proto3 does
+func (b *buffer) uint64Field(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *buffer) int64Field(field int, x int64) {
+	b.uint64Field(field, uint64(x))
+}
+
+func (b *buffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// messageField writes a nested message encoded by f
+func (b *buffer) messageField(field int, f func(m *buffer)) {
+	m := &buffer{}
+	f(m)
+	b.bytesField(field, m.data)
+}
+
+// packedField writes repeated integers as one packed field
+func (b *buffer) packedField(field int, xs []uint64) {
+	m := &buffer{}
+	for _, x := range xs {
+		m.varint(x)
+	}
+	b.bytesField(field, m.data)
+}
+
+// field numbers of profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// WritePprof writes the samples of the profile in the format of pprof, each sample has the number of
+// events and the time charged to its stack
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	table := []string{""}
+	index := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = int64(len(table))
+		table = append(table, s)
+		return index[s]
+	}
+
+	b := &buffer{}
+	valueType := func(field int, typ, unit string) {
+		b.messageField(field, func(m *buffer) {
+			m.int64Field(valueTypeType, str(typ))
+			m.int64Field(valueTypeUnit, str(unit))
+		})
+	}
+	valueType(profileSampleType, "events", "count")
+	valueType(profileSampleType, "time", "nanoseconds")
+
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := p.samples[key]
+		ids := make([]uint64, len(s.stack))
+		for i, loc := range s.stack {
+			ids[i] = loc.id
+		}
+		b.messageField(profileSample, func(m *buffer) {
+			m.packedField(sampleLocationID, ids)
+			m.packedField(sampleValue, []uint64{uint64(s.events), uint64(s.time)})
+		})
+	}
+
+	var locations []*location
+	for _, lines := range p.locations {
+		for _, loc := range lines {
+			locations = append(locations, loc)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].id < locations[j].id })
+	for _, loc := range locations {
+		loc := loc
+		b.messageField(profileLocation, func(m *buffer) {
+			m.uint64Field(locationID, loc.id)
+			m.messageField(locationLine, func(l *buffer) {
+				l.uint64Field(lineFunctionID, loc.function.id)
+				l.int64Field(lineLine, int64(loc.line))
+			})
+		})
+	}
+
+	functions := make([]*function, 0, len(p.functions))
+	for _, f := range p.functions {
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].id < functions[j].id })
+	for _, f := range functions {
+		f := f
+		b.messageField(profileFunction, func(m *buffer) {
+			m.uint64Field(functionID, f.id)
+			m.int64Field(functionName, str(f.name))
+			m.int64Field(functionSystemName, str(f.name))
+			m.int64Field(functionFilename, str(f.file))
+			m.int64Field(functionStartLine, int64(f.startLine))
+		})
+	}
+
+	b.int64Field(profileTimeNanos, p.start.UnixNano())
+	b.int64Field(profileDurationNanos, int64(p.total))
+	valueType(profilePeriodType, "time", "nanoseconds")
+	b.int64Field(profilePeriod, 1)
+	// the string table is written last since the fields above add to it
+	for _, s := range table {
+		b.bytesField(profileStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
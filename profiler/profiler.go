@@ -0,0 +1,254 @@
+// Package profiler measures where stang programs spend their time, it is used by stang run --profile.
+//
+// The Profiler is an evaluator.Hook: the time between two statements or expressions is charged to the stack of calls
+// in progress when the first of them started, with the line each call is at. Time spent in builtins and waiting for
+// other tasks is charged to the line that called them. Measuring slows the program down, so the times are best
+// compared with each other.
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// function is a function literal, or the top level of a file
+type function struct {
+	id        uint64
+	name      string
+	file      string
+	startLine int
+	calls     int64
+	self, cum time.Duration
+}
+
+// location is a line of a function
+type location struct {
+	id       uint64
+	function *function
+	line     int
+	count    int64 // how many statements started on the line
+	self     time.Duration
+}
+
+type sample struct {
+	stack  []*location // the innermost first
+	events int64
+	time   time.Duration
+}
+
+// Profiler records the calls, lines and times of the programs evaluated with it as their hook
+type Profiler struct {
+	mu           sync.Mutex
+	start        time.Time
+	last         time.Time
+	stack        []*location // where the program was at the last event
+	files        map[*ast.BlockStatement]string
+	file         string // the file of the program being evaluated
+	functions    map[interface{}]*function
+	locations    map[*function]map[int]*location
+	samples      map[string]*sample
+	nextLocation uint64
+	positions    map[*evaluator.Frame]token.Position // the position each call in progress is at
+	main         token.Position                      // the position of the top level
+	total        time.Duration
+}
+
+// New returns a Profiler that starts measuring with the first program
+func New() *Profiler {
+	return &Profiler{
+		files:     map[*ast.BlockStatement]string{},
+		functions: map[interface{}]*function{},
+		locations: map[*function]map[int]*location{},
+		samples:   map[string]*sample{},
+		positions: map[*evaluator.Frame]token.Position{},
+	}
+}
+
+// File must be called before evaluating a program read from the file called name,
+// so that its lines and the functions it defines are reported under that name
+func (p *Profiler) File(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.file = name
+	if p.start.IsZero() {
+		p.start = time.Now()
+		p.last = p.start
+	}
+}
+
+// Before charges the time since the previous event to where the program was and moves on to node
+func (p *Profiler) Before(ctx context.Context, node ast.Node, pos token.Position, _ *evaluator.Scope) evaluator.Object {
+	if pos.Line == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.charge(time.Now())
+
+	if fn, ok := node.(*ast.FunctionLiteral); ok && fn.Body != nil {
+		if _, ok := p.files[fn.Body]; !ok {
+			p.files[fn.Body] = p.file
+		}
+	}
+	frames := evaluator.Frames(ctx)
+	var innermost *function
+	if len(frames) == 0 {
+		p.main = pos
+		innermost = p.function(p.file, nil)
+	} else {
+		f := frames[0]
+		innermost = p.function(f.Function.Body, f)
+		if _, ok := p.positions[f]; !ok {
+			innermost.calls++
+		}
+		p.positions[f] = pos
+		if len(p.positions) > 2*len(frames)+64 {
+			// forget the calls that returned
+			current := make(map[*evaluator.Frame]token.Position, len(frames))
+			for _, f := range frames {
+				current[f] = p.positions[f]
+			}
+			p.positions = current
+		}
+	}
+	here := p.location(innermost, pos.Line)
+	if _, ok := node.(ast.Statement); ok {
+		here.count++
+	}
+
+	p.stack = append(p.stack[:0], here)
+	if len(frames) > 0 {
+		for _, f := range frames[1:] {
+			p.stack = append(p.stack, p.location(p.function(f.Function.Body, f), p.positions[f].Line))
+		}
+		p.stack = append(p.stack, p.location(p.function(p.file, nil), p.main.Line))
+	}
+	// the time spent here is not the program's
+	p.last = time.Now()
+	return nil
+}
+
+// Stop charges the time since the last event, it is called when the program finished
+func (p *Profiler) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.charge(time.Now())
+	p.stack = nil
+}
+
+// charge adds the time since the last event to the stack the program was at
+func (p *Profiler) charge(now time.Time) {
+	if len(p.stack) == 0 {
+		return
+	}
+	elapsed := now.Sub(p.last)
+	p.total += elapsed
+	p.stack[0].self += elapsed
+	p.stack[0].function.self += elapsed
+	seen := map[*function]bool{}
+	key := make([]byte, 0, 8*len(p.stack))
+	for _, loc := range p.stack {
+		if !seen[loc.function] {
+			seen[loc.function] = true
+			loc.function.cum += elapsed
+		}
+		key = strconv.AppendUint(key, loc.id, 10)
+		key = append(key, ',')
+	}
+	s, ok := p.samples[string(key)]
+	if !ok {
+		s = &sample{stack: append([]*location(nil), p.stack...)}
+		p.samples[string(key)] = s
+	}
+	s.events++
+	s.time += elapsed
+}
+
+// function returns the stats of the function whose body is key, or of the top level of the file key,
+// frame is a call of it used to find its name
+func (p *Profiler) function(key interface{}, frame *evaluator.Frame) *function {
+	if f, ok := p.functions[key]; ok {
+		return f
+	}
+	f := &function{id: uint64(len(p.functions) + 1)}
+	if frame == nil {
+		f.name, f.file, f.startLine = "main", key.(string), 1
+	} else {
+		body := key.(*ast.BlockStatement)
+		f.name, f.file, f.startLine = frame.Name(), p.files[body], body.Token.Pos.Line
+	}
+	p.functions[key] = f
+	return f
+}
+
+func (p *Profiler) location(f *function, line int) *location {
+	lines, ok := p.locations[f]
+	if !ok {
+		lines = map[int]*location{}
+		p.locations[f] = lines
+	}
+	loc, ok := lines[line]
+	if !ok {
+		p.nextLocation++
+		loc = &location{id: p.nextLocation, function: f, line: line}
+		lines[line] = loc
+	}
+	return loc
+}
+
+// WriteReport writes the functions sorted by the time spent in them, then the lines sorted the same way
+func (p *Profiler) WriteReport(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	functions := make([]*function, 0, len(p.functions))
+	for _, f := range p.functions {
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].self != functions[j].self {
+			return functions[i].self > functions[j].self
+		}
+		return functions[i].id < functions[j].id
+	})
+	fmt.Fprintf(&b, "total time %s\n\n", p.total)
+	fmt.Fprintf(&b, "%12s %6s %12s %6s %8s  %s\n", "self", "self%", "cum", "cum%", "calls", "function")
+	for _, f := range functions {
+		fmt.Fprintf(&b, "%12s %6s %12s %6s %8d  %s %s:%d\n", f.self, p.percent(f.self), f.cum, p.percent(f.cum), f.calls, f.name, f.file, f.startLine)
+	}
+
+	var locations []*location
+	for _, lines := range p.locations {
+		for _, loc := range lines {
+			locations = append(locations, loc)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].self != locations[j].self {
+			return locations[i].self > locations[j].self
+		}
+		return locations[i].id < locations[j].id
+	})
+	fmt.Fprintf(&b, "\n%12s %6s %8s  %s\n", "self", "self%", "count", "line")
+	for _, loc := range locations {
+		fmt.Fprintf(&b, "%12s %6s %8d  %s:%d (%s)\n", loc.self, p.percent(loc.self), loc.count, loc.function.file, loc.line, loc.function.name)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (p *Profiler) percent(d time.Duration) string {
+	if p.total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(d)/float64(p.total))
+}
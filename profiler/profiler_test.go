@@ -0,0 +1,99 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const program = `let square = function(n) {
+    return n * n
+}
+let total = 0
+for (let i = 0; i < 4; i++) {
+    total += square(i)
+}
+print(total)
+`
+
+func profile(t *testing.T) *Profiler {
+	var out bytes.Buffer
+	p := New()
+	ctx := evaluator.WithHook(evaluator.WithRuntime(context.Background(), &evaluator.Runtime{Stdout: &out}), p)
+	p.File("prog.stg")
+	if result := evaluator.Eval(ctx, parser.New(lexer.New(program)).ParseProgram(), evaluator.NewScope(nil)); result != nil && result.Type() == evaluator.ErrorObj {
+		t.Fatal(result.String(0))
+	}
+	p.Stop()
+	if out.String() != "14\n" {
+		t.Fatalf("wrong output %q", out.String())
+	}
+	return p
+}
+
+func TestReport(t *testing.T) {
+	var b bytes.Buffer
+	if err := profile(t).WriteReport(&b); err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+	tests := []struct {
+		pattern string
+		fields  []string // the last fields of the matching row
+	}{
+		{"square prog.stg:1", []string{"4", "square", "prog.stg:1"}},
+		{"main prog.stg:1", []string{"0", "main", "prog.stg:1"}},
+		{"prog.stg:2 (square)", []string{"4", "prog.stg:2", "(square)"}},
+		{"prog.stg:6 (main)", []string{"4", "prog.stg:6", "(main)"}},
+		{"prog.stg:8 (main)", []string{"1", "prog.stg:8", "(main)"}},
+	}
+	if !strings.HasPrefix(report, "total time ") {
+		t.Errorf("the report should start with the total time. got=\n%s", report)
+	}
+	for _, tt := range tests {
+		found := false
+		for _, line := range strings.Split(report, "\n") {
+			if strings.HasSuffix(line, tt.pattern) {
+				found = true
+				fields := strings.Fields(line)
+				if got := fields[len(fields)-len(tt.fields):]; strings.Join(got, " ") != strings.Join(tt.fields, " ") {
+					t.Errorf("wrong row for %s. got=%q", tt.pattern, line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no row for %s in\n%s", tt.pattern, report)
+		}
+	}
+}
+
+func TestPprof(t *testing.T) {
+	var b bytes.Buffer
+	if err := profile(t).WritePprof(&b); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the string table holds the names of the functions and files
+	for _, s := range []string{"events", "nanoseconds", "square", "main", "prog.stg"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("the profile should contain %q", s)
+		}
+	}
+	// the first field is the sample type events/count
+	if data[0] != profileSampleType<<3|2 {
+		t.Errorf("wrong first field %#x", data[0])
+	}
+}
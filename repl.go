@@ -0,0 +1,268 @@
+package stang
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+	// historyLimit is the number of inputs kept in the history file
+	historyLimit = 1000
+)
+
+const replHelp = `input spanning several lines is continued until its brackets and strings are closed.
+tab completes variables, builtins, keywords and, after a dot, methods.
+meta-commands:
+  :help          show this help
+  :env           list the variables defined in the session
+  :ast code      show the statements code parses into
+  :tokens code   show the tokens of code
+  :time code     evaluate code and show how long it took
+  :load file     evaluate a file in the session
+  :save file     write the code evaluated in the session to a file
+  :reset         forget all variables
+  :history       show the inputs of previous sessions
+  exit           leave
+`
+
+type repl struct {
+	out         io.Writer
+	scope       *evaluator.Scope
+	ctx         context.Context
+	session     []string // code evaluated in this session, written by :save
+	history     []string // inputs of all sessions, oldest first
+	historyPath string   // empty when no history is kept
+}
+
+// StartCommandLine runs an interactive session reading from in.
+// Inputs are kept across sessions in the file named by $STANG_HISTORY, ~/.stang_history by default.
+func StartCommandLine(in io.Reader, out io.Writer) {
+	historyPath := os.Getenv("STANG_HISTORY")
+	if historyPath == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			historyPath = filepath.Join(home, ".stang_history")
+		}
+	}
+	startREPL(in, out, historyPath)
+}
+
+func startREPL(in io.Reader, out io.Writer, historyPath string) {
+	_, _ = io.WriteString(out, "Welcome to use Stan's programming language(Stang)!\n")
+	_, _ = io.WriteString(out, "type :help for help, or pass in filenames as parameters to run source code\n\n")
+
+	r := &repl{out: out, historyPath: historyPath}
+	r.reset()
+	r.loadHistory()
+	var reader lineReader = &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		reader = &lineEditor{
+			file:     f,
+			in:       bufio.NewReader(f),
+			out:      out,
+			history:  func() []string { return r.history },
+			complete: r.complete,
+		}
+	}
+	var input []string
+	for {
+		p := prompt
+		if len(input) != 0 {
+			p = continuationPrompt
+		}
+		line, err := reader.readLine(p)
+		if err == errInterrupt {
+			input = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if strings.HasSuffix(line, "\t") {
+			r.showCompletions(strings.TrimRight(line, "\t"))
+			continue
+		}
+		input = append(input, line)
+		src := strings.Join(input, "\n")
+		if incomplete(src) {
+			continue
+		}
+		input = nil
+		if strings.TrimSpace(src) == "" {
+			continue
+		}
+		r.remember(src)
+		if strings.ToLower(strings.TrimSpace(src)) == "exit" {
+			_, _ = io.WriteString(out, "bye\n")
+			return
+		}
+		if strings.HasPrefix(strings.TrimSpace(src), ":") {
+			r.command(strings.TrimSpace(src))
+			continue
+		}
+		r.eval(src)
+	}
+}
+
+// showCompletions lists the candidates completing line, for input that does not come from a terminal
+func (r *repl) showCompletions(line string) {
+	if _, candidates := r.complete(line); len(candidates) != 0 {
+		_, _ = io.WriteString(r.out, strings.Join(candidates, "  ")+"\n")
+	}
+}
+
+func (r *repl) reset() {
+	r.scope = evaluator.NewScope(nil)
+	r.ctx = evaluator.WithScheduler(evaluator.WithRuntime(context.Background(), &evaluator.Runtime{Stdout: r.out}))
+	r.session = nil
+}
+
+// eval evaluates src in the session and prints the result, it reports whether src parsed
+func (r *repl) eval(src string) bool {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(r.out, p.Errors())
+		return false
+	}
+	r.session = append(r.session, src)
+	if result := evaluator.Eval(r.ctx, program, r.scope); result != nil {
+		_, _ = io.WriteString(r.out, result.String(0)+"\n")
+	}
+	return true
+}
+
+func (r *repl) command(line string) {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch name {
+	case ":help":
+		_, _ = io.WriteString(r.out, replHelp)
+	case ":env":
+		for _, name := range r.scope.Names() {
+			v, _ := r.scope.GetCurrent(name)
+			_, _ = fmt.Fprintf(r.out, "%s = %s\n", name, v.String(0))
+		}
+	case ":ast":
+		p := parser.New(lexer.New(arg))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(r.out, p.Errors())
+			return
+		}
+		dumpAST(r.out, program)
+	case ":tokens":
+		dumpTokens(r.out, arg)
+	case ":time":
+		start := time.Now()
+		if r.eval(arg) {
+			_, _ = fmt.Fprintf(r.out, "took %s\n", time.Since(start))
+		}
+	case ":load":
+		src, err := ioutil.ReadFile(arg)
+		if err != nil {
+			_, _ = fmt.Fprintf(r.out, "Error: %s\n", err)
+			return
+		}
+		r.eval(string(src))
+	case ":save":
+		if arg == "" {
+			_, _ = io.WriteString(r.out, "Error: :save needs a file name\n")
+			return
+		}
+		if err := ioutil.WriteFile(arg, []byte(strings.Join(r.session, "\n")+"\n"), 0644); err != nil {
+			_, _ = fmt.Fprintf(r.out, "Error: %s\n", err)
+		}
+	case ":reset":
+		r.reset()
+	case ":history":
+		for i, input := range r.history {
+			_, _ = fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(input, "\n", "\n      "))
+		}
+	default:
+		_, _ = fmt.Fprintf(r.out, "Error: unknown command %s, type :help for help\n", name)
+	}
+}
+
+// loadHistory reads the history file, each line of which holds one quoted input
+func (r *repl) loadHistory() {
+	if r.historyPath == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(r.historyPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if input, err := strconv.Unquote(line); err == nil {
+			r.history = append(r.history, input)
+		}
+	}
+	if len(r.history) > historyLimit {
+		r.history = r.history[len(r.history)-historyLimit:]
+		r.saveHistory()
+	}
+}
+
+func (r *repl) saveHistory() {
+	var out strings.Builder
+	for _, input := range r.history {
+		out.WriteString(strconv.Quote(input) + "\n")
+	}
+	_ = ioutil.WriteFile(r.historyPath, []byte(out.String()), 0600)
+}
+
+// remember adds input to the history and appends it to the history file
+func (r *repl) remember(input string) {
+	r.history = append(r.history, input)
+	if r.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(r.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(strconv.Quote(input) + "\n")
+}
+
+// incomplete reports whether src ends inside brackets or a string, so that the REPL should read on
+func incomplete(src string) bool {
+	depth := 0
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.ILLEGAL:
+			// the lexer gives up on an unterminated string at its opening quote
+			if tok.Pos.Offset < len(src) && strings.IndexByte("'\"`", src[tok.Pos.Offset]) >= 0 {
+				return true
+			}
+		}
+	}
+	return depth > 0
+}
+
+func printParserErrors(out io.Writer, errors []string) {
+	for _, msg := range errors {
+		_, _ = io.WriteString(out, "Error: "+msg+"\n")
+	}
+}
@@ -0,0 +1,121 @@
+package stang
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = 1", false},
+		{"let f = function(x) {", true},
+		{"let f = function(x) {\n  return x\n}", false},
+		{"[1, 2,", true},
+		{"print(1", true},
+		{"let s = 'abc", true},
+		{"let s = `a\nb", true},
+		{"let s = `a ${ {b: 1}['b'] }`", false},
+		{"}", false},
+		{"1 @", false},
+	}
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestREPL(t *testing.T) {
+	dir := t.TempDir()
+	history := filepath.Join(dir, "history")
+	saved := filepath.Join(dir, "saved.stg")
+	input := strings.Join([]string{
+		"let add = function(a, b) {",
+		"  return a + b",
+		"}",
+		"add(1, 2)",
+		"let s = 'one",
+		"two'",
+		":env",
+		":tokens let x = 1",
+		":ast let x = 1 + 2",
+		":save " + saved,
+		":reset",
+		":env",
+		"add",
+		":load " + saved,
+		"s",
+		":nope",
+		"exit",
+	}, "\n")
+	var out bytes.Buffer
+	startREPL(strings.NewReader(input), &out, history)
+	expected := []string{
+		">> .. .. function(a, b) { return (a + b);  }\n>> 3\n",
+		">> .. ",
+		"add = function(a, b) { return (a + b);  }\ns = one\ntwo\n",
+		"1:1 LET \"let\"\n1:5 IDENT \"x\"\n1:7 = \"=\"\n1:9 INT \"1\"\n",
+		"LetStatement let x = (1 + 2)\n",
+		"Error: unknown identifier: 'add' is not defined\n",
+		">> one\ntwo\n>> one\ntwo\n",
+		"Error: unknown command :nope, type :help for help\n",
+		"bye\n",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q. got=\n%s", want, got)
+		}
+	}
+	data, err := ioutil.ReadFile(saved)
+	if err != nil || string(data) != "let add = function(a, b) {\n  return a + b\n}\nadd(1, 2)\nlet s = 'one\ntwo'\n" {
+		t.Errorf("wrong saved session. got=%q, %v", data, err)
+	}
+
+	// the history survives the session
+	out.Reset()
+	startREPL(strings.NewReader(":history\n"), &out, history)
+	if !strings.Contains(out.String(), "   1  let add = function(a, b) {\n        return a + b\n      }\n   2  add(1, 2)\n") {
+		t.Errorf("history should list the inputs of the previous session. got=\n%s", out.String())
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	r := &repl{out: ioutil.Discard}
+	r.reset()
+	r.eval("let words = 'a b'; let wordCount = 2; let arr = [1]")
+	tests := []struct {
+		input    string
+		start    int
+		expected []string
+	}{
+		{"wor", 0, []string{"wordCount", "words"}},
+		{"print(words.", 12, []string{"split", "toLower", "toUpper"}},
+		{"words.to", 6, []string{"toLower", "toUpper"}},
+		{"'abc'.sp", 6, []string{"split"}},
+		{"arr.p", 4, []string{"pop", "push"}},
+		{"time.u", 5, []string{"unix"}},
+		{"fun", 0, []string{"function"}},
+		{"chan", 0, []string{"channel"}},
+		{"1.", 2, nil},
+		{"missing.", 8, nil},
+	}
+	for _, tt := range tests {
+		start, candidates := r.complete(tt.input)
+		if start != tt.start || strings.Join(candidates, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("complete(%q) = %d, %v, want %d, %v", tt.input, start, candidates, tt.start, tt.expected)
+		}
+	}
+
+	var out bytes.Buffer
+	startREPL(strings.NewReader("let value = 1\nval\t\nvalue.\t\n"), &out, "")
+	if !strings.Contains(out.String(), ">> value\n>> >> ") {
+		t.Errorf("a line ending with a tab should list completions. got=\n%s", out.String())
+	}
+}
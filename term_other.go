@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package stang
+
+import (
+	"errors"
+	"os"
+)
+
+// the line editor is only available on linux and macOS, elsewhere the REPL reads plain lines
+
+func isTerminal(*os.File) bool {
+	return false
+}
+
+func makeRaw(*os.File) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
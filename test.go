@@ -0,0 +1,142 @@
+package stang
+
+import (
+	"flag"
+	"fmt"
+	"github.com/yzbmz5913/stang/coverage"
+	"github.com/yzbmz5913/stang/tester"
+	"github.com/yzbmz5913/stang/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const testUsage = `usage: stang test [flags] [path...]
+  runs the tests registered with test(name, fn) in the *_test.stg files under the paths, the working directory by default.
+  Each test runs in a fresh evaluation of its file, whose directory the fs module reads.
+  It exits with 1 if a test fails and 3 if a file does not parse.
+flags:
+`
+
+func testCommand(args []string, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("stang test", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	format := f.String("format", "human", "write the results as `human`, tap or junit")
+	run := f.String("run", "", "only run the tests whose names match `regexp`")
+	timeout := f.Duration("timeout", tester.DefaultTimeout, "fail a test running longer than `duration`")
+	verbose := f.Bool("v", false, "list the tests that passed too")
+	cover := f.Bool("cover", false, "print how many statements and branches of each file the tests ran")
+	coverLCOV := f.String("coverprofile", "", "write the statements and branches the tests ran to `file` in the LCOV format")
+	coverHTML := f.String("coverhtml", "", "write the sources with the hits of each line to `file`")
+	writable := f.Bool("fs-write", false, "let the fs module write, create and remove files in the directory of each test file")
+	f.Usage = func() {
+		_, _ = io.WriteString(stderr, testUsage)
+		f.PrintDefaults()
+	}
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	write, ok := tester.Formats[*format]
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "stang test: unknown format %q\n", *format)
+		return ExitUsage
+	}
+	opts := tester.Options{Timeout: *timeout}
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang test: bad -run: %s\n", err)
+			return ExitUsage
+		}
+		opts.Run = re
+	}
+	if *cover || *coverLCOV != "" || *coverHTML != "" {
+		opts.Coverage = coverage.New()
+	}
+	paths := f.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testFiles(paths)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+		return ExitUsage
+	}
+	if len(files) == 0 {
+		_, _ = fmt.Fprintln(stderr, "stang test: no test files")
+		return ExitOK
+	}
+
+	code := ExitOK
+	var results []tester.Result
+	for _, name := range files {
+		src, err := readSource(name, nil)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			code = ExitUsage
+			continue
+		}
+		opts.FS = fileSystem(filepath.Dir(name), *writable)
+		fileResults, err := tester.RunFile(name, src, opts)
+		if perr, ok := err.(*tester.ParseError); ok {
+			reportParseErrors(stderr, token.NewFile(name, src), perr.Errors)
+			code = ExitSyntaxError
+			continue
+		}
+		results = append(results, fileResults...)
+	}
+	if err := write(stdout, results, *verbose); err != nil {
+		_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+		return ExitRuntimeError
+	}
+	if opts.Coverage != nil {
+		if err := writeCoverage(opts.Coverage, stdout, *cover, *coverLCOV, *coverHTML); err != nil {
+			_, _ = fmt.Fprintf(stderr, "stang: %s\n", err)
+			return ExitRuntimeError
+		}
+	}
+	if code == ExitOK && tester.Failed(results) > 0 {
+		code = ExitRuntimeError
+	}
+	return code
+}
+
+// testFiles returns the test files named by paths, directories are searched for *_test.stg files
+func testFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		var found []string
+		err = filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && name != path && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && strings.HasSuffix(name, "_test.stg") {
+				found = append(found, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
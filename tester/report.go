@@ -0,0 +1,149 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// report.go writes results for people, in the Test Anything Protocol and as JUnit XML for CI servers
+
+// Formats are the names of the formats results can be written in
+var Formats = map[string]func(w io.Writer, results []Result, verbose bool) error{
+	"human": WriteHuman,
+	"tap":   WriteTAP,
+	"junit": WriteJUnit,
+}
+
+// Failed counts the failed results
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Failed {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteHuman lists the failed tests with their messages and output, verbose lists the passed ones too
+func WriteHuman(w io.Writer, results []Result, verbose bool) error {
+	var b strings.Builder
+	for _, r := range results {
+		if !r.Failed && !verbose {
+			continue
+		}
+		status := "PASS"
+		if r.Failed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "--- %s: %s (%ss)\n", status, r.Name, seconds(r.Duration))
+		if r.Failed {
+			where := r.File
+			if r.Pos.IsValid() {
+				where = r.Pos.String()
+			}
+			fmt.Fprintf(&b, "    %s: %s\n", where, indent(r.Message, "    "))
+		}
+		if r.Output != "" && (r.Failed || verbose) {
+			fmt.Fprintf(&b, "    %s\n", indent(strings.TrimSuffix(r.Output, "\n"), "    "))
+		}
+	}
+	if failed := Failed(results); failed > 0 {
+		fmt.Fprintf(&b, "FAIL: %d of %d tests failed\n", failed, len(results))
+	} else {
+		fmt.Fprintf(&b, "PASS: %d tests\n", len(results))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTAP writes the results in version 13 of the Test Anything Protocol, failures carry a YAML block
+func WriteTAP(w io.Writer, results []Result, _ bool) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(results))
+	for i, r := range results {
+		if !r.Failed {
+			fmt.Fprintf(&b, "ok %d - %s: %s\n", i+1, r.File, r.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "not ok %d - %s: %s\n", i+1, r.File, r.Name)
+		fmt.Fprintf(&b, "  ---\n  message: %s\n", strconv.Quote(r.Message))
+		if r.Output != "" {
+			fmt.Fprintf(&b, "  output: %s\n", strconv.Quote(r.Output))
+		}
+		fmt.Fprintf(&b, "  duration_ms: %d\n  ...\n", r.Duration.Milliseconds())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as JUnit XML with a test suite for each file
+func WriteJUnit(w io.Writer, results []Result, _ bool) error {
+	report := junitSuites{Tests: len(results), Failures: Failed(results)}
+	var durations []time.Duration
+	for _, r := range results {
+		if n := len(report.Suites); n == 0 || report.Suites[n-1].Name != r.File {
+			report.Suites = append(report.Suites, junitSuite{Name: r.File})
+			durations = append(durations, 0)
+		}
+		suite := &report.Suites[len(report.Suites)-1]
+		c := junitCase{Name: r.Name, ClassName: r.File, Time: seconds(r.Duration), SystemOut: r.Output}
+		if r.Failed {
+			firstLine := strings.SplitN(r.Message, "\n", 2)[0]
+			c.Failure = &junitFailure{Message: firstLine, Text: r.Message}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+		durations[len(durations)-1] += r.Duration
+	}
+	for i := range report.Suites {
+		report.Suites[i].Time = seconds(durations[i])
+	}
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+func indent(s, prefix string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,150 @@
+// Package tester runs the tests that stang scripts register with test(name, fn) and reports their results.
+//
+// Every test runs in a fresh evaluation of its file, in a new Scope with a Runtime of its own, so that tests cannot
+// see what other tests did to the variables of the file. What the file and the test print is kept with the result.
+package tester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/yzbmz5913/stang/ast"
+	"github.com/yzbmz5913/stang/coverage"
+	"github.com/yzbmz5913/stang/evaluator"
+	"github.com/yzbmz5913/stang/lexer"
+	"github.com/yzbmz5913/stang/parser"
+	"github.com/yzbmz5913/stang/token"
+	"io/fs"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long a test may run unless Options says otherwise
+const DefaultTimeout = 10 * time.Second
+
+// Options controls how the tests of a file are run
+type Options struct {
+	Timeout time.Duration  // how long each test may run, including evaluating its file, DefaultTimeout if 0
+	Run     *regexp.Regexp // only the tests whose names match are run, all of them if nil
+	FS      fs.FS          // the file system of the fs module, none if nil
+	// Coverage counts the statements and branches that the files and their tests run, if set
+	Coverage *coverage.Profile
+}
+
+// Result is the outcome of a test
+type Result struct {
+	File     string
+	Name     string
+	Failed   bool
+	Message  string         // why the test failed
+	Pos      token.Position // where the test failed, if known
+	Output   string         // what the test printed
+	Duration time.Duration
+}
+
+// ParseError is returned for a file that does not parse
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return strings.Join(e.Errors, "\n")
+}
+
+// setup names the result of a file whose top level fails before its tests could be found
+const setup = "(file)"
+
+// RunFile runs the tests of the file called name whose source is src
+func RunFile(name, src string, opts Options) ([]Result, error) {
+	p := parser.New(lexer.NewFile(token.NewFile(name, src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Coverage != nil {
+		opts.Coverage.Add(name, src, program)
+	}
+
+	// the first evaluation finds the tests, each test then gets one of its own
+	start := time.Now()
+	tests, output, err := load(program, opts)
+	if err != nil {
+		result := Result{File: name, Name: setup, Output: output, Duration: time.Since(start)}
+		result.fail(err)
+		return []Result{result}, nil
+	}
+	var results []Result
+	for i, t := range tests {
+		if opts.Run != nil && !opts.Run.MatchString(t.Name) {
+			continue
+		}
+		result := run(program, i, t.Name, opts)
+		result.File = name
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// load evaluates program and returns the tests it registered with what it printed
+func load(program *ast.Program, opts Options) ([]*evaluator.Test, string, evaluator.Object) {
+	var out bytes.Buffer
+	rt := &evaluator.Runtime{Stdout: &out, FS: opts.FS}
+	ctx, cancel := context.WithTimeout(withCoverage(evaluator.WithRuntime(context.Background(), rt), opts), opts.Timeout)
+	defer cancel()
+	if result := eval(ctx, program); result != nil && result.Type() == evaluator.ErrorObj {
+		return nil, out.String(), result
+	}
+	return rt.Tests, out.String(), nil
+}
+
+// run evaluates program again and runs the test it registers as the i-th one
+func run(program *ast.Program, i int, name string, opts Options) Result {
+	start := time.Now()
+	var out bytes.Buffer
+	rt := &evaluator.Runtime{Stdout: &out, FS: opts.FS}
+	ctx, cancel := context.WithTimeout(withCoverage(evaluator.WithScheduler(evaluator.WithRuntime(context.Background(), rt)), opts), opts.Timeout)
+	defer cancel()
+
+	result := Result{Name: name}
+	err := eval(ctx, program)
+	switch {
+	case err != nil && err.Type() == evaluator.ErrorObj:
+	case len(rt.Tests) <= i || rt.Tests[i].Name != name:
+		err = &evaluator.Error{Msg: fmt.Sprintf("the file registered other tests when %s was run", name)}
+	default:
+		err = evaluator.RunTest(ctx, rt.Tests[i])
+	}
+	if err != nil {
+		result.fail(err)
+	}
+	result.Output = out.String()
+	result.Duration = time.Since(start)
+	return result
+}
+
+// eval evaluates program in a new scope, a panic of the evaluator is returned as an error failing the file or test
+func eval(ctx context.Context, program *ast.Program) (result evaluator.Object) {
+	defer evaluator.Recover(&result)
+	return evaluator.Eval(ctx, program, evaluator.NewScope(nil))
+}
+
+// fail marks r as failed because of err
+func (r *Result) fail(err evaluator.Object) {
+	r.Failed = true
+	r.Message = strings.TrimPrefix(err.String(0), "Error: ")
+	if e, ok := err.(*evaluator.Error); ok {
+		r.Pos = e.Pos
+	}
+}
+
+// withCoverage returns ctx counting the coverage of opts, if any
+func withCoverage(ctx context.Context, opts Options) context.Context {
+	if opts.Coverage == nil {
+		return ctx
+	}
+	return evaluator.WithHook(ctx, opts.Coverage)
+}
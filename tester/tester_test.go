@@ -0,0 +1,120 @@
+package tester
+
+import (
+	"bytes"
+	"github.com/yzbmz5913/stang/token"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const suite = `let total = 0
+let add = function(a, b) { a + b }
+test("adds", function() {
+    total = total + 1
+    assertEqual(add(1, 2), 3)
+})
+test("starts afresh", function() {
+    total = total + 1
+    print("total", total)
+    assertEqual(total, 2)
+})
+test("loops", function() { while (true) { 1 } })
+`
+
+func TestRunFile(t *testing.T) {
+	results, err := RunFile("math_test.stg", suite, Options{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Result{
+		{File: "math_test.stg", Name: "adds"},
+		{File: "math_test.stg", Name: "starts afresh", Failed: true, Output: "total, 1\n",
+			Message: "assertion failed: values are not equal\n    expected: 2\n    got:      1\n    value: expected 2, got 1"},
+		{File: "math_test.stg", Name: "loops", Failed: true, Message: "evaluation timeout"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("wrong number of results. got=%+v", results)
+	}
+	// where a test fails in the file, the loop times out anywhere in its line
+	lines := []int{0, 10, 12}
+	for i, want := range expected {
+		got := results[i]
+		if got.Pos.Line != lines[i] || got.Pos.IsValid() && got.Pos.Filename != "math_test.stg" {
+			t.Errorf("result %d: wrong position %s, want line %d", i, got.Pos, lines[i])
+		}
+		got.Duration, got.Pos = 0, token.Position{}
+		if got != want {
+			t.Errorf("result %d: got=%+v, want=%+v", i, got, want)
+		}
+	}
+
+	results, _ = RunFile("math_test.stg", suite, Options{Run: regexp.MustCompile("^add")})
+	if len(results) != 1 || results[0].Name != "adds" {
+		t.Errorf("-run should select the tests. got=%+v", results)
+	}
+	results, _ = RunFile("setup_test.stg", "print('setting up'); missing", Options{})
+	if len(results) != 1 || results[0].Name != setup || results[0].Message != "unknown identifier: 'missing' is not defined" || results[0].Output != "setting up\n" {
+		t.Errorf("a failing file should be reported. got=%+v", results)
+	}
+	if _, err := RunFile("broken_test.stg", "let = 1", Options{}); err == nil || len(err.(*ParseError).Errors) == 0 {
+		t.Errorf("a file that does not parse should be an error. got=%v", err)
+	}
+}
+
+func TestReports(t *testing.T) {
+	results := []Result{
+		{File: "a_test.stg", Name: "passes", Duration: 1500 * time.Microsecond},
+		{File: "a_test.stg", Name: "fails", Failed: true, Message: "assertion failed: one\ntwo", Output: "printed\n",
+			Pos: token.Position{Filename: "a_test.stg", Offset: 40, Line: 3, Col: 5}},
+		{File: "b_test.stg", Name: "passes too"},
+	}
+	tests := []struct {
+		format   string
+		verbose  bool
+		expected string
+	}{
+		{"human", false, "--- FAIL: fails (0.000s)\n    a_test.stg:3:5: assertion failed: one\n    two\n    printed\nFAIL: 1 of 3 tests failed\n"},
+		{"human", true, "--- PASS: passes (0.002s)\n--- FAIL: fails (0.000s)\n    a_test.stg:3:5: assertion failed: one\n    two\n    printed\n--- PASS: passes too (0.000s)\nFAIL: 1 of 3 tests failed\n"},
+		{"tap", false, `TAP version 13
+1..3
+ok 1 - a_test.stg: passes
+not ok 2 - a_test.stg: fails
+  ---
+  message: "assertion failed: one\ntwo"
+  output: "printed\n"
+  duration_ms: 0
+  ...
+ok 3 - b_test.stg: passes too
+`},
+		{"junit", false, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1">
+  <testsuite name="a_test.stg" tests="2" failures="1" time="0.002">
+    <testcase name="passes" classname="a_test.stg" time="0.002"></testcase>
+    <testcase name="fails" classname="a_test.stg" time="0.000">
+      <failure message="assertion failed: one">assertion failed: one&#xA;two</failure>
+      <system-out>printed&#xA;</system-out>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.stg" tests="1" failures="0" time="0.000">
+    <testcase name="passes too" classname="b_test.stg" time="0.000"></testcase>
+  </testsuite>
+</testsuites>
+`},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Formats[tt.format](&out, results, tt.verbose); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: got=%q, want=%q", tt.format, out.String(), tt.expected)
+		}
+	}
+	var out bytes.Buffer
+	_ = WriteHuman(&out, results[:1], false)
+	if !strings.HasPrefix(out.String(), "PASS: 1 tests") {
+		t.Errorf("got=%q", out.String())
+	}
+}
@@ -0,0 +1,109 @@
+package token
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// File is a source file, it maps the offsets in its source to positions
+type File struct {
+	name  string
+	src   string
+	lines []int // the offsets of the first character of each line
+}
+
+// NewFile returns the file of src, which is called name
+func NewFile(name, src string) *File {
+	f := &File{name: name, src: src, lines: []int{0}}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+	return f
+}
+
+// Name returns the name of the file
+func (f *File) Name() string {
+	return f.name
+}
+
+// Source returns the source code of the file
+func (f *File) Source() string {
+	return f.src
+}
+
+// LineCount returns the number of lines in the file
+func (f *File) LineCount() int {
+	return len(f.lines)
+}
+
+// Position returns the position of offset in the file, offsets past the end are at the end
+func (f *File) Position(offset int) Position {
+	if offset > len(f.src) {
+		offset = len(f.src)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	i := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return Position{Filename: f.name, Offset: offset, Line: i + 1, Col: offset - f.lines[i] + 1}
+}
+
+// Line returns the text of line n without its line break, an empty string if there is no such line
+func (f *File) Line(n int) string {
+	if n < 1 || n > len(f.lines) {
+		return ""
+	}
+	end := len(f.src)
+	if n < len(f.lines) {
+		end = f.lines[n] - 1
+	}
+	return strings.TrimRight(f.src[f.lines[n-1]:end], "\r")
+}
+
+// FileSet is the set of files a program is read from, it is safe for concurrent use
+type FileSet struct {
+	mu    sync.Mutex
+	files []*File
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// AddFile adds the file called name with the source src to the set and returns it, a file added again under the
+// same name replaces the one before
+func (s *FileSet) AddFile(name, src string) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := NewFile(name, src)
+	for i, old := range s.files {
+		if old.name == name {
+			s.files[i] = f
+			return f
+		}
+	}
+	s.files = append(s.files, f)
+	return f
+}
+
+// File returns the file called name, nil if the set has none
+func (s *FileSet) File(name string) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.files {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Files returns the files in the order they were added
+func (s *FileSet) Files() []*File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*File(nil), s.files...)
+}
@@ -1,23 +1,48 @@
 package token
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type Token struct {
 	Type    TokenType
 	Literal string
 	Pos     Position // the position of the token in source code
+	End     Position // the position right after the token
 }
 
 type Position struct {
-	Offset int //offset relative to entire file
-	Line   int
-	Col    int
+	Filename string // the name of the file, empty when the source has none
+	Offset   int    //offset relative to entire file
+	Line     int
+	Col      int
+}
+
+// IsValid reports whether the position is in source code, nodes made up by the parser have none
+func (p Position) IsValid() bool {
+	return p.Line > 0
 }
 
 func (p Position) String() string {
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Col)
+	}
 	return fmt.Sprintf("%d:%d", p.Line, p.Col)
 }
 
+// Span returns the range from pos up to end, which is right after the range, as file:line:col-col when it is on
+// one line and file:line:col-line:col otherwise
+func Span(pos, end Position) string {
+	switch {
+	case !end.IsValid() || end.Offset <= pos.Offset+1 && end.Line == pos.Line:
+		return pos.String()
+	case end.Line == pos.Line:
+		return fmt.Sprintf("%s-%d", pos, end.Col-1)
+	}
+	return fmt.Sprintf("%s-%d:%d", pos, end.Line, end.Col-1)
+}
+
 type TokenType string
 
 const (
@@ -61,9 +86,11 @@ const (
 	RBRACKET = "]"
 	COLON    = ":"
 	DOT      = "."
+	ELLIPSIS = "..."
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	DELETE   = "DELETE"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
@@ -71,17 +98,24 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	STRING   = "STRING"
+	TEMPLATE = "TEMPLATE"
 	TYPEOF   = "TYPEOF"
 	WHILE    = "WHILE"
 	FOR      = "FOR"
 	BREAK    = "BREAK"
 	CONTINUE = "CONTINUE"
 	NULL     = "NULL"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
+	SELECT   = "SELECT"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
 )
 
 var keywords = map[string]TokenType{
 	"function": FUNCTION,
 	"let":      LET,
+	"const":    CONST,
 	"delete":   DELETE,
 	"true":     TRUE,
 	"false":    FALSE,
@@ -94,6 +128,11 @@ var keywords = map[string]TokenType{
 	"for":      FOR,
 	"continue": CONTINUE,
 	"null":     NULL,
+	"yield":    YIELD,
+	"spawn":    SPAWN,
+	"select":   SELECT,
+	"case":     CASE,
+	"default":  DEFAULT,
 }
 
 func NewToken(typ TokenType, ch byte) Token {
@@ -106,3 +145,13 @@ func IdentOrKeyword(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// Keywords returns the sorted keywords of the language
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
@@ -0,0 +1,61 @@
+package token
+
+import "testing"
+
+func TestFile(t *testing.T) {
+	f := NewFile("a.stg", "let a = 1\r\n\nprint(a)")
+	if f.LineCount() != 3 {
+		t.Errorf("wrong line count %d", f.LineCount())
+	}
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "a.stg:1:1"},
+		{4, "a.stg:1:5"},
+		{11, "a.stg:2:1"},
+		{12, "a.stg:3:1"},
+		{20, "a.stg:3:9"},
+		{99, "a.stg:3:9"},
+	}
+	for _, tt := range tests {
+		if pos := f.Position(tt.offset); pos.String() != tt.expected {
+			t.Errorf("offset %d: wrong position. got=%s, want=%s", tt.offset, pos, tt.expected)
+		}
+	}
+	for n, expected := range map[int]string{0: "", 1: "let a = 1", 2: "", 3: "print(a)", 4: ""} {
+		if line := f.Line(n); line != expected {
+			t.Errorf("wrong line %d. got=%q, want=%q", n, line, expected)
+		}
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	s := NewFileSet()
+	a := s.AddFile("a.stg", "1")
+	s.AddFile("b.stg", "2")
+	if s.File("a.stg") != a || s.File("c.stg") != nil {
+		t.Errorf("wrong lookup")
+	}
+	b := s.AddFile("b.stg", "3")
+	if files := s.Files(); len(files) != 2 || files[0] != a || files[1] != b {
+		t.Errorf("a file added again should replace the old one. got=%v", files)
+	}
+}
+
+func TestSpan(t *testing.T) {
+	tests := []struct {
+		pos, end Position
+		expected string
+	}{
+		{Position{Line: 1, Col: 5}, Position{Offset: 1, Line: 1, Col: 6}, "1:5"},
+		{Position{Filename: "a", Offset: 4, Line: 1, Col: 5}, Position{Filename: "a", Offset: 9, Line: 1, Col: 10}, "a:1:5-9"},
+		{Position{Filename: "a", Offset: 4, Line: 1, Col: 5}, Position{Filename: "a", Offset: 20, Line: 3, Col: 2}, "a:1:5-3:1"},
+		{Position{Line: 2, Col: 1}, Position{}, "2:1"},
+	}
+	for _, tt := range tests {
+		if span := Span(tt.pos, tt.end); span != tt.expected {
+			t.Errorf("wrong span. got=%s, want=%s", span, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type dir struct {
+	root string
+}
+
+// Dir returns an FS for the directory tree rooted at root of the host.
+// Paths are checked with Clean, symbolic links are followed only as long as they stay inside root.
+func Dir(root string) FS {
+	return &dir{root: root}
+}
+
+func (d *dir) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) || strings.ContainsRune(name, '\\') {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	p, err := d.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		// the error names the path of the script rather than the one of the host
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: pe.Err}
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// join returns the host path of name, after following the symbolic links on the way to it
+func (d *dir) join(op, name string) (string, error) {
+	cleaned, err := Clean(name)
+	if err != nil {
+		err.(*fs.PathError).Op = op
+		return "", err
+	}
+	if op == "remove" && cleaned == "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	root, err := resolve(d.root)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	p, err := resolve(filepath.Join(root, filepath.FromSlash(cleaned)))
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrEscape}
+	}
+	return p, nil
+}
+
+// resolve follows the symbolic links in the absolute form of p, the part of it that does not exist yet is kept as is
+func resolve(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return resolved, err
+	}
+	parent := filepath.Dir(p)
+	if parent == p {
+		return p, nil
+	}
+	resolved, err = resolve(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, filepath.Base(p)), nil
+}
+
+func (d *dir) WriteFile(name string, data []byte) error {
+	p, err := d.join("write", name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+func (d *dir) AppendFile(name string, data []byte) error {
+	p, err := d.join("append", name)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (d *dir) MkdirAll(name string) error {
+	p, err := d.join("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0755)
+}
+
+func (d *dir) Remove(name string) error {
+	p, err := d.join("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
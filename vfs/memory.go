@@ -0,0 +1,130 @@
+package vfs
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing/fstest"
+)
+
+// Memory is an FS kept entirely in memory, it is safe for concurrent use
+type Memory struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// NewMemory returns a Memory holding the given files, keyed by slash separated path
+func NewMemory(files map[string]string) *Memory {
+	m := &Memory{files: fstest.MapFS{}}
+	for name, content := range files {
+		m.files[name] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+	}
+	return m
+}
+
+func (m *Memory) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Open(name)
+}
+
+func (m *Memory) check(op, name string) (string, error) {
+	cleaned, err := Clean(name)
+	if err != nil {
+		err.(*fs.PathError).Op = op
+		return "", err
+	}
+	if cleaned == "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	// the parent must be a directory
+	for dir := path.Dir(cleaned); dir != "."; dir = path.Dir(dir) {
+		if f, ok := m.files[dir]; ok && !f.Mode.IsDir() {
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	return cleaned, nil
+}
+
+func (m *Memory) isDir(name string) bool {
+	if f, ok := m.files[name]; ok {
+		return f.Mode.IsDir()
+	}
+	prefix := name + "/"
+	for other := range m.files {
+		if strings.HasPrefix(other, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cleaned, err := m.check("write", name)
+	if err != nil {
+		return err
+	}
+	if m.isDir(cleaned) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	// never modify the data of an existing file in place, open files keep reading their snapshot
+	m.files[cleaned] = &fstest.MapFile{Data: append([]byte{}, data...), Mode: 0644}
+	return nil
+}
+
+func (m *Memory) AppendFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cleaned, err := m.check("append", name)
+	if err != nil {
+		return err
+	}
+	if m.isDir(cleaned) {
+		return &fs.PathError{Op: "append", Path: name, Err: fs.ErrInvalid}
+	}
+	var old []byte
+	if f, ok := m.files[cleaned]; ok {
+		old = f.Data
+	}
+	m.files[cleaned] = &fstest.MapFile{Data: append(append([]byte{}, old...), data...), Mode: 0644}
+	return nil
+}
+
+func (m *Memory) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cleaned, err := m.check("mkdir", name)
+	if err != nil {
+		return err
+	}
+	for dir := cleaned; dir != "."; dir = path.Dir(dir) {
+		if f, ok := m.files[dir]; ok && !f.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		m.files[dir] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+	}
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cleaned, err := m.check("remove", name)
+	if err != nil {
+		return err
+	}
+	prefix := cleaned + "/"
+	for other := range m.files {
+		if strings.HasPrefix(other, prefix) {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	if _, ok := m.files[cleaned]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, cleaned)
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+Package vfs provides the file systems stang scripts are allowed to touch.
+A host hands an fs.FS to the evaluator, if it also implements FS scripts may modify it.
+*/
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// FS is an fs.FS that can also be written to
+type FS interface {
+	fs.FS
+	WriteFile(name string, data []byte) error
+	AppendFile(name string, data []byte) error
+	MkdirAll(name string) error
+	Remove(name string) error
+}
+
+var ErrEscape = errors.New("path escapes the file system root")
+
+// Clean turns a path written in a script into a path valid for fs.FS, e.g. "./a//b" becomes "a/b".
+// Absolute paths and paths leaving the root through ".." are rejected with ErrEscape.
+func Clean(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") {
+		return "", &fs.PathError{Op: "open", Path: name, Err: ErrEscape}
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") || !fs.ValidPath(cleaned) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: ErrEscape}
+	}
+	return cleaned, nil
+}
+
+type readOnly struct {
+	fs.FS
+}
+
+// ReadOnly hides the write methods of fsys, so scripts can only read from it
+func ReadOnly(fsys fs.FS) fs.FS {
+	return readOnly{FS: fsys}
+}
@@ -0,0 +1,148 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		escapes  bool
+	}{
+		{"a.txt", "a.txt", false},
+		{"./a//b/../c.txt", "a/c.txt", false},
+		{".", ".", false},
+		{"a\\b", "a/b", false},
+		{"../secret", "", true},
+		{"a/../../secret", "", true},
+		{"/etc/passwd", "", true},
+		{"..", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Clean(tt.input)
+		if tt.escapes {
+			if !errors.Is(err, ErrEscape) {
+				t.Errorf("Clean(%q) should be rejected. got=%q, %v", tt.input, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("Clean(%q) wrong. got=%q, %v, want=%q", tt.input, got, err, tt.expected)
+		}
+	}
+}
+
+func testWritable(t *testing.T, fsys FS) {
+	if err := fsys.MkdirAll("logs/2022"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := fsys.WriteFile("logs/2022/a.txt", []byte("hello")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.AppendFile("logs/2022/a.txt", []byte(" world")); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	if err := fsys.AppendFile("logs/b.txt", []byte("new")); err != nil {
+		t.Fatalf("AppendFile should create the file: %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "logs/2022/a.txt"); err != nil || string(data) != "hello world" {
+		t.Errorf("ReadFile wrong. got=%q, %v", data, err)
+	}
+	if err := fstest.TestFS(fsys, "logs/2022/a.txt", "logs/b.txt"); err != nil {
+		t.Errorf("TestFS failed: %v", err)
+	}
+	if err := fsys.WriteFile("../escape.txt", nil); !errors.Is(err, ErrEscape) {
+		t.Errorf("writing outside of the root should fail. got=%v", err)
+	}
+	if err := fsys.Remove("logs"); err == nil {
+		t.Errorf("removing a non-empty directory should fail")
+	}
+	if err := fsys.Remove("logs/b.txt"); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+	if _, err := fs.Stat(fsys, "logs/b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("removed file should not exist. got=%v", err)
+	}
+	if err := fsys.Remove("."); err == nil {
+		t.Errorf("removing the root should fail")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(map[string]string{"seed.txt": "1"})
+	if data, err := fs.ReadFile(m, "seed.txt"); err != nil || string(data) != "1" {
+		t.Errorf("ReadFile wrong. got=%q, %v", data, err)
+	}
+	testWritable(t, m)
+	if err := m.WriteFile("seed.txt/child", nil); err == nil {
+		t.Errorf("a file cannot be used as a directory")
+	}
+}
+
+func TestDir(t *testing.T) {
+	testWritable(t, Dir(t.TempDir()))
+}
+
+func TestDirSymlinks(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "data", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"out":    outside,
+		"secret": filepath.Join(outside, "secret.txt"),
+		"inside": filepath.Join(root, "data"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("cannot create symbolic links: %v", err)
+		}
+	}
+	d := Dir(root)
+	if data, err := fs.ReadFile(d, "inside/a.txt"); err != nil || string(data) != "a" {
+		t.Errorf("a link inside the root should be followed. got=%q, %v", data, err)
+	}
+	escapes := []struct {
+		op string
+		fn func() error
+	}{
+		{"read out/secret.txt", func() error { _, err := fs.ReadFile(d, "out/secret.txt"); return err }},
+		{"read secret", func() error { _, err := fs.ReadFile(d, "secret"); return err }},
+		{"list out", func() error { _, err := fs.ReadDir(d, "out"); return err }},
+		{"write out/new.txt", func() error { return d.WriteFile("out/new.txt", []byte("x")) }},
+		{"append secret", func() error { return d.AppendFile("secret", []byte("x")) }},
+		{"mkdir out/x", func() error { return d.MkdirAll("out/x") }},
+		{"remove out/secret.txt", func() error { return d.Remove("out/secret.txt") }},
+	}
+	for _, tt := range escapes {
+		if err := tt.fn(); !errors.Is(err, ErrEscape) {
+			t.Errorf("%s should escape the root. got=%v", tt.op, err)
+		}
+	}
+	entries, err := os.ReadDir(outside)
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || len(entries) != 1 || string(data) != "secret" {
+		t.Errorf("the directory outside the root should be unchanged. got=%v, %q, %v", entries, data, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ro := ReadOnly(NewMemory(map[string]string{"a.txt": "a"}))
+	if _, ok := ro.(FS); ok {
+		t.Errorf("ReadOnly should hide the write methods")
+	}
+	if data, err := fs.ReadFile(ro, "a.txt"); err != nil || string(data) != "a" {
+		t.Errorf("ReadFile wrong. got=%q, %v", data, err)
+	}
+}